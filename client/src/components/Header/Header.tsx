@@ -1,9 +1,18 @@
 import { Link } from 'react-router-dom';
 import { FiLogOut, FiFileText } from 'react-icons/fi';
+import { API_URL } from '@/App';
 
 const Header = () => {
   // Function to handle logout
-  const handleLogout = () => {
+  const handleLogout = async () => {
+    // End the session on the server so the token can't be reused
+    const token = localStorage.getItem('token');
+    if (token) {
+      await fetch(`${API_URL}/auth/logout`, {
+        method: 'POST',
+        headers: { 'Authorization': `Bearer ${token}` },
+      }).catch(() => undefined);
+    }
     localStorage.removeItem('token');
     localStorage.removeItem('userId');
     window.location.href = '/login';
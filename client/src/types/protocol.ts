@@ -0,0 +1,218 @@
+// Code generated by cmd/wsproto-ts from internal/api/wsproto. DO NOT EDIT.
+
+export const MIN_PROTOCOL_VERSION = 1;
+export const MAX_PROTOCOL_VERSION = 1;
+
+export type ErrorCode = 'invalid_message' | 'unknown_type' | 'handshake_required' | 'unsupported_version' | 'save_failed' | 'document_locked';
+
+export interface HelloMessage {
+  type: 'hello';
+  id?: string;
+  protocol_versions: number[];
+  resume?: ResumeRequest;
+}
+
+export interface DocumentUpdateMessage {
+  type: 'document_update';
+  id?: string;
+  title: string;
+  content: string;
+}
+
+export interface CursorPositionUpdateMessage {
+  type: 'cursor_position';
+  id?: string;
+  position: number;
+}
+
+export interface SelectionUpdateMessage {
+  type: 'selection';
+  id?: string;
+  anchor: number;
+  head: number;
+}
+
+export interface PingMessage {
+  type: 'ping';
+  id?: string;
+}
+
+export interface InitMessage {
+  type: 'init';
+  id?: string;
+  protocol_version: number;
+  session_token: string;
+  version: number;
+  document: Document;
+  presence: Presence[];
+  locks: Lock[];
+}
+
+export interface ResumedMessage {
+  type: 'resumed';
+  id?: string;
+  protocol_version: number;
+  session_token: string;
+  version: number;
+  events: DocumentChangedMessage[];
+  presence: Presence[];
+  locks: Lock[];
+}
+
+export interface AckMessage {
+  type: 'ack';
+  id?: string;
+  reply_to: string;
+  version?: number;
+}
+
+export interface ErrorMessage {
+  type: 'error';
+  id?: string;
+  reply_to?: string;
+  code: ErrorCode;
+  message: string;
+}
+
+export interface PongMessage {
+  type: 'pong';
+  id?: string;
+  reply_to?: string;
+}
+
+export interface UserJoinedMessage {
+  type: 'user_joined';
+  id?: string;
+  user_id: string;
+  presence: Presence;
+}
+
+export interface UserLeftMessage {
+  type: 'user_left';
+  id?: string;
+  user_id: string;
+}
+
+export interface PresenceUpdateMessage {
+  type: 'presence_update';
+  id?: string;
+  presence: Presence;
+}
+
+export interface PresenceRemovedMessage {
+  type: 'presence_removed';
+  id?: string;
+  user_id: string;
+}
+
+export interface DocumentChangedMessage {
+  type: 'document_changed';
+  id?: string;
+  version: number;
+  user_id: string;
+  title: string;
+  content: string;
+}
+
+export interface DocumentUpdatedExternallyMessage {
+  type: 'document_updated_externally';
+  id?: string;
+  version: number;
+  user_id: string;
+  document: Document;
+}
+
+export interface DocumentDeletedMessage {
+  type: 'document_deleted';
+  id?: string;
+  user_id: string;
+}
+
+export interface ThrottledMessage {
+  type: 'throttled';
+  id?: string;
+  reply_to?: string;
+  message_type: string;
+  retry_after_ms: number;
+}
+
+export interface ServerRestartingMessage {
+  type: 'server_restarting';
+  id?: string;
+  retry_after_ms: number;
+}
+
+export interface LockAcquiredMessage {
+  type: 'lock_acquired';
+  id?: string;
+  lock: Lock;
+}
+
+export interface LockReleasedMessage {
+  type: 'lock_released';
+  id?: string;
+  user_id: string;
+  forced: boolean;
+}
+
+export interface ResumeRequest {
+  session_token: string;
+  last_version: number;
+}
+
+export interface Document {
+  id?: string;
+  title?: string;
+  content?: string;
+  user_id?: string;
+  created_at?: string;
+  updated_at?: string;
+}
+
+export interface Presence {
+  user_id: string;
+  username: string;
+  color: string;
+  cursor?: CursorPosition;
+  selection?: SelectionRange;
+  last_active: string;
+}
+
+export interface Lock {
+  owner_id: string;
+  expires_at: string;
+}
+
+export interface CursorPosition {
+  position: number;
+}
+
+export interface SelectionRange {
+  anchor: number;
+  head: number;
+}
+
+export type ClientMessage =
+  | HelloMessage
+  | DocumentUpdateMessage
+  | CursorPositionUpdateMessage
+  | SelectionUpdateMessage
+  | PingMessage;
+
+export type ServerMessage =
+  | InitMessage
+  | ResumedMessage
+  | AckMessage
+  | ErrorMessage
+  | PongMessage
+  | UserJoinedMessage
+  | UserLeftMessage
+  | PresenceUpdateMessage
+  | PresenceRemovedMessage
+  | DocumentChangedMessage
+  | DocumentUpdatedExternallyMessage
+  | DocumentDeletedMessage
+  | ThrottledMessage
+  | ServerRestartingMessage
+  | LockAcquiredMessage
+  | LockReleasedMessage;
@@ -9,16 +9,19 @@ import (
 	"os/signal"
 	"strconv"
 	"syscall"
-	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
 	"github.com/malaxitlmax/penfeel/config"
 	"github.com/malaxitlmax/penfeel/internal/api/handler"
 	"github.com/malaxitlmax/penfeel/internal/api/middleware"
+	"github.com/malaxitlmax/penfeel/internal/api/service"
+	pkgauth "github.com/malaxitlmax/penfeel/pkg/auth"
+	"github.com/malaxitlmax/penfeel/pkg/grpcauth"
+	"github.com/malaxitlmax/penfeel/pkg/grpctls"
+	"github.com/malaxitlmax/penfeel/pkg/ratelimit"
+	"github.com/malaxitlmax/penfeel/pkg/requestmeta"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 
 	pb "github.com/malaxitlmax/penfeel/api/proto"
 )
@@ -55,20 +58,37 @@ func main() {
 		}
 	}
 
+	// Сертификаты для gRPC соединений между сервисами, перечитываются при изменении файлов
+	tlsCreds, err := grpctls.NewCredentials(cfg.GRPCTLS)
+	if err != nil {
+		log.Fatalf("Failed to load TLS certificates: %v", err)
+	}
+	defer tlsCreds.Close()
+
 	// Устанавливаем соединение с auth service через gRPC
 	authConn, err := grpc.Dial(
 		fmt.Sprintf("%s:%d", authServiceHost, cfg.Server.GRPCPort),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(tlsCreds.ClientCredentials()),
+		grpc.WithChainUnaryInterceptor(requestmeta.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(requestmeta.StreamClientInterceptor()),
 	)
 	if err != nil {
 		log.Fatalf("Failed to connect to auth service: %v", err)
 	}
 	defer authConn.Close()
 
+	// Document service доверяет только подписанному удостоверению пользователя
+	signer, err := grpcauth.NewSigner("api-gateway", cfg.ServiceAuth, cfg.GRPCTLS.MutualTLS())
+	if err != nil {
+		log.Fatalf("Failed to configure service identity: %v", err)
+	}
+
 	// Устанавливаем соединение с document service через gRPC
 	documentConn, err := grpc.Dial(
 		fmt.Sprintf("%s:%d", documentServiceHost, documentServicePort),
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithTransportCredentials(tlsCreds.ClientCredentials()),
+		grpc.WithChainUnaryInterceptor(requestmeta.UnaryClientInterceptor(), signer.UnaryClientInterceptor()),
+		grpc.WithChainStreamInterceptor(requestmeta.StreamClientInterceptor(), signer.StreamClientInterceptor()),
 	)
 	if err != nil {
 		log.Fatalf("Failed to connect to document service: %v", err)
@@ -81,46 +101,151 @@ func main() {
 
 	// Создаем роутер gin
 	router := gin.Default()
+	// IP клиента ограничивает попытки входа и анонимные запросы, поэтому заголовки прокси
+	// принимаются только от настроенных прокси
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Failed to set trusted proxies: %v", err)
+	}
+	router.Use(middleware.RequestIDMiddleware(), middleware.ClientMiddleware())
+
+	// Разрешённые источники общие для CORS и WebSocket рукопожатий
+	originPolicy := middleware.NewOriginPolicy(cfg.CORS.AllowedOrigins)
+	router.Use(middleware.CORSMiddleware(originPolicy))
 
-	if isDev {
-		// Configure CORS middleware
-		corsConfig := cors.DefaultConfig()
-		corsConfig.AllowAllOrigins = true // For development; restrict in production
-		corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
-		corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
-		corsConfig.ExposeHeaders = []string{"Content-Length"}
-		corsConfig.AllowCredentials = true
-		router.Use(cors.New(corsConfig))
+	// Токены проверяются по открытым ключам auth-сервиса; токены, подписанные
+	// общим секретом (HS256), может проверить только сам auth-сервис
+	var tokenValidator service.TokenValidator
+	if cfg.TokenVerification.Local && cfg.JWT.Algorithm != pkgauth.AlgorithmHS256 {
+		tokenValidator = pkgauth.NewJWTVerifier(
+			pkgauth.NewRemoteKeySet(service.AuthJWKSFetcher(authClient), cfg.JWT.JWKSCacheTTL),
+		)
+	} else if cfg.TokenVerification.Local {
+		log.Printf("WARNING: AUTH_LOCAL_VERIFICATION is ignored with JWT_ALGORITHM=%s, every request is verified by the auth service; set JWT_ALGORITHM=RS256 or EdDSA to verify tokens locally", cfg.JWT.Algorithm)
 	}
+	tokenVerifier := service.NewTokenVerifier(authClient, tokenValidator, cfg.TokenVerification, cfg.Timeout.Auth)
+	defer tokenVerifier.Close()
 
 	// Регистрируем маршруты для аутентификации
-	authHandler := handler.NewAuthHandler(authClient)
-	authMiddleware := middleware.AuthMiddleware(authClient)
+	authHandler := handler.NewAuthHandler(authClient, tokenVerifier)
+
+	authMiddleware := middleware.AuthMiddleware(tokenVerifier)
 
 	// Регистрируем маршруты для документов
-	documentHandler := handler.NewDocumentHandler(documentClient)
+	documentHandler := handler.NewDocumentHandler(documentClient, cfg.WebSocket, cfg.RateLimit, cfg.Timeout, originPolicy.CheckOrigin)
+
+	// Билеты для WebSocket подключений из браузера
+	ticketStore := service.NewTicketStore(cfg.WebSocket.TicketTTL)
+	ticketHandler := handler.NewTicketHandler(ticketStore)
+
+	// Лимит REST запросов: на пользователя после авторизации, на IP для публичных маршрутов
+	restLimiter := middleware.RateLimitMiddleware(ratelimit.NewKeyedLimiter(cfg.RateLimit.RESTRate, cfg.RateLimit.RESTBurst))
+
+	// Дедлайны вызовов сервисов задаются на маршрут: вложенный дедлайн не может продлить внешний
+	authTimeout := middleware.TimeoutMiddleware(cfg.Timeout.Auth)
+	readTimeout := middleware.TimeoutMiddleware(cfg.Timeout.DocumentRead)
+	writeTimeout := middleware.TimeoutMiddleware(cfg.Timeout.DocumentWrite)
+	defaultTimeout := middleware.TimeoutMiddleware(cfg.Timeout.Default)
+
+	// Создание документов до подтверждения email запрещается, если так настроено
+	var requireVerifiedEmail gin.HandlerFunc = func(c *gin.Context) { c.Next() }
+	if cfg.Account.EmailVerificationRequired == config.EmailVerificationDocuments {
+		requireVerifiedEmail = middleware.VerifiedEmailMiddleware()
+	}
 
 	// Путь к собранному React-приложению
 	staticPath := "./client/dist"
 
+	// Открытые ключи подписи токенов для проверки без обращения к auth-сервису
+	router.GET("/.well-known/jwks.json", restLimiter, authTimeout, authHandler.JWKS)
+
 	// Публичные маршруты
 	authRoutes := router.Group("/api/v1/auth")
+	authRoutes.Use(restLimiter, authTimeout)
 	{
 		authRoutes.POST("/register", authHandler.Register)
 		authRoutes.POST("/login", authHandler.Login)
+		authRoutes.POST("/login/2fa", authHandler.CompleteLogin)
+		authRoutes.POST("/refresh", authHandler.Refresh)
 		authRoutes.POST("/validate", authHandler.ValidateToken)
+		authRoutes.POST("/password-reset", authHandler.RequestPasswordReset)
+		authRoutes.POST("/password-reset/confirm", authHandler.ResetPassword)
+		authRoutes.POST("/verify-email", authHandler.VerifyEmail)
+		authRoutes.POST("/verify-email/resend", authHandler.ResendVerification)
+		authRoutes.POST("/unlock", authHandler.UnlockAccount)
+		authRoutes.GET("/oidc/providers", authHandler.ListOIDCProviders)
+		authRoutes.POST("/oidc/:provider/start", authHandler.StartOIDCLogin)
+		authRoutes.POST("/oidc/callback", authHandler.CompleteOIDCLogin)
+	}
+
+	// Управление сессиями пользователя доступно только после входа, не с персональным токеном
+	sessionRoutes := router.Group("/api/v1/auth")
+	sessionRoutes.Use(authMiddleware, middleware.SessionOnlyMiddleware(), restLimiter, authTimeout)
+	{
+		sessionRoutes.POST("/logout", authHandler.Logout)
+		sessionRoutes.POST("/logout-all", authHandler.LogoutAll)
+		sessionRoutes.GET("/sessions", authHandler.ListSessions)
+		sessionRoutes.DELETE("/sessions/:id", authHandler.RevokeSession)
+		sessionRoutes.POST("/2fa/setup", authHandler.SetupTwoFactor)
+		sessionRoutes.POST("/2fa/confirm", authHandler.ConfirmTwoFactor)
+		sessionRoutes.POST("/2fa/disable", authHandler.DisableTwoFactor)
+	}
+
+	// Персональные токены доступа: с токеном сессии или персональным токеном с правом admin,
+	// право проверяет auth-сервис. Создать токен можно только после входа
+	tokenRoutes := router.Group("/api/v1/auth/tokens")
+	tokenRoutes.Use(authMiddleware, restLimiter, authTimeout)
+	{
+		tokenRoutes.POST("", middleware.SessionOnlyMiddleware(), authHandler.CreatePersonalToken)
+		tokenRoutes.GET("", authHandler.ListPersonalTokens)
+		tokenRoutes.DELETE("/:id", authHandler.RevokePersonalToken)
+	}
+
+	// Профиль пользователя: только после входа, не с персональным токеном
+	profileHandler := handler.NewProfileHandler(authClient, tokenVerifier, cfg.Account.AvatarMaxSize)
+	profileRoutes := router.Group("/api/v1/profile")
+	profileRoutes.Use(authMiddleware, middleware.SessionOnlyMiddleware(), restLimiter, authTimeout)
+	{
+		profileRoutes.GET("", profileHandler.GetProfile)
+		profileRoutes.PATCH("", profileHandler.UpdateProfile)
+		profileRoutes.POST("/password", profileHandler.ChangePassword)
+		profileRoutes.POST("/email", profileHandler.ChangeEmail)
+		profileRoutes.PUT("/avatar", profileHandler.UploadAvatar)
+		profileRoutes.DELETE("/avatar", profileHandler.DeleteAvatar)
 	}
 
+	// Аватары публичны: их показывают рядом с документами и комментариями
+	router.GET("/api/v1/users/:id/avatar", restLimiter, authTimeout, profileHandler.GetAvatar)
+
+	// Права, которые нужны персональному токену; токену сессии разрешено всё
+	canRead := middleware.RequireScopeMiddleware(pkgauth.ScopeDocumentsRead)
+	canWrite := middleware.RequireScopeMiddleware(pkgauth.ScopeDocumentsWrite)
+
 	// Защищенные маршруты (пример)
 	protectedRoutes := router.Group("/api/v1")
-	protectedRoutes.Use(authMiddleware)
+	protectedRoutes.Use(authMiddleware, restLimiter)
 	{
 		// Пример защищенного маршрута
-		protectedRoutes.GET("documents", documentHandler.GetDocuments)
-		protectedRoutes.GET("documents/:id", documentHandler.GetDocument)
-		protectedRoutes.POST("documents", documentHandler.CreateDocument)
-		protectedRoutes.PUT("documents/:id", documentHandler.UpdateDocument)
-		protectedRoutes.DELETE("documents/:id", documentHandler.DeleteDocument)
+		protectedRoutes.GET("documents", canRead, readTimeout, documentHandler.GetDocuments)
+		protectedRoutes.GET("documents/:id", canRead, readTimeout, documentHandler.GetDocument)
+		protectedRoutes.POST("documents", canWrite, requireVerifiedEmail, writeTimeout, documentHandler.CreateDocument)
+		protectedRoutes.PUT("documents/:id", canWrite, writeTimeout, documentHandler.UpdateDocument)
+		protectedRoutes.DELETE("documents/:id", canWrite, writeTimeout, documentHandler.DeleteDocument)
+		protectedRoutes.POST("documents/:id/lock", canWrite, writeTimeout, documentHandler.LockDocument)
+		protectedRoutes.DELETE("documents/:id/lock", canWrite, writeTimeout, documentHandler.UnlockDocument)
+		// Билет даёт совместное редактирование, поэтому требует права на запись
+		protectedRoutes.POST("ws/tickets", canWrite, defaultTimeout, ticketHandler.IssueTicket)
+	}
+
+	// WebSocket маршруты авторизуются билетом или токеном в подпротоколе
+	wsRoutes := router.Group("/api/v1/ws")
+	wsRoutes.Use(
+		middleware.WebSocketOriginMiddleware(originPolicy),
+		middleware.WebSocketAuthMiddleware(tokenVerifier, ticketStore),
+		canWrite,
+		restLimiter,
+	)
+	{
+		wsRoutes.GET("documents/:id", documentHandler.ConnectDocument)
 	}
 
 	// TODO: включать на проде
@@ -149,9 +274,15 @@ func main() {
 
 	log.Println("Shutting down API Gateway...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 
+	// server.Shutdown не закрывает WebSocket соединения, поэтому сначала завершаем сессии
+	// и сохраняем отложенные правки документов
+	if err := documentHandler.Shutdown(ctx); err != nil {
+		log.Printf("Failed to save pending document changes: %v", err)
+	}
+
 	if err := server.Shutdown(ctx); err != nil {
 		log.Fatalf("Server shutdown failed: %v", err)
 	}
@@ -12,6 +12,10 @@ import (
 	"github.com/malaxitlmax/penfeel/internal/auth"
 	pkgauth "github.com/malaxitlmax/penfeel/pkg/auth"
 	"github.com/malaxitlmax/penfeel/pkg/database"
+	"github.com/malaxitlmax/penfeel/pkg/grpctls"
+	"github.com/malaxitlmax/penfeel/pkg/mailer"
+	"github.com/malaxitlmax/penfeel/pkg/oidc"
+	"github.com/malaxitlmax/penfeel/pkg/requestmeta"
 	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
@@ -23,6 +27,11 @@ func main() {
 	// Загружаем конфигурацию
 	cfg := config.LoadConfig()
 
+	// Токены, подписанные опубликованным секретом по умолчанию, может выпустить кто угодно
+	if cfg.JWT.Algorithm == pkgauth.AlgorithmHS256 && cfg.JWT.Secret == config.DefaultJWTSecret {
+		log.Fatalf("JWT_SECRET is not set: refusing to sign access tokens with the default secret, set JWT_SECRET or JWT_ALGORITHM=RS256 or EdDSA")
+	}
+
 	// Подключаемся к базе данных
 	migrationPath := ""
 	if cfg.Migration.Enabled {
@@ -51,18 +60,60 @@ func main() {
 		cfg.JWT.RefreshExpHours,
 	)
 
+	// При асимметричной подписи access токены подписываются ротируемыми ключами,
+	// открытые ключи публикуются через GetJWKS
+	if cfg.JWT.Algorithm != pkgauth.AlgorithmHS256 {
+		keys, err := pkgauth.NewKeySet(cfg.JWT)
+		if err != nil {
+			log.Fatalf("Failed to load JWT signing keys: %v", err)
+		}
+		defer keys.Close()
+
+		jwtService = pkgauth.NewAsymmetricJWTService(
+			keys,
+			cfg.JWT.ExpirationHours,
+			cfg.JWT.RefreshSecret,
+			cfg.JWT.RefreshExpHours,
+		)
+	}
+
+	// Письма со ссылками сброса пароля
+	mail, err := mailer.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to configure mailer: %v", err)
+	}
+
+	// Внешние провайдеры OpenID Connect; их параметры загружаются при первом входе
+	oidcProviders, err := oidc.NewProviders(cfg.OIDC)
+	if err != nil {
+		log.Fatalf("Failed to configure OIDC providers: %v", err)
+	}
+
 	// Создаем сервис авторизации
-	authService := auth.NewAuthService(repo, passwordService, jwtService)
+	authService := auth.NewAuthService(repo, passwordService, jwtService, mail, cfg.Mail.SendTimeout, cfg.Account, cfg.LoginProtection, oidcProviders, cfg.OIDC.StateTTL)
+
+	// Сертификаты для gRPC соединений между сервисами, перечитываются при изменении файлов
+	tlsCreds, err := grpctls.NewCredentials(cfg.GRPCTLS)
+	if err != nil {
+		log.Fatalf("Failed to load TLS certificates: %v", err)
+	}
+	defer tlsCreds.Close()
 
 	// Создаем gRPC сервер
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(
+		grpc.Creds(tlsCreds.ServerCredentials()),
+		grpc.ChainUnaryInterceptor(requestmeta.UnaryServerInterceptor(), auth.AdminUnaryInterceptor(cfg.GRPCTLS.AdminClients)),
+		grpc.ChainStreamInterceptor(requestmeta.StreamServerInterceptor()),
+	)
 
 	// Регистрируем сервис авторизации
 	authGRPCServer := auth.NewGRPCServer(authService)
 	pb.RegisterAuthServiceServer(grpcServer, authGRPCServer)
 
-	// Включаем reflection для отладки с помощью grpcurl
-	reflection.Register(grpcServer)
+	// Включаем reflection для отладки с помощью grpcurl, только при локальной разработке
+	if os.Getenv("ENV") == "dev" {
+		reflection.Register(grpcServer)
+	}
 
 	// Запускаем gRPC сервер
 	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Server.GRPCPort))
@@ -7,8 +7,9 @@ import (
 	"time"
 
 	pb "github.com/malaxitlmax/penfeel/api/proto"
+	"github.com/malaxitlmax/penfeel/config"
+	"github.com/malaxitlmax/penfeel/pkg/grpctls"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
 func main() {
@@ -18,9 +19,16 @@ func main() {
 		addr = "localhost:9090"
 	}
 
+	// При включённом GRPC_TLS_ENABLED подключаемся с сертификатом клиента
+	tlsCreds, err := grpctls.NewCredentials(config.LoadConfig().GRPCTLS)
+	if err != nil {
+		log.Fatalf("Failed to load TLS certificates: %v", err)
+	}
+	defer tlsCreds.Close()
+
 	// Подключаемся к gRPC серверу
 	log.Printf("Connecting to %s", addr)
-	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(tlsCreds.ClientCredentials()))
 	if err != nil {
 		log.Fatalf("Failed to connect: %v", err)
 	}
@@ -74,11 +82,7 @@ func register(ctx context.Context, client pb.AuthServiceClient, username, email,
 		log.Fatalf("Failed to register user: %v", err)
 	}
 
-	if resp.Success {
-		log.Printf("User registered successfully. User ID: %s", resp.UserId)
-	} else {
-		log.Printf("Failed to register user: %s", resp.Error)
-	}
+	log.Printf("User registered successfully. User ID: %s", resp.UserId)
 }
 
 func login(ctx context.Context, client pb.AuthServiceClient, email, password string) {
@@ -92,15 +96,11 @@ func login(ctx context.Context, client pb.AuthServiceClient, email, password str
 		log.Fatalf("Failed to login: %v", err)
 	}
 
-	if resp.Success {
-		log.Printf("Login successful")
-		log.Printf("Token: %s", resp.Token)
-		log.Printf("Refresh Token: %s", resp.RefreshToken)
-		log.Printf("User: ID=%s, Username=%s, Email=%s",
-			resp.User.Id, resp.User.Username, resp.User.Email)
-	} else {
-		log.Printf("Login failed: %s", resp.Error)
-	}
+	log.Printf("Login successful")
+	log.Printf("Token: %s", resp.Token)
+	log.Printf("Refresh Token: %s", resp.RefreshToken)
+	log.Printf("User: ID=%s, Username=%s, Email=%s",
+		resp.User.Id, resp.User.Username, resp.User.Email)
 }
 
 func validateToken(ctx context.Context, client pb.AuthServiceClient, token string) {
@@ -113,11 +113,7 @@ func validateToken(ctx context.Context, client pb.AuthServiceClient, token strin
 		log.Fatalf("Failed to validate token: %v", err)
 	}
 
-	if resp.Valid {
-		log.Printf("Token is valid")
-		log.Printf("User: ID=%s, Username=%s, Email=%s",
-			resp.User.Id, resp.User.Username, resp.User.Email)
-	} else {
-		log.Printf("Token is invalid: %s", resp.Error)
-	}
+	log.Printf("Token is valid")
+	log.Printf("User: ID=%s, Username=%s, Email=%s",
+		resp.User.Id, resp.User.Username, resp.User.Email)
 }
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Выпускает CA и сертификаты сервисов для локального запуска с mutual TLS.
+// Существующий CA в каталоге переиспользуется, поэтому повторный запуск обновляет
+// сертификаты сервисов, не ломая доверие к уже выпущенным.
+func main() {
+	outDir := flag.String("out", "certs", "output directory")
+	services := flag.String("services", "api-gateway,auth-service,document-service", "comma-separated service names, each used as certificate DNS name")
+	hosts := flag.String("hosts", "localhost,127.0.0.1", "comma-separated extra DNS names and IP addresses for every service certificate")
+	validFor := flag.Duration("valid-for", 365*24*time.Hour, "service certificate lifetime")
+	flag.Parse()
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		log.Fatalf("Failed to create %s: %v", *outDir, err)
+	}
+
+	ca, caKey, err := loadOrCreateCA(*outDir)
+	if err != nil {
+		log.Fatalf("Failed to prepare CA: %v", err)
+	}
+
+	for _, service := range splitList(*services) {
+		names := append([]string{service}, splitList(*hosts)...)
+		if err := issue(*outDir, service, names, *validFor, ca, caKey); err != nil {
+			log.Fatalf("Failed to issue certificate for %s: %v", service, err)
+		}
+		log.Printf("Issued %s", filepath.Join(*outDir, service+".pem"))
+	}
+
+	if err := createIdentityKey(*outDir); err != nil {
+		log.Fatalf("Failed to prepare service identity key: %v", err)
+	}
+}
+
+// createIdentityKey создаёт пару ключей Ed25519 для удостоверений сервисов:
+// service-identity-key.pem для шлюза и service-identity-public.pem для document-сервиса.
+// Существующая пара переиспользуется, чтобы удостоверения работающего шлюза оставались действительными.
+func createIdentityKey(dir string) error {
+	keyPath := filepath.Join(dir, "service-identity-key.pem")
+	publicPath := filepath.Join(dir, "service-identity-public.pem")
+
+	if _, err := os.Stat(keyPath); err == nil {
+		if _, err := os.Stat(publicPath); err == nil {
+			log.Printf("Using existing service identity key %s", keyPath)
+			return nil
+		}
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return err
+	}
+
+	if err := writeKey(keyPath, private); err != nil {
+		return err
+	}
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		return err
+	}
+	log.Printf("Created service identity key %s", keyPath)
+	return nil
+}
+
+// loadOrCreateCA читает CA из ca.pem и ca-key.pem или создаёт новый
+func loadOrCreateCA(dir string) (*x509.Certificate, crypto.Signer, error) {
+	certPath := filepath.Join(dir, "ca.pem")
+	keyPath := filepath.Join(dir, "ca-key.pem")
+
+	certPEM, certErr := os.ReadFile(certPath)
+	keyPEM, keyErr := os.ReadFile(keyPath)
+	if certErr == nil && keyErr == nil {
+		ca, key, err := parseCA(certPEM, keyPEM)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse existing CA: %w", err)
+		}
+		log.Printf("Using existing CA %s", certPath)
+		return ca, key, nil
+	}
+	if certErr != nil && !errors.Is(certErr, os.ErrNotExist) {
+		return nil, nil, certErr
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{CommonName: "penfeel dev CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(10 * 365 * 24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, err
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := writeKey(keyPath, key); err != nil {
+		return nil, nil, err
+	}
+	if err := writeCertificate(certPath, der); err != nil {
+		return nil, nil, err
+	}
+	log.Printf("Created CA %s", certPath)
+	return ca, key, nil
+}
+
+// parseCA разбирает сертификат и ключ CA в PEM
+func parseCA(certPEM, keyPEM []byte) (*x509.Certificate, crypto.Signer, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, errors.New("invalid PEM")
+	}
+
+	ca, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, nil, errors.New("CA key cannot sign")
+	}
+	return ca, signer, nil
+}
+
+// issue выпускает сертификат сервиса, пригодный и для сервера, и для клиента
+func issue(dir, service string, names []string, validFor time.Duration, ca *x509.Certificate, caKey crypto.Signer) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serialNumber(),
+		Subject:      pkix.Name{CommonName: service},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(validFor),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	for _, name := range names {
+		if ip := net.ParseIP(name); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, name)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	if err != nil {
+		return err
+	}
+
+	// Ключ записывается первым: сервисы перечитывают пару, когда меняется любой из файлов
+	if err := writeKey(filepath.Join(dir, service+"-key.pem"), key); err != nil {
+		return err
+	}
+	return writeCertificate(filepath.Join(dir, service+".pem"), der)
+}
+
+// writeCertificate записывает сертификат в PEM
+func writeCertificate(path string, der []byte) error {
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+// writeKey записывает закрытый ключ в PEM (PKCS #8), доступный только владельцу
+func writeKey(path string, key crypto.Signer) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+}
+
+// serialNumber случайный серийный номер сертификата
+func serialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		log.Fatalf("Failed to generate serial number: %v", err)
+	}
+	return serial
+}
+
+// splitList разбирает список через запятую
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
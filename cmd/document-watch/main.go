@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+
+	pb "github.com/malaxitlmax/penfeel/api/proto"
+	"github.com/malaxitlmax/penfeel/config"
+	"github.com/malaxitlmax/penfeel/pkg/grpcauth"
+	"github.com/malaxitlmax/penfeel/pkg/grpctls"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Следит за изменениями документа через gRPC, минуя WebSocket шлюз
+func main() {
+	addr := os.Getenv("DOCUMENT_SERVICE_ADDR")
+	if addr == "" {
+		addr = "localhost:9090"
+	}
+
+	documentID := os.Getenv("DOCUMENT_ID")
+	token := os.Getenv("TOKEN")
+	if documentID == "" || token == "" {
+		log.Fatal("DOCUMENT_ID and TOKEN environment variables are required")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	// Document-сервис определяет пользователя по JWT из метаданных
+	ctx = metadata.AppendToOutgoingContext(ctx, grpcauth.AuthorizationKey, "Bearer "+token)
+
+	// При включённом GRPC_TLS_ENABLED подключаемся с сертификатом клиента
+	tlsCreds, err := grpctls.NewCredentials(config.LoadConfig().GRPCTLS)
+	if err != nil {
+		log.Fatalf("Failed to load TLS certificates: %v", err)
+	}
+	defer tlsCreds.Close()
+
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(tlsCreds.ClientCredentials()))
+	if err != nil {
+		log.Fatalf("Failed to connect to document service: %v", err)
+	}
+	defer conn.Close()
+
+	stream, err := pb.NewDocumentServiceClient(conn).SubscribeDocument(ctx, &pb.SubscribeDocumentRequest{
+		Id: documentID,
+	})
+	if err != nil {
+		log.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			log.Println("Subscription ended")
+			return
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Fatalf("Subscription failed: %v", err)
+		}
+
+		switch e := event.Event.(type) {
+		case *pb.DocumentEvent_Snapshot:
+			log.Printf("v%d snapshot: %q (%d chars)", event.Version, e.Snapshot.Title, len(e.Snapshot.Content))
+		case *pb.DocumentEvent_Updated:
+			log.Printf("v%d updated by %s: %q (%d chars)", event.Version, event.UserId, e.Updated.Title, len(e.Updated.Content))
+		case *pb.DocumentEvent_Deleted:
+			log.Printf("v%d deleted by %s", event.Version, event.UserId)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/malaxitlmax/penfeel/internal/api/wsproto"
 )
 
 func main() {
@@ -16,17 +17,37 @@ func main() {
 		addr = "localhost:8080"
 	}
 
+	documentID := os.Getenv("DOCUMENT_ID")
+	token := os.Getenv("ACCESS_TOKEN")
+	if documentID == "" || token == "" {
+		log.Fatal("DOCUMENT_ID and ACCESS_TOKEN environment variables are required")
+	}
+
 	interrupt := make(chan os.Signal, 1)
 	signal.Notify(interrupt, os.Interrupt)
 
-	u := url.URL{Scheme: "ws", Host: addr, Path: "/document"}
+	u := url.URL{Scheme: "ws", Host: addr, Path: "/api/v1/ws/documents/" + documentID}
+
+	// Передаем токен подпротоколом, как это делает браузер
+	dialer := websocket.Dialer{
+		Subprotocols: []string{wsproto.Subprotocol, wsproto.TokenSubprotocolPrefix + token},
+	}
 
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	conn, _, err := dialer.Dial(u.String(), nil)
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer conn.Close()
 
+	// Согласовываем версию протокола
+	err = conn.WriteJSON(wsproto.Hello{
+		Envelope:         wsproto.Envelope{Type: wsproto.TypeHello},
+		ProtocolVersions: []int{wsproto.MaxProtocolVersion},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	done := make(chan struct{})
 
 	go func() {
@@ -50,7 +71,7 @@ func main() {
 		case <-done:
 			return
 		case <-ticker.C:
-			err := conn.WriteMessage(websocket.TextMessage, []byte("ping"))
+			err := conn.WriteJSON(wsproto.Ping{Envelope: wsproto.Envelope{Type: wsproto.TypePing}})
 			if err != nil {
 				log.Println("write:", err)
 				return
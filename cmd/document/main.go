@@ -6,6 +6,7 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 
 	"github.com/joho/godotenv"
@@ -13,7 +14,12 @@ import (
 	pb "github.com/malaxitlmax/penfeel/api/proto"
 	"github.com/malaxitlmax/penfeel/config"
 	"github.com/malaxitlmax/penfeel/internal/document"
+	pkgauth "github.com/malaxitlmax/penfeel/pkg/auth"
 	"github.com/malaxitlmax/penfeel/pkg/database"
+	"github.com/malaxitlmax/penfeel/pkg/grpcauth"
+	"github.com/malaxitlmax/penfeel/pkg/grpctls"
+	"github.com/malaxitlmax/penfeel/pkg/requestmeta"
+	"github.com/malaxitlmax/penfeel/pkg/revocation"
 	"google.golang.org/grpc"
 )
 
@@ -29,6 +35,12 @@ func main() {
 	// Загружаем конфигурацию
 	cfg := config.LoadConfig()
 
+	// Без JWKS URL токены проверяются общим секретом: опубликованным секретом по умолчанию
+	// кто угодно подпишет токен, который здесь примут
+	if cfg.JWT.JWKSURL == "" && cfg.JWT.Secret == config.DefaultJWTSecret {
+		log.Fatalf("JWT_SECRET is not set: refusing to verify access tokens with the default secret, set JWT_SECRET or JWT_JWKS_URL")
+	}
+
 	// Подключаемся к базе данных с запуском миграций
 	migrationPath := ""
 	if cfg.Migration.Enabled {
@@ -48,8 +60,11 @@ func main() {
 	// Создаем репозиторий
 	repo := document.NewPostgresRepository(db)
 
+	// Хаб рассылает изменения документов потоковым подпискам
+	hub := document.NewHub()
+
 	// Создаем сервис
-	service := document.NewDocumentService(repo)
+	service := document.NewDocumentService(repo, hub)
 
 	// Создаем gRPC сервер
 	grpcServer := document.NewGRPCServer(service)
@@ -60,7 +75,63 @@ func main() {
 		log.Fatalf("Failed to listen: %v", err)
 	}
 
-	server := grpc.NewServer()
+	// JWT пользователей проверяются по опубликованным открытым ключам, если задан JWKS URL,
+	// иначе общим с auth-сервисом секретом
+	var tokens grpcauth.TokenValidator = pkgauth.NewJWTService(
+		cfg.JWT.Secret,
+		cfg.JWT.ExpirationHours,
+		cfg.JWT.RefreshSecret,
+		cfg.JWT.RefreshExpHours,
+	)
+	if cfg.JWT.JWKSURL != "" {
+		tokens = pkgauth.NewJWTVerifier(
+			pkgauth.NewRemoteKeySet(pkgauth.HTTPJWKSFetcher(cfg.JWT.JWKSURL), cfg.JWT.JWKSCacheTTL),
+		)
+	}
+
+	// Сертификаты для gRPC соединений между сервисами, перечитываются при изменении файлов
+	tlsCreds, err := grpctls.NewCredentials(cfg.GRPCTLS)
+	if err != nil {
+		log.Fatalf("Failed to load TLS certificates: %v", err)
+	}
+	defer tlsCreds.Close()
+
+	// Получаем адрес auth-service из переменных окружения или используем localhost по умолчанию
+	authServiceHost := os.Getenv("AUTH_SERVICE_HOST")
+	if authServiceHost == "" {
+		authServiceHost = "localhost"
+	}
+	authServicePort := 9090
+	if portStr := os.Getenv("AUTH_SERVICE_PORT"); portStr != "" {
+		if port, err := strconv.Atoi(portStr); err == nil {
+			authServicePort = port
+		}
+	}
+
+	// Из auth-сервиса загружаются отозванные сессии: JWT, переданные напрямую, действительны до истечения
+	authConn, err := grpc.NewClient(
+		fmt.Sprintf("%s:%d", authServiceHost, authServicePort),
+		grpc.WithTransportCredentials(tlsCreds.ClientCredentials()),
+	)
+	if err != nil {
+		log.Fatalf("Failed to connect to auth service: %v", err)
+	}
+	defer authConn.Close()
+
+	revocations := revocation.NewList(pb.NewAuthServiceClient(authConn), cfg.TokenVerification, cfg.Timeout.Auth)
+	defer revocations.Close()
+
+	// Пользователь вызова определяется по удостоверению шлюза или JWT, а не по полям запроса
+	verifier, err := grpcauth.NewVerifier(cfg.ServiceAuth, cfg.GRPCTLS.MutualTLS(), tokens, revocations)
+	if err != nil {
+		log.Fatalf("Failed to configure service identity: %v", err)
+	}
+
+	server := grpc.NewServer(
+		grpc.Creds(tlsCreds.ServerCredentials()),
+		grpc.ChainUnaryInterceptor(requestmeta.UnaryServerInterceptor(), verifier.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(requestmeta.StreamServerInterceptor(), verifier.StreamServerInterceptor()),
+	)
 	pb.RegisterDocumentServiceServer(server, grpcServer)
 
 	// Запускаем сервер в горутине
@@ -77,6 +148,8 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down Document service...")
+	// Потоковые подписки живут до отмены, поэтому закрываем их до ожидания вызовов
+	hub.Close()
 	server.GracefulStop()
 	log.Println("Document service stopped")
 }
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/malaxitlmax/penfeel/pkg/oidc/oidctest"
+)
+
+// Локальный провайдер OpenID Connect для разработки входа через внешних провайдеров.
+// Страница входа не показывается: провайдер сразу возвращает пользователя с кодом
+// для пользователя, заданного флагами.
+func main() {
+	addr := flag.String("addr", ":9999", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9999", "issuer URL, must match OIDC_<ID>_ISSUER of the auth service")
+	clientID := flag.String("client-id", "penfeel", "client ID")
+	clientSecret := flag.String("client-secret", "penfeel-secret", "client secret, empty for a public client")
+	subject := flag.String("subject", "mock-user", "subject of the signed-in user")
+	email := flag.String("email", "user@example.com", "email of the signed-in user")
+	unverified := flag.Bool("unverified", false, "report the email as not verified")
+	name := flag.String("name", "Mock User", "name of the signed-in user")
+	username := flag.String("username", "mockuser", "preferred username of the signed-in user")
+	flag.Parse()
+
+	server, err := oidctest.NewServer(*issuer, *clientID, *clientSecret)
+	if err != nil {
+		log.Fatalf("Failed to create mock OIDC provider: %v", err)
+	}
+	server.SetUser(oidctest.User{
+		Subject:           *subject,
+		Email:             *email,
+		EmailVerified:     !*unverified,
+		Name:              *name,
+		PreferredUsername: *username,
+	})
+
+	log.Printf("Mock OIDC provider %s listening on %s, signing in as %s", *issuer, *addr, *email)
+	if err := http.ListenAndServe(*addr, server); err != nil {
+		log.Fatalf("Failed to serve: %v", err)
+	}
+}
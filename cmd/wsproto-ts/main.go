@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/malaxitlmax/penfeel/internal/api/wsproto"
+)
+
+// generator генерирует TypeScript-типы из Go-структур протокола
+type generator struct {
+	out bytes.Buffer
+	// Уже описанные структуры, имена интерфейсов сообщений и очередь на описание
+	declared     map[reflect.Type]bool
+	messageNames map[reflect.Type]string
+	pending      []reflect.Type
+}
+
+func main() {
+	output := flag.String("out", "client/src/types/protocol.ts", "output TypeScript file")
+	flag.Parse()
+
+	g := &generator{
+		declared:     make(map[reflect.Type]bool),
+		messageNames: make(map[reflect.Type]string),
+	}
+	g.printf("// Code generated by cmd/wsproto-ts from internal/api/wsproto. DO NOT EDIT.\n\n")
+	g.printf("export const MIN_PROTOCOL_VERSION = %d;\n", wsproto.MinProtocolVersion)
+	g.printf("export const MAX_PROTOCOL_VERSION = %d;\n\n", wsproto.MaxProtocolVersion)
+
+	codes := make([]string, 0, len(wsproto.ErrorCodes))
+	for _, code := range wsproto.ErrorCodes {
+		codes = append(codes, fmt.Sprintf("'%s'", code))
+	}
+	g.printf("export type ErrorCode = %s;\n\n", strings.Join(codes, " | "))
+
+	clientNames := g.messages(wsproto.ClientSchema)
+	serverNames := g.messages(wsproto.ServerSchema)
+
+	// Описываем вложенные структуры, на которые ссылаются сообщения
+	for len(g.pending) > 0 {
+		t := g.pending[0]
+		g.pending = g.pending[1:]
+		g.printf("export interface %s {\n", t.Name())
+		g.fields(t)
+		g.printf("}\n\n")
+	}
+
+	g.printf("export type ClientMessage =\n  | %s;\n\n", strings.Join(clientNames, "\n  | "))
+	g.printf("export type ServerMessage =\n  | %s;\n", strings.Join(serverNames, "\n  | "))
+
+	if err := os.WriteFile(*output, g.out.Bytes(), 0644); err != nil {
+		log.Fatalf("Failed to write %s: %v", *output, err)
+	}
+	log.Printf("Protocol types written to %s", *output)
+}
+
+// messages описывает сообщения протокола и возвращает имена их интерфейсов
+func (g *generator) messages(schema []wsproto.Schema) []string {
+	// Суффикс исключает конфликты с глобальными типами вроде Error
+	for _, entry := range schema {
+		t := reflect.TypeOf(entry.Message)
+		g.declared[t] = true
+		g.messageNames[t] = t.Name() + "Message"
+	}
+
+	names := make([]string, 0, len(schema))
+	for _, entry := range schema {
+		t := reflect.TypeOf(entry.Message)
+		name := g.messageNames[t]
+		names = append(names, name)
+
+		g.printf("export interface %s {\n", name)
+		g.printf("  type: '%s';\n", entry.Type)
+		g.fields(t)
+		g.printf("}\n\n")
+	}
+	return names
+}
+
+// fields описывает поля структуры, раскрывая встроенные структуры
+func (g *generator) fields(t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous {
+			g.fields(field.Type)
+			continue
+		}
+
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		// Поле type задаётся литералом в описании сообщения
+		if name == "type" && field.Type == reflect.TypeOf(wsproto.Type("")) {
+			continue
+		}
+
+		optional := ""
+		if strings.Contains(options, "omitempty") {
+			optional = "?"
+		}
+		g.printf("  %s%s: %s;\n", name, optional, g.typeName(field.Type))
+	}
+}
+
+// typeName возвращает TypeScript-тип для Go-типа
+func (g *generator) typeName(t reflect.Type) string {
+	if t == reflect.TypeOf(time.Time{}) {
+		return "string"
+	}
+	if t == reflect.TypeOf(wsproto.ErrorCode("")) {
+		return "ErrorCode"
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.typeName(t.Elem())
+	case reflect.Slice, reflect.Array:
+		return g.typeName(t.Elem()) + "[]"
+	case reflect.Map:
+		return fmt.Sprintf("Record<%s, %s>", g.typeName(t.Key()), g.typeName(t.Elem()))
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Struct:
+		if name, isMessage := g.messageNames[t]; isMessage {
+			return name
+		}
+		if !g.declared[t] {
+			g.declared[t] = true
+			g.pending = append(g.pending, t)
+		}
+		return t.Name()
+	default:
+		return "unknown"
+	}
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.out, format, args...)
+}
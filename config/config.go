@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,6 +13,24 @@ type Config struct {
 	JWT       JWTConfig
 	Server    ServerConfig
 	Migration MigrationConfig
+	WebSocket WebSocketConfig
+	CORS      CORSConfig
+	RateLimit RateLimitConfig
+	Timeout   TimeoutConfig
+	// Удостоверения, с которыми шлюз вызывает сервисы от имени пользователя
+	ServiceAuth ServiceAuthConfig
+	// Шифрование gRPC соединений между сервисами
+	GRPCTLS TLSConfig
+	// Проверка access токенов в шлюзе
+	TokenVerification TokenVerificationConfig
+	// Отправка писем пользователям
+	Mail MailConfig
+	// Восстановление доступа к учётной записи
+	Account AccountConfig
+	// Защита входа от подбора пароля
+	LoginProtection LoginProtectionConfig
+	// Вход через внешних провайдеров OpenID Connect
+	OIDC OIDCConfig
 }
 
 // DatabaseConfig конфигурация базы данных
@@ -24,12 +43,26 @@ type DatabaseConfig struct {
 	SSLMode  string
 }
 
+// DefaultJWTSecret значение JWT_SECRET по умолчанию. Оно опубликовано, поэтому сервисы
+// отказываются подписывать и проверять им access токены.
+const DefaultJWTSecret = "your-secret-key"
+
 // JWTConfig конфигурация для JWT токенов
 type JWTConfig struct {
 	Secret          string
 	ExpirationHours int
 	RefreshSecret   string
 	RefreshExpHours int
+	// Алгоритм подписи access токенов: HS256 (общий Secret), RS256 или EdDSA (ключи из KeysDir)
+	Algorithm string
+	KeysDir   string
+	// Как часто создавать новый ключ подписи
+	KeyRotationInterval time.Duration
+	// Через сколько новый ключ начинает подписывать токены; должно превышать JWKSCacheTTL
+	KeyActivationDelay time.Duration
+	// Откуда сервисы без доступа к ключам загружают открытые ключи; пустой URL — проверка секретом
+	JWKSURL      string
+	JWKSCacheTTL time.Duration
 }
 
 // ServerConfig конфигурация сервера
@@ -39,6 +72,11 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
+	// Время на завершение запросов, WebSocket сессий и сохранение правок при остановке
+	ShutdownTimeout time.Duration
+	// IP и сети прокси, которым шлюз доверяет заголовки X-Forwarded-For и X-Real-IP;
+	// без них IP клиента берётся из адреса соединения
+	TrustedProxies []string
 }
 
 // MigrationConfig конфигурация миграций
@@ -49,6 +87,208 @@ type MigrationConfig struct {
 	StatementTimeout int
 }
 
+// WebSocketConfig конфигурация WebSocket соединений с документами
+type WebSocketConfig struct {
+	HandshakeTimeout      time.Duration
+	TicketTTL             time.Duration
+	PresenceTTL           time.Duration
+	PresenceSweepInterval time.Duration
+	ResumeGracePeriod     time.Duration
+	HistorySize           int
+	// Правки сохраняются после паузы FlushIdleDelay, но не позднее FlushInterval с первой несохранённой
+	FlushInterval  time.Duration
+	FlushIdleDelay time.Duration
+	// Через сколько клиентам переподключаться после перезапуска шлюза
+	RestartRetryAfter time.Duration
+	// Дедлайн записи сообщения клиенту: медленный клиент не задерживает рассылку остальным
+	WriteTimeout time.Duration
+}
+
+// CORSConfig конфигурация разрешённых источников для CORS и WebSocket
+type CORSConfig struct {
+	AllowedOrigins []string
+}
+
+// RateLimitConfig лимиты запросов к шлюзу (token bucket: событий в секунду и запас).
+// Неположительная частота отключает соответствующий лимит.
+type RateLimitConfig struct {
+	// REST запросы на пользователя, для анонимных запросов на IP
+	RESTRate  float64
+	RESTBurst int
+	// Все WebSocket сообщения одного соединения
+	WSMessageRate  float64
+	WSMessageBurst int
+	// Сохранения документа (document_update) одного пользователя по всем соединениям
+	WSUpdateRate  float64
+	WSUpdateBurst int
+	// Обновления курсора и выделения одного соединения
+	WSPresenceRate  float64
+	WSPresenceBurst int
+	// Число превышений лимита за окно, после которого соединение разрывается
+	WSMaxViolations   int
+	WSViolationWindow time.Duration
+}
+
+// TimeoutConfig дедлайны вызовов сервисов из шлюза.
+// Неположительное значение отключает дедлайн, вызов ограничен только отменой запроса.
+type TimeoutConfig struct {
+	// Маршруты без собственного дедлайна
+	Default time.Duration
+	// Регистрация, вход и проверка токена
+	Auth time.Duration
+	// Чтение документов и блокировок
+	DocumentRead time.Duration
+	// Создание, изменение, удаление и блокировка документов
+	DocumentWrite time.Duration
+	// Вызовы сервисов из WebSocket сессии
+	WebSocketCall time.Duration
+	// Сохранение отложенных правок вне запроса: по таймеру и при закрытии сессии
+	BackgroundSave time.Duration
+}
+
+// DefaultServiceIdentitySecret значение SERVICE_IDENTITY_SECRET по умолчанию. Оно опубликовано,
+// поэтому сервисы принимают его только за mutual TLS.
+const DefaultServiceIdentitySecret = "your-service-secret-key"
+
+// ServiceAuthConfig подпись удостоверений сервисов, действующих от имени пользователя.
+// Если заданы файлы ключей, удостоверения подписываются Ed25519: закрытый ключ нужен только шлюзу,
+// открытый — document-сервису. Иначе используется общий Secret (HS256), который должен совпадать у обоих.
+type ServiceAuthConfig struct {
+	Secret         string
+	PrivateKeyFile string
+	PublicKeyFile  string
+	TTL            time.Duration
+}
+
+// TLSConfig TLS для gRPC соединений между сервисами.
+// Один сертификат служит сервису и сервером, и клиентом при вызовах других сервисов.
+type TLSConfig struct {
+	Enabled  bool
+	CertFile string
+	KeyFile  string
+	// Сертификат CA, которым проверяются сертификаты других сервисов
+	CAFile string
+	// Сервер отклоняет клиентов без сертификата, подписанного CA (mutual TLS)
+	RequireClientCert bool
+	// Как часто проверять изменения файлов сертификатов; неположительное значение отключает перезагрузку
+	ReloadInterval time.Duration
+	// CommonName сертификатов клиентов, которым доступны административные методы auth-сервиса
+	AdminClients []string
+}
+
+// MutualTLS сообщает, что сервер принимает только клиентов с сертификатом, подписанным CA
+func (c TLSConfig) MutualTLS() bool {
+	return c.Enabled && c.RequireClientCert
+}
+
+// TokenVerificationConfig проверка access токенов в шлюзе без вызова auth-сервиса на каждый запрос.
+// Подпись проверяется по открытым ключам auth-сервиса, поэтому локальная проверка
+// работает только при асимметричной подписи (JWT.Algorithm RS256 или EdDSA).
+type TokenVerificationConfig struct {
+	Local bool
+	// Сколько хранить данные пользователя, полученные от auth-сервиса, и сколько пользователей хранить
+	UserCacheTTL  time.Duration
+	UserCacheSize int
+	// Как часто загружать отозванные сессии: столько токены завершённой сессии ещё принимаются
+	RevocationSyncInterval time.Duration
+	// Если список отозванных сессий не удаётся обновить дольше, токены снова проверяются в auth-сервисе
+	RevocationMaxStaleness time.Duration
+}
+
+// MailConfig отправка писем пользователям
+type MailConfig struct {
+	// smtp, file (письма сохраняются в Dir) или log (письма выводятся в лог)
+	Driver string
+	// Отправитель, например "PenFeel <no-reply@example.com>"
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	Dir          string
+	// Дедлайн отправки одного письма
+	SendTimeout time.Duration
+}
+
+// Что запрещено пользователю до подтверждения email
+const (
+	// EmailVerificationOptional подтверждение ничего не ограничивает
+	EmailVerificationOptional = "none"
+	// EmailVerificationLogin запрещён вход
+	EmailVerificationLogin = "login"
+	// EmailVerificationDocuments запрещено создание документов
+	EmailVerificationDocuments = "documents"
+)
+
+// AccountConfig подтверждение email и восстановление доступа к учётной записи
+type AccountConfig struct {
+	// Адрес клиентского приложения, на страницы которого ведут ссылки из писем
+	AppURL string
+	// Сколько действует ссылка сброса пароля
+	PasswordResetTTL time.Duration
+	// Сколько действует ссылка подтверждения email
+	EmailVerificationTTL time.Duration
+	// Что запрещено до подтверждения email: none, login или documents
+	EmailVerificationRequired string
+	// Название сервиса в приложении-аутентификаторе
+	TOTPIssuer string
+	// Сколько после проверки пароля ждать код двухфакторной аутентификации
+	LoginChallengeTTL time.Duration
+	// Срок действия персонального токена доступа, если он не указан при создании, и наибольший допустимый срок
+	PersonalTokenDefaultTTL time.Duration
+	PersonalTokenMaxTTL     time.Duration
+	// Сколько действующих персональных токенов может быть у пользователя
+	PersonalTokenLimit int
+	// Наибольший размер аватара в байтах
+	AvatarMaxSize int
+}
+
+// LoginProtectionConfig защита входа от подбора пароля. Неудачные попытки считаются
+// отдельно для email и для IP: после FreeAttempts каждая следующая попытка откладывается
+// на BackoffBase, удваиваясь до BackoffMax, а после MaxAttempts вход блокируется на LockoutDuration.
+type LoginProtectionConfig struct {
+	// Неудачные попытки без задержки
+	FreeAttempts int
+	// Неудачные попытки до блокировки учётной записи
+	AccountMaxAttempts int
+	// Неудачные попытки с одного IP до его блокировки; больше, чем для учётной записи,
+	// потому что за одним адресом могут быть несколько пользователей
+	IPMaxAttempts int
+	BackoffBase   time.Duration
+	BackoffMax    time.Duration
+	// Сколько действует блокировка
+	LockoutDuration time.Duration
+	// Через сколько после последней неудачной попытки счётчик сбрасывается
+	AttemptWindow time.Duration
+	// Сколько действует ссылка разблокировки из письма о блокировке
+	UnlockTTL time.Duration
+}
+
+// OIDCConfig вход через внешних провайдеров OpenID Connect
+type OIDCConfig struct {
+	Providers []OIDCProviderConfig
+	// Страница клиентского приложения, на которую провайдер возвращает пользователя с кодом авторизации.
+	// Должна быть зарегистрирована у каждого провайдера.
+	RedirectURL string
+	// Сколько действует начатый вход через провайдера
+	StateTTL time.Duration
+	// Дедлайн запросов к провайдеру
+	HTTPTimeout time.Duration
+}
+
+// OIDCProviderConfig провайдер OpenID Connect, настроенный переменными OIDC_<ID>_*
+type OIDCProviderConfig struct {
+	// Идентификатор провайдера в адресах API, например google
+	ID string
+	// Название для кнопки входа
+	Name string
+	// Issuer провайдера; параметры загружаются из <Issuer>/.well-known/openid-configuration
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
 // LoadConfig загружает конфигурацию из переменных окружения
 func LoadConfig() *Config {
 	return &Config{
@@ -61,17 +301,25 @@ func LoadConfig() *Config {
 			SSLMode:  getEnv("DB_SSLMODE", "disable"),
 		},
 		JWT: JWTConfig{
-			Secret:          getEnv("JWT_SECRET", "your-secret-key"),
-			ExpirationHours: getEnvAsInt("JWT_EXPIRATION_HOURS", 24),
-			RefreshSecret:   getEnv("JWT_REFRESH_SECRET", "your-refresh-secret-key"),
-			RefreshExpHours: getEnvAsInt("JWT_REFRESH_EXPIRATION_HOURS", 168), // 7 days
+			Secret:              getEnv("JWT_SECRET", DefaultJWTSecret),
+			ExpirationHours:     getEnvAsInt("JWT_EXPIRATION_HOURS", 24),
+			RefreshSecret:       getEnv("JWT_REFRESH_SECRET", "your-refresh-secret-key"),
+			RefreshExpHours:     getEnvAsInt("JWT_REFRESH_EXPIRATION_HOURS", 168), // 7 days
+			Algorithm:           getEnv("JWT_ALGORITHM", "HS256"),
+			KeysDir:             getEnv("JWT_KEYS_DIR", "./keys"),
+			KeyRotationInterval: getEnvAsDuration("JWT_KEY_ROTATION_INTERVAL", 30*24*time.Hour),
+			KeyActivationDelay:  getEnvAsDuration("JWT_KEY_ACTIVATION_DELAY", 10*time.Minute),
+			JWKSURL:             getEnv("JWT_JWKS_URL", ""),
+			JWKSCacheTTL:        getEnvAsDuration("JWT_JWKS_CACHE_TTL", 5*time.Minute),
 		},
 		Server: ServerConfig{
-			Port:         getEnvAsInt("SERVER_PORT", 8080),
-			GRPCPort:     getEnvAsInt("GRPC_PORT", 9090),
-			ReadTimeout:  time.Duration(getEnvAsInt("SERVER_READ_TIMEOUT", 10)) * time.Second,
-			WriteTimeout: time.Duration(getEnvAsInt("SERVER_WRITE_TIMEOUT", 10)) * time.Second,
-			IdleTimeout:  time.Duration(getEnvAsInt("SERVER_IDLE_TIMEOUT", 60)) * time.Second,
+			Port:            getEnvAsInt("SERVER_PORT", 8080),
+			GRPCPort:        getEnvAsInt("GRPC_PORT", 9090),
+			ReadTimeout:     time.Duration(getEnvAsInt("SERVER_READ_TIMEOUT", 10)) * time.Second,
+			WriteTimeout:    time.Duration(getEnvAsInt("SERVER_WRITE_TIMEOUT", 10)) * time.Second,
+			IdleTimeout:     time.Duration(getEnvAsInt("SERVER_IDLE_TIMEOUT", 60)) * time.Second,
+			ShutdownTimeout: time.Duration(getEnvAsInt("SERVER_SHUTDOWN_TIMEOUT", 15)) * time.Second,
+			TrustedProxies:  getEnvAsSlice("TRUSTED_PROXIES", nil),
 		},
 		Migration: MigrationConfig{
 			Path:             getEnv("MIGRATION_PATH", "./migrations"),
@@ -79,9 +327,123 @@ func LoadConfig() *Config {
 			LockTimeout:      getEnvAsInt("MIGRATION_LOCK_TIMEOUT", 5000),
 			StatementTimeout: getEnvAsInt("MIGRATION_STATEMENT_TIMEOUT", 60000),
 		},
+		WebSocket: WebSocketConfig{
+			HandshakeTimeout:      time.Duration(getEnvAsInt("WS_HANDSHAKE_TIMEOUT", 10)) * time.Second,
+			TicketTTL:             time.Duration(getEnvAsInt("WS_TICKET_TTL", 30)) * time.Second,
+			PresenceTTL:           time.Duration(getEnvAsInt("WS_PRESENCE_TTL", 60)) * time.Second,
+			PresenceSweepInterval: time.Duration(getEnvAsInt("WS_PRESENCE_SWEEP_INTERVAL", 10)) * time.Second,
+			ResumeGracePeriod:     time.Duration(getEnvAsInt("WS_RESUME_GRACE_PERIOD", 30)) * time.Second,
+			HistorySize:           getEnvAsInt("WS_HISTORY_SIZE", 256),
+			FlushInterval:         time.Duration(getEnvAsInt("WS_FLUSH_INTERVAL", 5)) * time.Second,
+			FlushIdleDelay:        time.Duration(getEnvAsInt("WS_FLUSH_IDLE_DELAY", 1)) * time.Second,
+			RestartRetryAfter:     time.Duration(getEnvAsInt("WS_RESTART_RETRY_AFTER", 5)) * time.Second,
+			WriteTimeout:          time.Duration(getEnvAsInt("WS_WRITE_TIMEOUT", 10)) * time.Second,
+		},
+		CORS: CORSConfig{
+			AllowedOrigins: getEnvAsSlice("CORS_ALLOWED_ORIGINS", nil),
+		},
+		RateLimit: RateLimitConfig{
+			RESTRate:          getEnvAsFloat("RATE_LIMIT_REST_RATE", 10),
+			RESTBurst:         getEnvAsInt("RATE_LIMIT_REST_BURST", 30),
+			WSMessageRate:     getEnvAsFloat("RATE_LIMIT_WS_MESSAGE_RATE", 30),
+			WSMessageBurst:    getEnvAsInt("RATE_LIMIT_WS_MESSAGE_BURST", 60),
+			WSUpdateRate:      getEnvAsFloat("RATE_LIMIT_WS_UPDATE_RATE", 5),
+			WSUpdateBurst:     getEnvAsInt("RATE_LIMIT_WS_UPDATE_BURST", 10),
+			WSPresenceRate:    getEnvAsFloat("RATE_LIMIT_WS_PRESENCE_RATE", 20),
+			WSPresenceBurst:   getEnvAsInt("RATE_LIMIT_WS_PRESENCE_BURST", 40),
+			WSMaxViolations:   getEnvAsInt("RATE_LIMIT_WS_MAX_VIOLATIONS", 20),
+			WSViolationWindow: time.Duration(getEnvAsInt("RATE_LIMIT_WS_VIOLATION_WINDOW", 10)) * time.Second,
+		},
+		Timeout: TimeoutConfig{
+			Default:        getEnvAsDuration("REQUEST_TIMEOUT", 10*time.Second),
+			Auth:           getEnvAsDuration("REQUEST_TIMEOUT_AUTH", 5*time.Second),
+			DocumentRead:   getEnvAsDuration("REQUEST_TIMEOUT_DOCUMENT_READ", 5*time.Second),
+			DocumentWrite:  getEnvAsDuration("REQUEST_TIMEOUT_DOCUMENT_WRITE", 10*time.Second),
+			WebSocketCall:  getEnvAsDuration("REQUEST_TIMEOUT_WS_CALL", 5*time.Second),
+			BackgroundSave: getEnvAsDuration("REQUEST_TIMEOUT_BACKGROUND_SAVE", 10*time.Second),
+		},
+		ServiceAuth: ServiceAuthConfig{
+			Secret:         getEnv("SERVICE_IDENTITY_SECRET", DefaultServiceIdentitySecret),
+			PrivateKeyFile: getEnv("SERVICE_IDENTITY_PRIVATE_KEY_FILE", ""),
+			PublicKeyFile:  getEnv("SERVICE_IDENTITY_PUBLIC_KEY_FILE", ""),
+			TTL:            getEnvAsDuration("SERVICE_IDENTITY_TTL", time.Minute),
+		},
+		GRPCTLS: TLSConfig{
+			Enabled:           getEnvAsBool("GRPC_TLS_ENABLED", false),
+			CertFile:          getEnv("GRPC_TLS_CERT_FILE", ""),
+			KeyFile:           getEnv("GRPC_TLS_KEY_FILE", ""),
+			CAFile:            getEnv("GRPC_TLS_CA_FILE", ""),
+			RequireClientCert: getEnvAsBool("GRPC_TLS_REQUIRE_CLIENT_CERT", true),
+			ReloadInterval:    getEnvAsDuration("GRPC_TLS_RELOAD_INTERVAL", 30*time.Second),
+			AdminClients:      getEnvAsSlice("GRPC_TLS_ADMIN_CLIENTS", nil),
+		},
+		TokenVerification: TokenVerificationConfig{
+			Local:                  getEnvAsBool("AUTH_LOCAL_VERIFICATION", true),
+			UserCacheTTL:           getEnvAsDuration("AUTH_USER_CACHE_TTL", time.Minute),
+			UserCacheSize:          getEnvAsInt("AUTH_USER_CACHE_SIZE", 10000),
+			RevocationSyncInterval: getEnvAsDuration("AUTH_REVOCATION_SYNC_INTERVAL", 5*time.Second),
+			RevocationMaxStaleness: getEnvAsDuration("AUTH_REVOCATION_MAX_STALENESS", 30*time.Second),
+		},
+		Mail: MailConfig{
+			Driver:       getEnv("MAIL_DRIVER", "log"),
+			From:         getEnv("MAIL_FROM", "PenFeel <no-reply@penfeel.local>"),
+			SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+			SMTPPort:     getEnvAsInt("SMTP_PORT", 587),
+			SMTPUsername: getEnv("SMTP_USERNAME", ""),
+			SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+			Dir:          getEnv("MAIL_DIR", "./mail"),
+			SendTimeout:  getEnvAsDuration("MAIL_SEND_TIMEOUT", 10*time.Second),
+		},
+		Account: AccountConfig{
+			AppURL:                    getEnv("APP_URL", "http://localhost:5173"),
+			PasswordResetTTL:          getEnvAsDuration("PASSWORD_RESET_TTL", time.Hour),
+			EmailVerificationTTL:      getEnvAsDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+			EmailVerificationRequired: getEnv("EMAIL_VERIFICATION_REQUIRED", EmailVerificationOptional),
+			TOTPIssuer:                getEnv("TOTP_ISSUER", "PenFeel"),
+			LoginChallengeTTL:         getEnvAsDuration("LOGIN_CHALLENGE_TTL", 5*time.Minute),
+			PersonalTokenDefaultTTL:   getEnvAsDuration("PERSONAL_TOKEN_DEFAULT_TTL", 90*24*time.Hour),
+			PersonalTokenMaxTTL:       getEnvAsDuration("PERSONAL_TOKEN_MAX_TTL", 365*24*time.Hour),
+			PersonalTokenLimit:        getEnvAsInt("PERSONAL_TOKEN_LIMIT", 50),
+			AvatarMaxSize:             getEnvAsInt("AVATAR_MAX_SIZE", 1<<20),
+		},
+		LoginProtection: LoginProtectionConfig{
+			FreeAttempts:       getEnvAsInt("LOGIN_FREE_ATTEMPTS", 3),
+			AccountMaxAttempts: getEnvAsInt("LOGIN_ACCOUNT_MAX_ATTEMPTS", 10),
+			IPMaxAttempts:      getEnvAsInt("LOGIN_IP_MAX_ATTEMPTS", 50),
+			BackoffBase:        getEnvAsDuration("LOGIN_BACKOFF_BASE", time.Second),
+			BackoffMax:         getEnvAsDuration("LOGIN_BACKOFF_MAX", 5*time.Minute),
+			LockoutDuration:    getEnvAsDuration("LOGIN_LOCKOUT_DURATION", 30*time.Minute),
+			AttemptWindow:      getEnvAsDuration("LOGIN_ATTEMPT_WINDOW", time.Hour),
+			UnlockTTL:          getEnvAsDuration("ACCOUNT_UNLOCK_TTL", 24*time.Hour),
+		},
+		OIDC: OIDCConfig{
+			Providers:   loadOIDCProviders(),
+			RedirectURL: getEnv("OIDC_REDIRECT_URL", getEnv("APP_URL", "http://localhost:5173")+"/auth/callback"),
+			StateTTL:    getEnvAsDuration("OIDC_STATE_TTL", 10*time.Minute),
+			HTTPTimeout: getEnvAsDuration("OIDC_HTTP_TIMEOUT", 10*time.Second),
+		},
 	}
 }
 
+// loadOIDCProviders загружает провайдеров из OIDC_PROVIDERS, например "google,corp".
+// Провайдер corp настраивается переменными OIDC_CORP_ISSUER, OIDC_CORP_CLIENT_ID и т.д.
+func loadOIDCProviders() []OIDCProviderConfig {
+	var providers []OIDCProviderConfig
+	for _, id := range getEnvAsSlice("OIDC_PROVIDERS", nil) {
+		id = strings.ToLower(id)
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(id, "-", "_")) + "_"
+		providers = append(providers, OIDCProviderConfig{
+			ID:           id,
+			Name:         getEnv(prefix+"NAME", id),
+			Issuer:       getEnv(prefix+"ISSUER", ""),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			Scopes:       getEnvAsSlice(prefix+"SCOPES", []string{"openid", "email", "profile"}),
+		})
+	}
+	return providers
+}
+
 // Helper функции для работы с переменными окружения
 func getEnv(key, defaultValue string) string {
 	if value, exists := os.LookupEnv(key); exists {
@@ -99,6 +461,29 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if valueStr, exists := os.LookupEnv(key); exists {
+		if value, err := strconv.ParseFloat(valueStr, 64); err == nil {
+			return value
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsDuration принимает длительность в формате time.ParseDuration ("500ms", "5s")
+// или целое число секунд, как остальные таймауты конфигурации
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if valueStr, exists := os.LookupEnv(key); exists {
+		if value, err := time.ParseDuration(valueStr); err == nil {
+			return value
+		}
+		if seconds, err := strconv.Atoi(valueStr); err == nil {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return defaultValue
+}
+
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if valueStr, exists := os.LookupEnv(key); exists {
 		if value, err := strconv.ParseBool(valueStr); err == nil {
@@ -107,3 +492,16 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 	}
 	return defaultValue
 }
+
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	if valueStr, exists := os.LookupEnv(key); exists {
+		var values []string
+		for _, value := range strings.Split(valueStr, ",") {
+			if value = strings.TrimSpace(value); value != "" {
+				values = append(values, value)
+			}
+		}
+		return values
+	}
+	return defaultValue
+}
@@ -0,0 +1,70 @@
+package grpcerr
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/malaxitlmax/penfeel/pkg/apperrors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statusClientClosedRequest клиент отменил запрос до получения ответа
+const statusClientClosedRequest = 499
+
+// HTTPStatus возвращает HTTP статус для кода gRPC
+func HTTPStatus(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return statusClientClosedRequest
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Respond отвечает клиенту ошибкой вызова gRPC сервиса.
+// message описывает неудавшееся действие, подробности и причина берутся из статуса ошибки.
+func Respond(c *gin.Context, err error, message string) {
+	st := status.Convert(err)
+	if st.Code() == codes.Unavailable {
+		message = "Service is unavailable - please try again later"
+	}
+
+	body := gin.H{
+		"error":   message,
+		"details": st.Message(),
+	}
+	if reason := apperrors.Reason(err); reason != "" {
+		body["reason"] = reason
+	}
+	if fields := apperrors.FieldViolations(err); len(fields) > 0 {
+		body["fields"] = fields
+	}
+	if retryAfter := apperrors.RetryAfter(err); retryAfter > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+
+	c.JSON(HTTPStatus(st.Code()), body)
+}
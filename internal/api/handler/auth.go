@@ -2,21 +2,91 @@ package handler
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	pb "github.com/malaxitlmax/penfeel/api/proto"
-	"golang.org/x/net/context"
+	"github.com/malaxitlmax/penfeel/internal/api/grpcerr"
+	"github.com/malaxitlmax/penfeel/internal/api/service"
 )
 
+// oidcBindingCookie cookie с привязкой входа через провайдера к браузеру, который его начал.
+// Она доступна только маршрутам входа через провайдера и не видна скриптам.
+const (
+	oidcBindingCookie     = "oidc_binding"
+	oidcBindingCookiePath = "/api/v1/auth/oidc"
+)
+
+// PasswordResetRequest структура запроса ссылки для сброса пароля
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest структура запроса на установку нового пароля
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// VerifyEmailRequest структура запроса подтверждения email
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// ResendVerificationRequest структура запроса повторной отправки письма подтверждения
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// CompleteLoginRequest структура запроса на завершение входа кодом двухфакторной аутентификации
+type CompleteLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+// TwoFactorCodeRequest структура запроса с кодом TOTP
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// DisableTwoFactorRequest структура запроса на выключение двухфакторной аутентификации
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+// UnlockAccountRequest структура запроса на снятие блокировки входа
+type UnlockAccountRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// CompleteOIDCLoginRequest структура запроса на завершение входа через провайдера OpenID Connect
+// с параметрами, с которыми провайдер вернул пользователя
+type CompleteOIDCLoginRequest struct {
+	State string `json:"state" binding:"required"`
+	Code  string `json:"code" binding:"required"`
+}
+
+// CreatePersonalTokenRequest структура запроса на создание персонального токена доступа
+type CreatePersonalTokenRequest struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1"`
+	// Срок действия в днях; если не указан, действует срок по умолчанию
+	ExpiresInDays int32 `json:"expires_in_days" binding:"min=0"`
+}
+
 // AuthHandler структура обработчика авторизации
 type AuthHandler struct {
-	authClient pb.AuthServiceClient
+	authClient    pb.AuthServiceClient
+	tokenVerifier *service.TokenVerifier
 }
 
-// NewAuthHandler создает новый обработчик авторизации
-func NewAuthHandler(authClient pb.AuthServiceClient) *AuthHandler {
+// NewAuthHandler создает новый обработчик авторизации.
+// После подтверждения email и изменения двухфакторной аутентификации данные пользователя удаляются из кэша tokenVerifier.
+func NewAuthHandler(authClient pb.AuthServiceClient, tokenVerifier *service.TokenVerifier) *AuthHandler {
 	return &AuthHandler{
-		authClient: authClient,
+		authClient:    authClient,
+		tokenVerifier: tokenVerifier,
 	}
 }
 
@@ -33,6 +103,11 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// RefreshRequest структура запроса на обмен refresh токена
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
 // TokenRequest структура запроса на валидацию токена
 type TokenRequest struct {
 	Token string `json:"token" binding:"required"`
@@ -47,19 +122,14 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// Отправляем запрос к auth-сервису через gRPC
-	res, err := h.authClient.Register(context.Background(), &pb.RegisterRequest{
+	res, err := h.authClient.Register(c.Request.Context(), &pb.RegisterRequest{
 		Username: req.Username,
 		Email:    req.Email,
 		Password: req.Password,
 	})
 
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	if !res.Success {
-		c.JSON(http.StatusBadRequest, gin.H{"error": res.Error})
+		grpcerr.Respond(c, err, "Registration failed")
 		return
 	}
 
@@ -78,18 +148,49 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Отправляем запрос к auth-сервису через gRPC
-	res, err := h.authClient.Login(context.Background(), &pb.LoginRequest{
+	res, err := h.authClient.Login(c.Request.Context(), &pb.LoginRequest{
 		Email:    req.Email,
 		Password: req.Password,
 	})
 
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+		grpcerr.Respond(c, err, "Login failed")
+		return
+	}
+
+	respondLogin(c, res)
+}
+
+// CompleteLogin завершает вход кодом TOTP или кодом восстановления
+func (h *AuthHandler) CompleteLogin(c *gin.Context) {
+	var req CompleteLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.authClient.CompleteLogin(c.Request.Context(), &pb.CompleteLoginRequest{
+		ChallengeToken: req.ChallengeToken,
+		Code:           req.Code,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Login failed")
 		return
 	}
 
-	if !res.Success {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": res.Error})
+	respondLogin(c, res)
+}
+
+// respondLogin отвечает токенами сессии или, если нужен код двухфакторной аутентификации,
+// токеном второго шага входа
+func respondLogin(c *gin.Context, res *pb.LoginResponse) {
+	if res.TwoFactorRequired {
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge_token":     res.ChallengeToken,
+			"expires_at":          res.ChallengeExpiresAt,
+		})
 		return
 	}
 
@@ -97,13 +198,184 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		"token":         res.Token,
 		"refresh_token": res.RefreshToken,
 		"user": gin.H{
-			"id":       res.User.Id,
-			"username": res.User.Username,
-			"email":    res.User.Email,
+			"id":             res.User.Id,
+			"username":       res.User.Username,
+			"email":          res.User.Email,
+			"email_verified": res.User.EmailVerified,
 		},
 	})
 }
 
+// SetupTwoFactor создаёт секрет TOTP для подключения приложения-аутентификатора
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	res, err := h.authClient.SetupTOTP(c.Request.Context(), &pb.SetupTOTPRequest{
+		Token: c.GetString("token"),
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Two-factor setup failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"secret":      res.Secret,
+		"otpauth_uri": res.OtpauthUri,
+	})
+}
+
+// ConfirmTwoFactor включает двухфакторную аутентификацию кодом из приложения.
+// Коды восстановления возвращаются только в этом ответе.
+func (h *AuthHandler) ConfirmTwoFactor(c *gin.Context) {
+	var req TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.authClient.ConfirmTOTP(c.Request.Context(), &pb.ConfirmTOTPRequest{
+		Token: c.GetString("token"),
+		Code:  req.Code,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Two-factor confirmation failed")
+		return
+	}
+	h.tokenVerifier.ForgetUser(c.GetString("user_id"))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":        true,
+		"recovery_codes": res.RecoveryCodes,
+	})
+}
+
+// DisableTwoFactor выключает двухфакторную аутентификацию
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	var req DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.authClient.DisableTOTP(c.Request.Context(), &pb.DisableTOTPRequest{
+		Token:    c.GetString("token"),
+		Password: req.Password,
+		Code:     req.Code,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to disable two-factor authentication")
+		return
+	}
+	h.tokenVerifier.ForgetUser(c.GetString("user_id"))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// Refresh обменивает refresh токен на новую пару токенов.
+// Прежний refresh токен после обмена недействителен.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Отправляем запрос к auth-сервису через gRPC
+	res, err := h.authClient.RefreshToken(c.Request.Context(), &pb.RefreshTokenRequest{
+		RefreshToken: req.RefreshToken,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Token refresh failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":         res.Token,
+		"refresh_token": res.RefreshToken,
+		"user": gin.H{
+			"id":             res.User.Id,
+			"username":       res.User.Username,
+			"email":          res.User.Email,
+			"email_verified": res.User.EmailVerified,
+		},
+	})
+}
+
+// Logout завершает сессию токена, с которым выполнен запрос
+func (h *AuthHandler) Logout(c *gin.Context) {
+	_, err := h.authClient.Logout(c.Request.Context(), &pb.LogoutRequest{
+		Token: c.GetString("token"),
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Logout failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Logged out",
+	})
+}
+
+// LogoutAll завершает все сессии пользователя, включая текущую
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	_, err := h.authClient.LogoutAll(c.Request.Context(), &pb.LogoutAllRequest{
+		Token: c.GetString("token"),
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Logout failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Logged out of all sessions",
+	})
+}
+
+// ListSessions возвращает действующие сессии пользователя
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	res, err := h.authClient.ListSessions(c.Request.Context(), &pb.ListSessionsRequest{
+		Token: c.GetString("token"),
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to fetch sessions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"sessions": res.Sessions,
+	})
+}
+
+// RevokeSession завершает сессию пользователя по ID
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	_, err := h.authClient.RevokeSession(c.Request.Context(), &pb.RevokeSessionRequest{
+		Token:     c.GetString("token"),
+		SessionId: c.Param("id"),
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to revoke session")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Session revoked",
+	})
+}
+
 // ValidateToken обрабатывает запрос на валидацию токена
 func (h *AuthHandler) ValidateToken(c *gin.Context) {
 	var req TokenRequest
@@ -113,26 +385,311 @@ func (h *AuthHandler) ValidateToken(c *gin.Context) {
 	}
 
 	// Отправляем запрос к auth-сервису через gRPC
-	res, err := h.authClient.ValidateToken(context.Background(), &pb.ValidateTokenRequest{
+	res, err := h.authClient.ValidateToken(c.Request.Context(), &pb.ValidateTokenRequest{
 		Token: req.Token,
 	})
 
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		grpcerr.Respond(c, err, "Invalid token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"valid": true,
+		"user": gin.H{
+			"id":             res.User.Id,
+			"username":       res.User.Username,
+			"email":          res.User.Email,
+			"email_verified": res.User.EmailVerified,
+		},
+	})
+}
+
+// JWKS публикует открытые ключи подписи access токенов для сервисов, проверяющих токены локально
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	res, err := h.authClient.GetJWKS(c.Request.Context(), &pb.GetJWKSRequest{})
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to fetch signing keys")
+		return
+	}
+
+	// Новый ключ публикуется заранее, поэтому кэширование не мешает ротации
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, service.JWKSFromProto(res.Keys))
+}
+
+// RequestPasswordReset отправляет ссылку для сброса пароля.
+// Ответ одинаков для зарегистрированных и незарегистрированных email.
+func (h *AuthHandler) RequestPasswordReset(c *gin.Context) {
+	var req PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if !res.Valid {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": res.Error})
+	_, err := h.authClient.RequestPasswordReset(c.Request.Context(), &pb.RequestPasswordResetRequest{
+		Email: req.Email,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Password reset request failed")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"valid": true,
+		"success": true,
+		"message": "If an account with this email exists, a password reset link has been sent",
+	})
+}
+
+// ResetPassword устанавливает новый пароль по токену из письма
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.authClient.ResetPassword(c.Request.Context(), &pb.ResetPasswordRequest{
+		Token:       req.Token,
+		NewPassword: req.Password,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Password reset failed")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Password has been reset, please sign in again",
+	})
+}
+
+// VerifyEmail подтверждает email по токену из письма
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.authClient.VerifyEmail(c.Request.Context(), &pb.VerifyEmailRequest{
+		Token: req.Token,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Email verification failed")
+		return
+	}
+	h.tokenVerifier.ForgetUser(res.User.Id)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
 		"user": gin.H{
-			"id":       res.User.Id,
-			"username": res.User.Username,
-			"email":    res.User.Email,
+			"id":             res.User.Id,
+			"username":       res.User.Username,
+			"email":          res.User.Email,
+			"email_verified": res.User.EmailVerified,
 		},
 	})
 }
+
+// ResendVerification повторно отправляет письмо подтверждения email.
+// Ответ одинаков для зарегистрированных и незарегистрированных email.
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.authClient.ResendVerification(c.Request.Context(), &pb.ResendVerificationRequest{
+		Email: req.Email,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to resend verification email")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "If an account with this email awaits verification, a new link has been sent",
+	})
+}
+
+// UnlockAccount снимает блокировку входа по токену из письма о блокировке
+func (h *AuthHandler) UnlockAccount(c *gin.Context) {
+	var req UnlockAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.authClient.UnlockAccount(c.Request.Context(), &pb.UnlockAccountRequest{
+		Token: req.Token,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to unlock account")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Account unlocked, you can sign in again",
+	})
+}
+
+// ListOIDCProviders возвращает провайдеров OpenID Connect для кнопок входа
+func (h *AuthHandler) ListOIDCProviders(c *gin.Context) {
+	res, err := h.authClient.ListOIDCProviders(c.Request.Context(), &pb.ListOIDCProvidersRequest{})
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to list identity providers")
+		return
+	}
+
+	providers := make([]gin.H, 0, len(res.Providers))
+	for _, provider := range res.Providers {
+		providers = append(providers, gin.H{
+			"id":   provider.Id,
+			"name": provider.Name,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"providers": providers,
+	})
+}
+
+// StartOIDCLogin начинает вход через провайдера OpenID Connect.
+// Клиент перенаправляет пользователя по authorization_url. Привязка входа к браузеру
+// сохраняется в cookie: без неё CompleteOIDCLogin не примет state.
+func (h *AuthHandler) StartOIDCLogin(c *gin.Context) {
+	res, err := h.authClient.StartOIDCLogin(c.Request.Context(), &pb.StartOIDCLoginRequest{
+		Provider: c.Param("provider"),
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to start sign-in")
+		return
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, res.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start sign-in"})
+		return
+	}
+	setOIDCBindingCookie(c, res.Binding, int(time.Until(expiresAt).Seconds()))
+
+	c.JSON(http.StatusOK, gin.H{
+		"authorization_url": res.AuthorizationUrl,
+		"expires_at":        res.ExpiresAt,
+	})
+}
+
+// CompleteOIDCLogin завершает вход через провайдера OpenID Connect
+func (h *AuthHandler) CompleteOIDCLogin(c *gin.Context) {
+	var req CompleteOIDCLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Без cookie привязка пустая, и auth-сервис отклонит state
+	binding, _ := c.Cookie(oidcBindingCookie)
+
+	res, err := h.authClient.CompleteOIDCLogin(c.Request.Context(), &pb.CompleteOIDCLoginRequest{
+		State:   req.State,
+		Code:    req.Code,
+		Binding: binding,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Login failed")
+		return
+	}
+
+	// Начатый вход одноразовый, и привязка больше не нужна
+	setOIDCBindingCookie(c, "", -1)
+	respondLogin(c, res)
+}
+
+// setOIDCBindingCookie сохраняет привязку входа через провайдера на maxAge секунд;
+// отрицательный maxAge удаляет cookie. SameSite=Lax не даёт чужим сайтам
+// отправить её фоновым запросом, а Secure выставляется, если клиент пришёл по HTTPS.
+func setOIDCBindingCookie(c *gin.Context, binding string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcBindingCookie,
+		Value:    binding,
+		Path:     oidcBindingCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// CreatePersonalToken создаёт персональный токен доступа.
+// Токен возвращается только в этом ответе.
+func (h *AuthHandler) CreatePersonalToken(c *gin.Context) {
+	var req CreatePersonalTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.authClient.CreatePersonalAccessToken(c.Request.Context(), &pb.CreatePersonalAccessTokenRequest{
+		Token:         c.GetString("token"),
+		Name:          req.Name,
+		Scopes:        req.Scopes,
+		ExpiresInDays: req.ExpiresInDays,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to create personal access token")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success":      true,
+		"access_token": res.AccessToken,
+		"token":        res.Info,
+	})
+}
+
+// ListPersonalTokens возвращает персональные токены доступа пользователя
+func (h *AuthHandler) ListPersonalTokens(c *gin.Context) {
+	res, err := h.authClient.ListPersonalAccessTokens(c.Request.Context(), &pb.ListPersonalAccessTokensRequest{
+		Token: c.GetString("token"),
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to fetch personal access tokens")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"tokens":  res.Tokens,
+	})
+}
+
+// RevokePersonalToken отзывает персональный токен доступа по ID
+func (h *AuthHandler) RevokePersonalToken(c *gin.Context) {
+	_, err := h.authClient.RevokePersonalAccessToken(c.Request.Context(), &pb.RevokePersonalAccessTokenRequest{
+		Token: c.GetString("token"),
+		Id:    c.Param("id"),
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to revoke personal access token")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Personal access token revoked",
+	})
+}
@@ -1,89 +1,62 @@
 package handler
 
 import (
+	"context"
+	"log"
 	"net/http"
-	"strings"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	pb "github.com/malaxitlmax/penfeel/api/proto"
+	"github.com/malaxitlmax/penfeel/config"
+	"github.com/malaxitlmax/penfeel/internal/api/grpcerr"
 	"github.com/malaxitlmax/penfeel/internal/api/service"
-	"golang.org/x/net/context"
+	"github.com/malaxitlmax/penfeel/internal/api/wsproto"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Или реализуйте более строгую проверку происхождения
-	},
-}
-
 // DocumentHandler структура обработчика документов
 type DocumentHandler struct {
 	documentClient pb.DocumentServiceClient
 	wsService      *service.WebSocketService
+	upgrader       websocket.Upgrader
+	// Дедлайн получения документа перед открытием WebSocket сессии
+	connectTimeout time.Duration
 }
 
-// NewDocumentHandler создает новый обработчик документов
-func NewDocumentHandler(documentClient pb.DocumentServiceClient) *DocumentHandler {
+// NewDocumentHandler создает новый обработчик документов.
+// checkOrigin проверяет источник WebSocket рукопожатий, limits задаёт лимиты WebSocket сообщений,
+// timeouts — дедлайны вызовов document-сервиса из WebSocket сессий.
+func NewDocumentHandler(documentClient pb.DocumentServiceClient, wsConfig config.WebSocketConfig, limits config.RateLimitConfig, timeouts config.TimeoutConfig, checkOrigin func(r *http.Request) bool) *DocumentHandler {
 	return &DocumentHandler{
 		documentClient: documentClient,
-		wsService:      service.NewWebSocketService(documentClient),
+		wsService:      service.NewWebSocketService(documentClient, wsConfig, limits, timeouts),
+		connectTimeout: timeouts.WebSocketCall,
+		upgrader: websocket.Upgrader{
+			Subprotocols: []string{wsproto.Subprotocol},
+			CheckOrigin:  checkOrigin,
+		},
 	}
 }
 
-// GetDocumentsRequest структура запроса на получение документов
-type GetDocumentsRequest struct {
-	UserID string `json:"user_id" form:"user_id"`
+// Shutdown завершает WebSocket сессии и сохраняет отложенные правки документов перед остановкой шлюза
+func (h *DocumentHandler) Shutdown(ctx context.Context) error {
+	return h.wsService.Shutdown(ctx)
 }
 
-// GetDocuments обрабатывает запрос на получение списка документов
+// GetDocuments обрабатывает запрос на получение списка документов пользователя из токена
 func (h *DocumentHandler) GetDocuments(c *gin.Context) {
-	var req GetDocumentsRequest
-
-	// Получаем ID пользователя из запроса или из токена
-	userID := c.GetString("user_id")
-	if userID == "" {
-		// Если ID не получен из токена, пробуем получить из query-параметров
-		if err := c.ShouldBindQuery(&req); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: user_id is required"})
-			return
-		}
-		userID = req.UserID
-	}
-
-	// Проверяем, что ID пользователя - валидный UUID
-	if _, err := uuid.Parse(userID); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user_id format", "details": "User ID must be a valid UUID"})
+	if c.GetString("user_id") == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "details": "Valid authentication token is required"})
 		return
 	}
 
 	// Отправляем запрос к document-сервису через gRPC
-	res, err := h.documentClient.GetDocuments(context.Background(), &pb.GetDocumentsRequest{
-		UserId: userID,
-	})
+	res, err := h.documentClient.GetDocuments(c.Request.Context(), &pb.GetDocumentsRequest{})
 
 	if err != nil {
-		// Проверяем ошибку на наличие "connection refused"
-		if strings.Contains(err.Error(), "connection refused") {
-			c.JSON(http.StatusServiceUnavailable, gin.H{
-				"error":   "Document service is unavailable - please try again later",
-				"details": err.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to fetch documents",
-			"details": err.Error(),
-		})
-		return
-	}
-
-	if !res.Success {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Document service rejected the request",
-			"details": res.Error,
-		})
+		grpcerr.Respond(c, err, "Failed to fetch documents")
 		return
 	}
 
@@ -95,66 +68,110 @@ func (h *DocumentHandler) GetDocuments(c *gin.Context) {
 
 // GetDocument обрабатывает запрос на получение документа
 func (h *DocumentHandler) GetDocument(c *gin.Context) {
+	document, ok := h.fetchDocument(c.Request.Context(), c)
+	if !ok {
+		return
+	}
+
+	// Доступ к документу подтверждён: сохраняем отложенные правки и перечитываем документ,
+	// чтобы вернуть актуальное содержимое и версию
+	if h.wsService.HasPendingChanges(document.Id) {
+		if err := h.wsService.FlushDocument(c.Request.Context(), document.Id); err != nil {
+			log.Printf("Error saving pending changes of document %s: %v", document.Id, err)
+		} else if document, ok = h.fetchDocument(c.Request.Context(), c); !ok {
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"document": document,
+	})
+}
+
+// ConnectDocument открывает WebSocket сессию совместного редактирования документа
+func (h *DocumentHandler) ConnectDocument(c *gin.Context) {
+	// Во время остановки шлюза новые сессии не открываем
+	if h.wsService.Draining() {
+		c.Header("Retry-After", strconv.Itoa(int(h.wsService.RestartRetryAfter().Seconds())))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server is restarting", "details": "Reconnect after the time given in Retry-After"})
+		return
+	}
+
+	// Маршрут WebSocket не ограничен дедлайном целиком, ограничиваем получение документа
+	ctx := c.Request.Context()
+	if h.connectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.connectTimeout)
+		defer cancel()
+	}
+
+	document, ok := h.fetchDocument(ctx, c)
+	if !ok {
+		return
+	}
+
+	// Только после успешного получения документа апгрейдим соединение до WebSocket
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade уже отправил клиенту ответ с ошибкой
+		return
+	}
+
+	// Передаем управление соединением в сервис WebSocket
+	// Контекст сессии наследует ID запроса и пользователя, но не дедлайн получения документа
+	h.wsService.HandleWebSocketConnection(c.Request.Context(), document.Id, c.GetString("user_id"), c.GetString("username"), conn, document)
+}
+
+// fetchDocument получает документ из пути запроса, отвечая клиенту ошибкой при неудаче
+func (h *DocumentHandler) fetchDocument(ctx context.Context, c *gin.Context) (*pb.Document, bool) {
 	documentID := c.Param("id")
 	if documentID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing document ID", "details": "Document ID is required in the path"})
-		return
+		return nil, false
 	}
 
 	// Получаем ID пользователя из токена
 	userID := c.GetString("user_id")
 	if userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "details": "Valid authentication token is required"})
-		return
+		return nil, false
 	}
 
 	// Отправляем запрос к document-сервису через gRPC
-	res, err := h.documentClient.GetDocument(context.Background(), &pb.GetDocumentRequest{
-		Id:     documentID,
-		UserId: userID,
+	res, err := h.documentClient.GetDocument(ctx, &pb.GetDocumentRequest{
+		Id: documentID,
 	})
 
 	if err != nil {
-		// Проверяем ошибку на наличие "connection refused"
-		if strings.Contains(err.Error(), "connection refused") {
-			c.JSON(http.StatusServiceUnavailable, gin.H{
-				"error":   "Document service is unavailable - please try again later",
-				"details": err.Error(),
-			})
-			return
-		}
-		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "Not Found") {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error":      "Document not found",
-				"details":    "The requested document doesn't exist or you don't have permission to access it",
-				"debug_info": err.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to fetch document",
-			"details": err.Error(),
-		})
-		return
+		grpcerr.Respond(c, err, "Failed to fetch document")
+		return nil, false
 	}
 
-	if !res.Success {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Document service rejected the request",
-			"details": res.Error,
-		})
-		return
+	return res.Document, true
+}
+
+// flushPendingChanges сохраняет отложенные правки WebSocket сессий документа из пути запроса,
+// отвечая клиенту ошибкой при неудаче. Правки сохраняются только после того, как document-сервис
+// подтвердил доступ пользователя к документу.
+func (h *DocumentHandler) flushPendingChanges(c *gin.Context) bool {
+	documentID := c.Param("id")
+	if !h.wsService.HasPendingChanges(documentID) {
+		return true
 	}
 
-	// Только после успешного получения документа апгрейдим соединение до WebSocket
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upgrade to WebSocket", "details": err.Error()})
-		return
+	if _, ok := h.fetchDocument(c.Request.Context(), c); !ok {
+		return false
 	}
 
-	// Передаем управление соединением в сервис WebSocket
-	h.wsService.HandleWebSocketConnection(documentID, userID, conn, res.Document)
+	if err := h.wsService.FlushDocument(c.Request.Context(), documentID); err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"error":   "Failed to save pending changes of the document",
+			"details": err.Error(),
+		})
+		return false
+	}
+	return true
 }
 
 // CreateDocumentRequest структура запроса на создание документа
@@ -179,40 +196,13 @@ func (h *DocumentHandler) CreateDocument(c *gin.Context) {
 	}
 
 	// Отправляем запрос к document-сервису через gRPC
-	res, err := h.documentClient.CreateDocument(context.Background(), &pb.CreateDocumentRequest{
+	res, err := h.documentClient.CreateDocument(c.Request.Context(), &pb.CreateDocumentRequest{
 		Title:   req.Title,
 		Content: req.Content,
-		UserId:  userID,
 	})
 
 	if err != nil {
-		if strings.Contains(err.Error(), "connection refused") {
-			c.JSON(http.StatusServiceUnavailable, gin.H{
-				"error":   "Document service is unavailable - please try again later",
-				"details": err.Error(),
-			})
-			return
-		}
-		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "Not Found") {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error":      "Failed to create document: resource not found",
-				"details":    "This could be due to missing user permissions or service configuration issues",
-				"debug_info": err.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to create document",
-			"details": err.Error(),
-		})
-		return
-	}
-
-	if !res.Success {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Document service rejected the request",
-			"details": res.Error,
-		})
+		grpcerr.Respond(c, err, "Failed to create document")
 		return
 	}
 
@@ -249,49 +239,25 @@ func (h *DocumentHandler) UpdateDocument(c *gin.Context) {
 		return
 	}
 
+	// Сохраняем отложенные правки WebSocket сессий, чтобы они не перезаписали это обновление
+	if !h.flushPendingChanges(c) {
+		return
+	}
+
 	// Отправляем запрос к document-сервису через gRPC
-	res, err := h.documentClient.UpdateDocument(context.Background(), &pb.UpdateDocumentRequest{
+	res, err := h.documentClient.UpdateDocument(c.Request.Context(), &pb.UpdateDocumentRequest{
 		Id:      documentID,
 		Title:   req.Title,
 		Content: req.Content,
-		UserId:  userID,
 	})
 
 	if err != nil {
-		if strings.Contains(err.Error(), "connection refused") {
-			c.JSON(http.StatusServiceUnavailable, gin.H{
-				"error":   "Document service is unavailable - please try again later",
-				"details": err.Error(),
-			})
-			return
-		}
-		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "Not Found") {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error":      "Document not found",
-				"details":    "The requested document doesn't exist or you don't have permission to modify it",
-				"debug_info": err.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to update document",
-			"details": err.Error(),
-		})
+		grpcerr.Respond(c, err, "Failed to update document")
 		return
 	}
 
-	if !res.Success {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Document service rejected the update request",
-			"details": res.Error,
-		})
-		return
-	}
-
-	// Если есть активные WebSocket соединения для этого документа, уведомляем их об обновлении
-	if h.wsService.GetActiveConnections(documentID) > 0 {
-		h.wsService.NotifyDocumentUpdated(documentID, userID, res.Document)
-	}
+	// Уведомляем WebSocket сессии документа об обновлении, включая приостановленные
+	h.wsService.NotifyDocumentUpdated(documentID, userID, res.Document)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success":  true,
@@ -318,41 +284,17 @@ func (h *DocumentHandler) DeleteDocument(c *gin.Context) {
 	hasActiveConnections := h.wsService.GetActiveConnections(documentID) > 0
 
 	// Отправляем запрос к document-сервису через gRPC
-	res, err := h.documentClient.DeleteDocument(context.Background(), &pb.DeleteDocumentRequest{
-		Id:     documentID,
-		UserId: userID,
+	_, err := h.documentClient.DeleteDocument(c.Request.Context(), &pb.DeleteDocumentRequest{
+		Id: documentID,
 	})
 
 	if err != nil {
-		if strings.Contains(err.Error(), "connection refused") {
-			c.JSON(http.StatusServiceUnavailable, gin.H{
-				"error":   "Document service is unavailable - please try again later",
-				"details": err.Error(),
-			})
-			return
-		}
-		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "Not Found") {
-			c.JSON(http.StatusNotFound, gin.H{
-				"error":      "Document not found",
-				"details":    "The requested document doesn't exist or you don't have permission to delete it",
-				"debug_info": err.Error(),
-			})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "Failed to delete document",
-			"details": err.Error(),
-		})
+		grpcerr.Respond(c, err, "Failed to delete document")
 		return
 	}
 
-	if !res.Success {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "Document service rejected the deletion request",
-			"details": res.Error,
-		})
-		return
-	}
+	// Отложенные правки удалённого документа сохранять уже некуда
+	h.wsService.DiscardDocument(documentID)
 
 	// Если есть активные соединения, отправляем уведомление об удалении документа
 	if hasActiveConnections {
@@ -364,3 +306,94 @@ func (h *DocumentHandler) DeleteDocument(c *gin.Context) {
 		"message": "Document successfully deleted",
 	})
 }
+
+// LockDocumentRequest структура запроса на блокировку документа
+type LockDocumentRequest struct {
+	TTLSeconds int64 `json:"ttl_seconds"`
+}
+
+// LockDocument обрабатывает запрос на блокировку документа
+func (h *DocumentHandler) LockDocument(c *gin.Context) {
+	documentID := c.Param("id")
+	if documentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing document ID", "details": "Document ID is required in the path"})
+		return
+	}
+
+	var req LockDocumentRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+			return
+		}
+	}
+
+	// Получаем ID пользователя из токена
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "details": "Valid authentication token is required"})
+		return
+	}
+
+	// Отложенные правки других участников должны сохраниться до блокировки документа
+	if !h.flushPendingChanges(c) {
+		return
+	}
+
+	// Отправляем запрос к document-сервису через gRPC
+	res, err := h.documentClient.LockDocument(c.Request.Context(), &pb.LockDocumentRequest{
+		Id:         documentID,
+		TtlSeconds: req.TTLSeconds,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to lock document")
+		return
+	}
+
+	// Объявляем блокировку участникам WebSocket сессий
+	h.wsService.NotifyLockAcquired(documentID, res.Lock)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"lock":    res.Lock,
+	})
+}
+
+// UnlockDocument обрабатывает запрос на снятие блокировки.
+// Принудительное снятие владельцем документа запрашивается query-параметром force=true.
+func (h *DocumentHandler) UnlockDocument(c *gin.Context) {
+	documentID := c.Param("id")
+	if documentID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing document ID", "details": "Document ID is required in the path"})
+		return
+	}
+
+	// Получаем ID пользователя из токена
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "details": "Valid authentication token is required"})
+		return
+	}
+
+	force := c.Query("force") == "true"
+
+	// Отправляем запрос к document-сервису через gRPC
+	_, err := h.documentClient.UnlockDocument(c.Request.Context(), &pb.UnlockDocumentRequest{
+		Id:    documentID,
+		Force: force,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to unlock document")
+		return
+	}
+
+	// Объявляем снятие блокировки участникам WebSocket сессий
+	h.wsService.NotifyLockReleased(documentID, userID, force)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Lock released",
+	})
+}
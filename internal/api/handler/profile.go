@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	pb "github.com/malaxitlmax/penfeel/api/proto"
+	"github.com/malaxitlmax/penfeel/internal/api/grpcerr"
+	"github.com/malaxitlmax/penfeel/internal/api/service"
+)
+
+// multipartOverhead запас на заголовки multipart сверх размера аватара
+const multipartOverhead = 64 << 10
+
+// UpdateProfileRequest структура запроса на изменение профиля; отсутствующие поля не меняются
+type UpdateProfileRequest struct {
+	Username    *string `json:"username" binding:"omitempty,min=3,max=50"`
+	DisplayName *string `json:"display_name" binding:"omitempty,max=100"`
+	Bio         *string `json:"bio" binding:"omitempty,max=500"`
+}
+
+// ChangePasswordRequest структура запроса на смену пароля
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+}
+
+// ChangeEmailRequest структура запроса на смену email
+type ChangeEmailRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+// ProfileHandler структура обработчика профиля пользователя
+type ProfileHandler struct {
+	authClient    pb.AuthServiceClient
+	tokenVerifier *service.TokenVerifier
+	maxAvatarSize int64
+}
+
+// NewProfileHandler создает новый обработчик профиля.
+// После изменения профиля данные пользователя удаляются из кэша tokenVerifier.
+func NewProfileHandler(authClient pb.AuthServiceClient, tokenVerifier *service.TokenVerifier, maxAvatarSize int) *ProfileHandler {
+	return &ProfileHandler{
+		authClient:    authClient,
+		tokenVerifier: tokenVerifier,
+		maxAvatarSize: int64(maxAvatarSize),
+	}
+}
+
+// GetProfile возвращает профиль пользователя
+func (h *ProfileHandler) GetProfile(c *gin.Context) {
+	res, err := h.authClient.GetProfile(c.Request.Context(), &pb.GetProfileRequest{
+		Token: c.GetString("token"),
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to fetch profile")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"profile": profileResponse(res.Profile),
+	})
+}
+
+// UpdateProfile изменяет имя пользователя, отображаемое имя и описание профиля
+func (h *ProfileHandler) UpdateProfile(c *gin.Context) {
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.authClient.UpdateProfile(c.Request.Context(), &pb.UpdateProfileRequest{
+		Token:       c.GetString("token"),
+		Username:    req.Username,
+		DisplayName: req.DisplayName,
+		Bio:         req.Bio,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to update profile")
+		return
+	}
+	h.tokenVerifier.ForgetUser(res.Profile.Id)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"profile": profileResponse(res.Profile),
+	})
+}
+
+// ChangePassword меняет пароль; остальные сессии пользователя завершаются, персональные токены отзываются
+func (h *ProfileHandler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.authClient.ChangePassword(c.Request.Context(), &pb.ChangePasswordRequest{
+		Token:           c.GetString("token"),
+		CurrentPassword: req.CurrentPassword,
+		NewPassword:     req.NewPassword,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to change password")
+		return
+	}
+	h.tokenVerifier.ForgetUser(c.GetString("user_id"))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Password changed, other sessions have been signed out and personal access tokens revoked",
+	})
+}
+
+// ChangeEmail отправляет ссылку подтверждения на новый email.
+// Адрес меняется после перехода по ссылке.
+func (h *ProfileHandler) ChangeEmail(c *gin.Context) {
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.authClient.ChangeEmail(c.Request.Context(), &pb.ChangeEmailRequest{
+		Token:    c.GetString("token"),
+		NewEmail: req.Email,
+		Password: req.Password,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to change email")
+		return
+	}
+	h.tokenVerifier.ForgetUser(c.GetString("user_id"))
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": "A confirmation link has been sent to the new email address",
+	})
+}
+
+// UploadAvatar заменяет аватар изображением из поля avatar формы multipart/form-data
+func (h *ProfileHandler) UploadAvatar(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxAvatarSize+multipartOverhead)
+
+	file, err := c.FormFile("avatar")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Avatar is too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if file.Size > h.maxAvatarSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Avatar is too large"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, h.maxAvatarSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	res, err := h.authClient.UploadAvatar(c.Request.Context(), &pb.UploadAvatarRequest{
+		Token: c.GetString("token"),
+		Data:  data,
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to upload avatar")
+		return
+	}
+	h.tokenVerifier.ForgetUser(c.GetString("user_id"))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"profile": profileResponse(res.Profile),
+	})
+}
+
+// DeleteAvatar удаляет аватар
+func (h *ProfileHandler) DeleteAvatar(c *gin.Context) {
+	_, err := h.authClient.DeleteAvatar(c.Request.Context(), &pb.DeleteAvatarRequest{
+		Token: c.GetString("token"),
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to delete avatar")
+		return
+	}
+	h.tokenVerifier.ForgetUser(c.GetString("user_id"))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Avatar deleted",
+	})
+}
+
+// GetAvatar отдаёт изображение аватара пользователя по ID.
+// Адрес с параметром v из avatar_url кэшируется бессрочно: при замене аватара меняется и адрес.
+func (h *ProfileHandler) GetAvatar(c *gin.Context) {
+	res, err := h.authClient.GetAvatar(c.Request.Context(), &pb.GetAvatarRequest{
+		UserId: c.Param("id"),
+	})
+
+	if err != nil {
+		grpcerr.Respond(c, err, "Failed to fetch avatar")
+		return
+	}
+
+	if c.Query("v") != "" {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		c.Header("Cache-Control", "no-cache")
+	}
+	// Браузер не должен угадывать тип содержимого загруженного пользователем файла
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'")
+	c.Data(http.StatusOK, res.ContentType, res.Data)
+}
+
+// profileResponse преобразует профиль в ответ с адресом аватара
+func profileResponse(profile *pb.Profile) gin.H {
+	response := gin.H{
+		"id":                 profile.Id,
+		"username":           profile.Username,
+		"email":              profile.Email,
+		"email_verified":     profile.EmailVerified,
+		"pending_email":      profile.PendingEmail,
+		"display_name":       profile.DisplayName,
+		"bio":                profile.Bio,
+		"has_password":       profile.HasPassword,
+		"two_factor_enabled": profile.TwoFactorEnabled,
+		"created_at":         profile.CreatedAt,
+		"avatar_url":         nil,
+	}
+	if profile.AvatarUpdatedAt != "" {
+		version := profile.AvatarUpdatedAt
+		if updatedAt, err := time.Parse(time.RFC3339Nano, profile.AvatarUpdatedAt); err == nil {
+			version = fmt.Sprint(updatedAt.UnixMilli())
+		}
+		response["avatar_url"] = "/api/v1/users/" + profile.Id + "/avatar?v=" + url.QueryEscape(version)
+	}
+	return response
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/malaxitlmax/penfeel/internal/api/service"
+)
+
+// TicketHandler структура обработчика билетов для WebSocket подключений
+type TicketHandler struct {
+	tickets *service.TicketStore
+}
+
+// NewTicketHandler создает новый обработчик билетов
+func NewTicketHandler(tickets *service.TicketStore) *TicketHandler {
+	return &TicketHandler{
+		tickets: tickets,
+	}
+}
+
+// IssueTicketRequest структура запроса на получение билета
+type IssueTicketRequest struct {
+	DocumentID string `json:"document_id"`
+}
+
+// IssueTicket выдаёт одноразовый билет для подключения к WebSocket
+func (h *TicketHandler) IssueTicket(c *gin.Context) {
+	var req IssueTicketRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data", "details": err.Error()})
+			return
+		}
+	}
+
+	// Получаем ID пользователя из токена
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required", "details": "Valid authentication token is required"})
+		return
+	}
+
+	ticket, expiresAt, err := h.tickets.Issue(service.Ticket{
+		UserID:     userID,
+		Username:   c.GetString("username"),
+		Email:      c.GetString("email"),
+		DocumentID: req.DocumentID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue ticket", "details": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"ticket":     ticket,
+		"expires_at": expiresAt,
+	})
+}
@@ -5,12 +5,15 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	pb "github.com/malaxitlmax/penfeel/api/proto"
-	"golang.org/x/net/context"
+	"github.com/gorilla/websocket"
+	"github.com/malaxitlmax/penfeel/internal/api/grpcerr"
+	"github.com/malaxitlmax/penfeel/internal/api/service"
+	"github.com/malaxitlmax/penfeel/internal/api/wsproto"
+	pkgauth "github.com/malaxitlmax/penfeel/pkg/auth"
 )
 
-// AuthMiddleware middleware для авторизации через JWT токен
-func AuthMiddleware(authClient pb.AuthServiceClient) gin.HandlerFunc {
+// AuthMiddleware middleware для авторизации через JWT токен или персональный токен доступа
+func AuthMiddleware(tokens *service.TokenVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Получаем токен из заголовка Authorization
 		authHeader := c.GetHeader("Authorization")
@@ -35,27 +38,125 @@ func AuthMiddleware(authClient pb.AuthServiceClient) gin.HandlerFunc {
 			return
 		}
 
-		// Проверяем токен через auth service
-		res, err := authClient.ValidateToken(context.Background(), &pb.ValidateTokenRequest{
-			Token: token,
-		})
-
+		user, err := tokens.Verify(c.Request.Context(), token)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			grpcerr.Respond(c, err, "Invalid token")
+			c.Abort()
+			return
+		}
+
+		// Сохраняем информацию о пользователе в контексте
+		withUser(c, user.ID, user.Username, user.Email)
+		// Токен и сессия нужны маршрутам управления сессиями
+		c.Set("token", token)
+		c.Set("session_id", user.SessionID)
+		c.Set("email_verified", user.EmailVerified)
+		if user.Personal() {
+			c.Set("personal_token_id", user.PersonalTokenID)
+			c.Set("scopes", user.Scopes)
+		}
+
+		c.Next()
+	}
+}
+
+// RequireScopeMiddleware запрещает запрос с персональным токеном без права scope.
+// Токену сессии разрешено всё. Ставится после AuthMiddleware.
+func RequireScopeMiddleware(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if scopes, ok := c.Get("scopes"); ok && !pkgauth.HasScope(scopes.([]string), scope) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":          "Token does not have the required scope",
+				"reason":         "INSUFFICIENT_SCOPE",
+				"required_scope": scope,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// SessionOnlyMiddleware запрещает запрос с персональным токеном доступа: управлять сессиями
+// и безопасностью учётной записи можно только после входа. Ставится после AuthMiddleware.
+func SessionOnlyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("personal_token_id") != "" {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":  "This endpoint cannot be used with a personal access token",
+				"reason": "SESSION_REQUIRED",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// VerifiedEmailMiddleware запрещает запрос пользователю с неподтверждённым email.
+// Ставится после AuthMiddleware.
+func VerifiedEmailMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("email_verified") {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":  "Email address is not verified",
+				"reason": "EMAIL_NOT_VERIFIED",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// WebSocketAuthMiddleware middleware для авторизации WebSocket подключений.
+// Принимает одноразовый билет в query-параметре ticket либо access-токен в подпротоколе.
+func WebSocketAuthMiddleware(tokens *service.TokenVerifier, tickets *service.TicketStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Билет, полученный через POST /api/v1/ws/tickets
+		if value := c.Query("ticket"); value != "" {
+			ticket, ok := tickets.Redeem(value, c.Param("id"))
+			if !ok {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired ticket"})
+				c.Abort()
+				return
+			}
+
+			withUser(c, ticket.UserID, ticket.Username, ticket.Email)
+			c.Next()
+			return
+		}
+
+		// Access-токен, переданный подпротоколом
+		var token string
+		for _, protocol := range websocket.Subprotocols(c.Request) {
+			if strings.HasPrefix(protocol, wsproto.TokenSubprotocolPrefix) {
+				token = strings.TrimPrefix(protocol, wsproto.TokenSubprotocolPrefix)
+				break
+			}
+		}
+		if token == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "WebSocket connection requires a ticket or an access token subprotocol"})
 			c.Abort()
 			return
 		}
 
-		if !res.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": res.Error})
+		user, err := tokens.Verify(c.Request.Context(), token)
+		if err != nil {
+			grpcerr.Respond(c, err, "Invalid token")
 			c.Abort()
 			return
 		}
 
 		// Сохраняем информацию о пользователе в контексте
-		c.Set("user_id", res.User.Id)
-		c.Set("username", res.User.Username)
-		c.Set("email", res.User.Email)
+		withUser(c, user.ID, user.Username, user.Email)
+		if user.Personal() {
+			c.Set("personal_token_id", user.PersonalTokenID)
+			c.Set("scopes", user.Scopes)
+		}
 
 		c.Next()
 	}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/malaxitlmax/penfeel/internal/api/wsproto"
+)
+
+// OriginPolicy список разрешённых источников (Origin), общий для CORS и WebSocket
+type OriginPolicy struct {
+	allowAll bool
+	origins  map[string]bool
+}
+
+// NewOriginPolicy создаёт политику из списка источников. Значение "*" разрешает любой источник.
+func NewOriginPolicy(origins []string) *OriginPolicy {
+	policy := &OriginPolicy{origins: make(map[string]bool, len(origins))}
+	for _, origin := range origins {
+		origin = normalizeOrigin(origin)
+		if origin == "*" {
+			policy.allowAll = true
+			continue
+		}
+		if origin != "" {
+			policy.origins[origin] = true
+		}
+	}
+	return policy
+}
+
+// Allowed проверяет, входит ли источник в список разрешённых
+func (p *OriginPolicy) Allowed(origin string) bool {
+	return p.allowAll || p.origins[normalizeOrigin(origin)]
+}
+
+// CheckOrigin проверяет источник WebSocket рукопожатия.
+// Запросы без Origin (не из браузера) и запросы с того же хоста разрешены.
+func (p *OriginPolicy) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	return p.Allowed(origin)
+}
+
+// CORSMiddleware middleware CORS на основе политики источников.
+// WebSocket рукопожатия пропускаются: их проверяет WebSocketOriginMiddleware.
+func CORSMiddleware(policy *OriginPolicy) gin.HandlerFunc {
+	corsConfig := cors.DefaultConfig()
+	corsConfig.AllowOriginFunc = policy.Allowed
+	corsConfig.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	corsConfig.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
+	corsConfig.ExposeHeaders = []string{"Content-Length"}
+	corsConfig.AllowCredentials = true
+	handleCORS := cors.New(corsConfig)
+
+	return func(c *gin.Context) {
+		if websocket.IsWebSocketUpgrade(c.Request) {
+			c.Next()
+			return
+		}
+		handleCORS(c)
+	}
+}
+
+// WebSocketOriginMiddleware отклоняет WebSocket рукопожатия с неразрешённых источников.
+// Отказ HTTP-статусом браузер не показывает странице, поэтому соединение
+// принимается и сразу закрывается с кодом 1008 и понятной причиной.
+// Проверка выполняется до авторизации, чтобы чужой сайт не мог погасить билет пользователя.
+func WebSocketOriginMiddleware(policy *OriginPolicy) gin.HandlerFunc {
+	rejecter := websocket.Upgrader{
+		Subprotocols: []string{wsproto.Subprotocol},
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+	}
+
+	return func(c *gin.Context) {
+		if policy.CheckOrigin(c.Request) {
+			c.Next()
+			return
+		}
+
+		log.Printf("Rejected WebSocket connection from origin %s", c.GetHeader("Origin"))
+		c.Abort()
+
+		conn, err := rejecter.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.WriteControl(
+			websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "origin not allowed"),
+			time.Now().Add(time.Second),
+		)
+	}
+}
+
+// normalizeOrigin приводит источник к виду scheme://host[:port] без завершающего слеша
+func normalizeOrigin(origin string) string {
+	return strings.ToLower(strings.TrimSuffix(strings.TrimSpace(origin), "/"))
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/malaxitlmax/penfeel/pkg/ratelimit"
+	"github.com/malaxitlmax/penfeel/pkg/requestmeta"
+)
+
+// RateLimitMiddleware ограничивает частоту запросов.
+// Запросы авторизованного пользователя считаются по его ID, остальные — по IP клиента,
+// поэтому middleware следует подключать после авторизации. IP берётся из ClientMiddleware:
+// адрес соединения, а заголовки прокси — только от доверенных прокси роутера.
+func RateLimitMiddleware(limiter *ratelimit.KeyedLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientIP := requestmeta.ClientIP(c.Request.Context())
+		if clientIP == "" {
+			clientIP = c.ClientIP()
+		}
+
+		key := "ip:" + clientIP
+		if userID := c.GetString("user_id"); userID != "" {
+			key = "user:" + userID
+		}
+
+		allowed, retryAfter := limiter.Allow(key)
+		if allowed {
+			c.Next()
+			return
+		}
+
+		seconds := int(math.Ceil(retryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(seconds))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests", "retry_after": seconds})
+		c.Abort()
+	}
+}
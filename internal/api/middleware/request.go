@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"context"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/malaxitlmax/penfeel/pkg/requestmeta"
+)
+
+// RequestIDHeader заголовок с ID запроса
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength ограничение длины ID запроса, переданного клиентом
+const maxRequestIDLength = 128
+
+// RequestIDMiddleware присваивает запросу ID и сохраняет его в контексте запроса.
+// ID из заголовка X-Request-ID используется, если он не длиннее 128 печатных ASCII символов.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+
+		c.Set("request_id", requestID)
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(requestmeta.WithRequestID(c.Request.Context(), requestID))
+
+		c.Next()
+	}
+}
+
+// ClientMiddleware сохраняет IP адрес и User-Agent клиента в контексте запроса,
+// откуда они передаются сервисам, например для списка сессий пользователя
+func ClientMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request = c.Request.WithContext(requestmeta.WithClient(c.Request.Context(), c.ClientIP(), c.Request.UserAgent()))
+		c.Next()
+	}
+}
+
+// TimeoutMiddleware ограничивает время вызовов сервисов, выполняемых с контекстом запроса.
+// Неположительный timeout оставляет только отмену запроса клиентом.
+func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// withUser сохраняет пользователя в gin и в контексте запроса, откуда он передаётся в метаданные gRPC
+func withUser(c *gin.Context, userID, username, email string) {
+	c.Set("user_id", userID)
+	c.Set("username", username)
+	c.Set("email", email)
+	c.Request = c.Request.WithContext(requestmeta.WithUserID(c.Request.Context(), userID))
+}
+
+// validRequestID проверяет ID запроса, переданный клиентом
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] < 0x21 || requestID[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -1,63 +1,146 @@
 package service
 
 import (
-	"encoding/json"
+	"context"
+	"fmt"
 	"log"
+	"math/rand/v2"
 	"sync"
+	"time"
 
 	"github.com/gorilla/websocket"
 	pb "github.com/malaxitlmax/penfeel/api/proto"
-	"golang.org/x/net/context"
+	"github.com/malaxitlmax/penfeel/config"
+	"github.com/malaxitlmax/penfeel/internal/api/wsproto"
+	"github.com/malaxitlmax/penfeel/pkg/apperrors"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
 )
 
+// Client WebSocket соединение пользователя с документом.
+// gorilla/websocket не допускает конкурентной записи, поэтому запись защищена мьютексом.
+type Client struct {
+	conn         *websocket.Conn
+	writeTimeout time.Duration
+	writeLock    sync.Mutex
+}
+
+// NewClient оборачивает WebSocket соединение. Запись сообщения, не завершённая за writeTimeout,
+// возвращает ошибку; неположительное значение отключает дедлайн.
+func NewClient(conn *websocket.Conn, writeTimeout time.Duration) *Client {
+	return &Client{conn: conn, writeTimeout: writeTimeout}
+}
+
+// WriteJSON отправляет сообщение клиенту. После истёкшего дедлайна соединение непригодно для записи,
+// и его обработчик завершается на следующем чтении.
+func (c *Client) WriteJSON(message interface{}) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if c.writeTimeout > 0 {
+		c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	}
+	return c.conn.WriteJSON(message)
+}
+
+// Close закрывает соединение
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// CloseWithReason отправляет клиенту кадр закрытия с кодом и причиной и закрывает соединение
+func (c *Client) CloseWithReason(code int, reason string) error {
+	c.conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(code, reason),
+		time.Now().Add(time.Second),
+	)
+	return c.conn.Close()
+}
+
 // WebSocketService управляет WebSocket соединениями и обработкой сообщений
 type WebSocketService struct {
-	documentClient pb.DocumentServiceClient
+	documentClient   pb.DocumentServiceClient
+	presence         *PresenceTracker
+	history          *HistoryStore
+	sessions         *SessionStore
+	writes           *WriteBuffer
+	locks            *LockTable
+	limiter          *MessageLimiter
+	handshakeTimeout time.Duration
+	restartRetry     time.Duration
+	writeTimeout     time.Duration
+	// Дедлайны вызовов document-сервиса из сессии и сохранения правок при её закрытии
+	callTimeout time.Duration
+	saveTimeout time.Duration
+
+	// После начала остановки новые соединения не принимаются
+	drainLock sync.Mutex
+	draining  bool
+	active    sync.WaitGroup
 
 	// Мьютекс для безопасного доступа к карте соединений
 	connectionsLock sync.RWMutex
-	// documentID -> map[userID]*websocket.Conn
-	documentConnections map[string]map[string]*websocket.Conn
+	// documentID -> map[userID]*Client
+	documentConnections map[string]map[string]*Client
+
+	// Закрывается при остановке и завершает фоновую очистку присутствия
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
 // NewWebSocketService создаёт новый сервис для обработки WebSocket соединений
-func NewWebSocketService(documentClient pb.DocumentServiceClient) *WebSocketService {
-	return &WebSocketService{
+func NewWebSocketService(documentClient pb.DocumentServiceClient, cfg config.WebSocketConfig, limits config.RateLimitConfig, timeouts config.TimeoutConfig) *WebSocketService {
+	s := &WebSocketService{
 		documentClient:      documentClient,
-		documentConnections: make(map[string]map[string]*websocket.Conn),
+		presence:            NewPresenceTracker(cfg.PresenceTTL),
+		history:             NewHistoryStore(cfg.HistorySize),
+		sessions:            NewSessionStore(cfg.ResumeGracePeriod),
+		limiter:             NewMessageLimiter(limits),
+		locks:               NewLockTable(),
+		handshakeTimeout:    cfg.HandshakeTimeout,
+		restartRetry:        cfg.RestartRetryAfter,
+		writeTimeout:        cfg.WriteTimeout,
+		callTimeout:         timeouts.WebSocketCall,
+		saveTimeout:         timeouts.BackgroundSave,
+		documentConnections: make(map[string]map[string]*Client),
+		stop:                make(chan struct{}),
 	}
+
+	s.writes = NewWriteBuffer(documentClient, cfg.FlushInterval, cfg.FlushIdleDelay, timeouts.BackgroundSave, s.notifySaveFailed)
+
+	go s.sweepPresence(cfg.PresenceSweepInterval)
+
+	return s
 }
 
 // RegisterConnection регистрирует новое WebSocket соединение для документа
-func (s *WebSocketService) RegisterConnection(documentID, userID string, conn *websocket.Conn) []string {
+func (s *WebSocketService) RegisterConnection(documentID, userID string, client *Client) {
 	s.connectionsLock.Lock()
 	defer s.connectionsLock.Unlock()
 
 	// Создаём карту соединений для документа, если её ещё нет
 	if _, exists := s.documentConnections[documentID]; !exists {
-		s.documentConnections[documentID] = make(map[string]*websocket.Conn)
+		s.documentConnections[documentID] = make(map[string]*Client)
 	}
 
 	// Регистрируем соединение
-	s.documentConnections[documentID][userID] = conn
+	s.documentConnections[documentID][userID] = client
 
-	// Получаем список активных пользователей
-	activeUsers := make([]string, 0, len(s.documentConnections[documentID]))
-	for uid := range s.documentConnections[documentID] {
-		activeUsers = append(activeUsers, uid)
-	}
-
-	log.Printf("User %s connected to document %s. Total active users: %d", userID, documentID, len(activeUsers))
-	return activeUsers
+	log.Printf("User %s connected to document %s. Total active users: %d", userID, documentID, len(s.documentConnections[documentID]))
 }
 
-// RemoveConnection удаляет соединение пользователя
-func (s *WebSocketService) RemoveConnection(documentID, userID string) {
+// RemoveConnection удаляет соединение пользователя, если оно не было заменено более новым
+func (s *WebSocketService) RemoveConnection(documentID, userID string, client *Client) {
 	s.connectionsLock.Lock()
 	defer s.connectionsLock.Unlock()
 
 	// Проверяем, существует ли карта для документа
 	if connections, exists := s.documentConnections[documentID]; exists {
+		if connections[userID] != client {
+			return
+		}
+
 		// Удаляем соединение пользователя
 		delete(connections, userID)
 
@@ -70,33 +153,46 @@ func (s *WebSocketService) RemoveConnection(documentID, userID string) {
 	}
 }
 
-// BroadcastToOthers отправляет сообщение всем пользователям документа, кроме отправителя
-func (s *WebSocketService) BroadcastToOthers(documentID string, senderID string, message interface{}) {
+// isConnected проверяет, есть ли у пользователя активное соединение с документом
+func (s *WebSocketService) isConnected(documentID, userID string) bool {
 	s.connectionsLock.RLock()
 	defer s.connectionsLock.RUnlock()
 
-	if connections, exists := s.documentConnections[documentID]; exists {
-		for userID, conn := range connections {
-			// Не отправляем сообщение отправителю
-			if userID != senderID {
-				if err := conn.WriteJSON(message); err != nil {
-					log.Printf("Error broadcasting to user %s: %v", userID, err)
-				}
-			}
-		}
-	}
+	_, exists := s.documentConnections[documentID][userID]
+	return exists
+}
+
+// BroadcastToOthers отправляет сообщение всем пользователям документа, кроме отправителя
+func (s *WebSocketService) BroadcastToOthers(documentID string, senderID string, message interface{}) {
+	s.broadcast(s.recipients(documentID, senderID), message)
 }
 
 // BroadcastToAll отправляет сообщение всем пользователям документа, включая отправителя
 func (s *WebSocketService) BroadcastToAll(documentID string, message interface{}) {
+	s.broadcast(s.recipients(documentID, ""), message)
+}
+
+// recipients возвращает соединения документа, кроме соединения exceptUserID.
+// Сообщения отправляются по копии, чтобы запись медленному клиенту не блокировала
+// подключение и отключение других пользователей.
+func (s *WebSocketService) recipients(documentID, exceptUserID string) map[string]*Client {
 	s.connectionsLock.RLock()
 	defer s.connectionsLock.RUnlock()
 
-	if connections, exists := s.documentConnections[documentID]; exists {
-		for userID, conn := range connections {
-			if err := conn.WriteJSON(message); err != nil {
-				log.Printf("Error broadcasting to user %s: %v", userID, err)
-			}
+	recipients := make(map[string]*Client, len(s.documentConnections[documentID]))
+	for userID, client := range s.documentConnections[documentID] {
+		if userID != exceptUserID {
+			recipients[userID] = client
+		}
+	}
+	return recipients
+}
+
+// broadcast отправляет сообщение каждому соединению
+func (s *WebSocketService) broadcast(recipients map[string]*Client, message interface{}) {
+	for userID, client := range recipients {
+		if err := client.WriteJSON(message); err != nil {
+			log.Printf("Error broadcasting to user %s: %v", userID, err)
 		}
 	}
 }
@@ -118,8 +214,8 @@ func (s *WebSocketService) CloseAllDocumentConnections(documentID string) {
 	defer s.connectionsLock.Unlock()
 
 	if connections, exists := s.documentConnections[documentID]; exists {
-		for _, conn := range connections {
-			conn.Close()
+		for _, client := range connections {
+			client.Close()
 		}
 		delete(s.documentConnections, documentID)
 	}
@@ -128,11 +224,7 @@ func (s *WebSocketService) CloseAllDocumentConnections(documentID string) {
 // NotifyDocumentDeleted уведомляет всех пользователей об удалении документа и закрывает соединения
 func (s *WebSocketService) NotifyDocumentDeleted(documentID, userID string) {
 	// Отправляем уведомление об удалении
-	message := map[string]interface{}{
-		"type":    "document_deleted",
-		"user_id": userID,
-	}
-	s.BroadcastToAll(documentID, message)
+	s.BroadcastToAll(documentID, wsproto.NewDocumentDeleted(userID))
 
 	// Закрываем все соединения
 	s.CloseAllDocumentConnections(documentID)
@@ -140,149 +232,510 @@ func (s *WebSocketService) NotifyDocumentDeleted(documentID, userID string) {
 
 // NotifyDocumentUpdated уведомляет всех пользователей об обновлении документа через REST API
 func (s *WebSocketService) NotifyDocumentUpdated(documentID, userID string, document *pb.Document) {
-	message := map[string]interface{}{
-		"type":     "document_updated_externally",
-		"document": document,
-		"user_id":  userID,
-	}
-	s.BroadcastToAll(documentID, message)
+	// Сохраняем изменение в истории, чтобы его получили и приостановленные сессии
+	event := s.history.Append(documentID, *wsproto.NewDocumentChanged(userID, document.Title, document.Content))
+	s.BroadcastToAll(documentID, wsproto.NewDocumentUpdatedExternally(event.Version, userID, document))
 }
 
-// HandleWebSocketConnection обрабатывает WebSocket соединение после его установки
-func (s *WebSocketService) HandleWebSocketConnection(documentID, userID string, conn *websocket.Conn, document *pb.Document) {
-	// Получаем список активных пользователей
-	activeUsers := s.RegisterConnection(documentID, userID, conn)
+// FlushDocument сохраняет отложенные правки документа
+func (s *WebSocketService) FlushDocument(ctx context.Context, documentID string) error {
+	return s.writes.Flush(ctx, documentID)
+}
 
-	// Отправляем начальное состояние документа
-	initialMessage := map[string]interface{}{
-		"type":         "init",
-		"document":     document,
-		"active_users": activeUsers,
-	}
+// HasPendingChanges сообщает, есть ли у документа ещё не сохранённые правки
+func (s *WebSocketService) HasPendingChanges(documentID string) bool {
+	_, _, ok := s.writes.Pending(documentID)
+	return ok
+}
 
-	if err := conn.WriteJSON(initialMessage); err != nil {
-		log.Println("Error sending initial document state:", err)
-		s.RemoveConnection(documentID, userID)
-		conn.Close()
+// NotifyLockAcquired сохраняет блокировку документа и объявляет её участникам
+func (s *WebSocketService) NotifyLockAcquired(documentID string, lock *pb.DocumentLock) {
+	wsLock := LockFromProto(lock)
+	s.locks.Acquire(documentID, wsLock)
+	s.BroadcastToAll(documentID, wsproto.NewLockAcquired(wsLock))
+}
+
+// NotifyLockReleased удаляет блокировку документа и объявляет участникам о её снятии
+func (s *WebSocketService) NotifyLockReleased(documentID, userID string, forced bool) {
+	s.locks.Release(documentID)
+	s.BroadcastToAll(documentID, wsproto.NewLockReleased(userID, forced))
+}
+
+// refreshLocks загружает действующие блокировки документа из document-сервиса
+func (s *WebSocketService) refreshLocks(sess *session) {
+	documentID := sess.documentID
+	ctx, cancel := withTimeout(sess.ctx, s.callTimeout)
+	defer cancel()
+
+	res, err := s.documentClient.GetDocumentLocks(ctx, &pb.GetDocumentLocksRequest{
+		Id: documentID,
+	})
+	if err != nil {
+		log.Printf("Error loading locks of document %s: %v", documentID, err)
 		return
 	}
 
-	// Оповещаем других пользователей о новом участнике
-	s.BroadcastToOthers(documentID, userID, map[string]interface{}{
-		"type":    "user_joined",
-		"user_id": userID,
+	locks := make([]wsproto.Lock, 0, len(res.Locks))
+	for _, lock := range res.Locks {
+		locks = append(locks, LockFromProto(lock))
+	}
+	s.locks.Set(documentID, locks)
+}
+
+// DiscardDocument отбрасывает отложенные правки удалённого документа
+func (s *WebSocketService) DiscardDocument(documentID string) {
+	s.writes.Discard(documentID)
+}
+
+// withPendingChanges дополняет документ из document-сервиса ещё не сохранёнными правками
+func (s *WebSocketService) withPendingChanges(document *pb.Document) *pb.Document {
+	title, content, ok := s.writes.Pending(document.Id)
+	if !ok {
+		return document
+	}
+
+	current := proto.Clone(document).(*pb.Document)
+	current.Title = title
+	current.Content = content
+	return current
+}
+
+// Draining сообщает, что шлюз останавливается и новые WebSocket соединения не принимаются
+func (s *WebSocketService) Draining() bool {
+	s.drainLock.Lock()
+	defer s.drainLock.Unlock()
+
+	return s.draining
+}
+
+// RestartRetryAfter возвращает, через сколько клиентам переподключаться после перезапуска
+func (s *WebSocketService) RestartRetryAfter() time.Duration {
+	return s.restartRetry
+}
+
+// Shutdown завершает WebSocket сессии перед остановкой шлюза: перестаёт принимать соединения,
+// предупреждает клиентов о перезапуске, закрывает соединения с кодом 1012 и сохраняет отложенные правки
+func (s *WebSocketService) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
 	})
 
-	// Устанавливаем отложенное действие для очистки соединения
-	defer func() {
-		conn.Close()
-		s.RemoveConnection(documentID, userID)
+	s.drainLock.Lock()
+	s.draining = true
+	s.drainLock.Unlock()
 
-		// Оповещаем других пользователей, что пользователь покинул документ
-		s.BroadcastToOthers(documentID, userID, map[string]interface{}{
-			"type":    "user_left",
-			"user_id": userID,
-		})
+	s.connectionsLock.RLock()
+	var clients []*Client
+	for _, connections := range s.documentConnections {
+		for _, client := range connections {
+			clients = append(clients, client)
+		}
+	}
+	s.connectionsLock.RUnlock()
+
+	log.Printf("Closing %d WebSocket connections", len(clients))
+	for _, client := range clients {
+		s.closeForRestart(client)
+	}
+
+	// Ждём завершения обработчиков соединений, чтобы последние правки попали в буфер
+	done := make(chan struct{})
+	go func() {
+		s.active.Wait()
+		close(done)
 	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Printf("Timed out waiting for WebSocket connections to close")
+	}
+
+	return s.writes.FlushAll(ctx)
+}
+
+// closeForRestart предупреждает клиента о перезапуске и закрывает соединение.
+// Время переподключения случайно растягивается, чтобы клиенты не вернулись одновременно.
+func (s *WebSocketService) closeForRestart(client *Client) {
+	retryAfter := s.restartRetry
+	if retryAfter > 0 {
+		retryAfter += time.Duration(rand.Int64N(int64(retryAfter)))
+	}
+
+	client.WriteJSON(wsproto.NewServerRestarting(retryAfter))
+	client.CloseWithReason(websocket.CloseServiceRestart, "server restarting")
+}
+
+// beginConnection учитывает новое соединение, если шлюз не останавливается
+func (s *WebSocketService) beginConnection() bool {
+	s.drainLock.Lock()
+	defer s.drainLock.Unlock()
+
+	if s.draining {
+		return false
+	}
+	s.active.Add(1)
+	return true
+}
+
+// withTimeout ограничивает контекст дедлайном, если timeout положительный
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// reasonDocumentLocked причина отказа document-сервиса сохранить заблокированный документ
+const reasonDocumentLocked = "DOCUMENT_LOCKED"
+
+// notifySaveFailed сообщает автору правки, что её не удалось сохранить
+func (s *WebSocketService) notifySaveFailed(documentID, userID string, err error) {
+	s.connectionsLock.RLock()
+	client, exists := s.documentConnections[documentID][userID]
+	s.connectionsLock.RUnlock()
+
+	if !exists {
+		return
+	}
+
+	st := status.Convert(err)
+	if apperrors.Reason(err) == reasonDocumentLocked {
+		client.WriteJSON(wsproto.NewError("", wsproto.ErrCodeDocumentLocked, st.Message()))
+		return
+	}
+	client.WriteJSON(wsproto.NewError("", wsproto.ErrCodeSaveFailed, "Failed to save document: "+st.Message()))
+}
+
+// session состояние подключения пользователя к документу
+type session struct {
+	// Контекст соединения, отменяется при его закрытии
+	ctx             context.Context
+	cancel          context.CancelFunc
+	documentID      string
+	userID          string
+	username        string
+	client          *Client
+	protocolVersion int
+	token           string
+	limits          *connectionLimits
+}
+
+// HandleWebSocketConnection обрабатывает WebSocket соединение после его установки.
+// ctx передаёт вызовам document-сервиса ID запроса и пользователя; сессия отменяет его при закрытии соединения.
+func (s *WebSocketService) HandleWebSocketConnection(ctx context.Context, documentID, userID, username string, conn *websocket.Conn, document *pb.Document) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sess := &session{
+		ctx:        ctx,
+		cancel:     cancel,
+		documentID: documentID,
+		userID:     userID,
+		username:   username,
+		client:     NewClient(conn, s.writeTimeout),
+		limits:     s.limiter.newConnection(),
+	}
+
+	// Соединение, принятое во время остановки, сразу закрываем
+	if !s.beginConnection() {
+		s.closeForRestart(sess.client)
+		return
+	}
+	defer s.active.Done()
+
+	// Клиент должен первым сообщением согласовать версию протокола
+	hello, version, err := s.handshake(sess)
+	if err != nil {
+		log.Printf("WebSocket handshake with user %s failed: %v", userID, err)
+		sess.client.Close()
+		return
+	}
+	sess.protocolVersion = version
+
+	s.history.Track(documentID)
+	s.refreshLocks(sess)
+	s.RegisterConnection(documentID, userID, sess.client)
+
+	// Продолжаем прерванную сессию, если клиент передал действующий токен
+	resumed := hello.Resume != nil && s.sessions.Resume(hello.Resume.SessionToken, documentID, userID, sess.client)
+	if resumed {
+		sess.token = hello.Resume.SessionToken
+		err = s.resumeSession(sess, hello.Resume.LastVersion, document)
+	} else {
+		err = s.startSession(sess, document)
+	}
+	if err != nil {
+		log.Println("Error sending initial document state:", err)
+		s.endSession(sess)
+		return
+	}
+
+	// Устанавливаем отложенное действие для очистки соединения
+	defer s.endSession(sess)
 
 	// Основной цикл обработки сообщений
 	for {
 		_, rawMessage, err := conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) && !s.Draining() {
 				log.Printf("WebSocket error: %v", err)
 			}
 			break
 		}
 
 		// Обрабатываем сообщение
-		s.handleMessage(documentID, userID, conn, rawMessage)
+		s.handleMessage(sess, rawMessage)
 	}
 }
 
-// handleMessage обрабатывает входящее WebSocket сообщение
-func (s *WebSocketService) handleMessage(documentID, userID string, conn *websocket.Conn, rawMessage []byte) {
-	// Декодируем сообщение
-	var message map[string]interface{}
-	if err := json.Unmarshal(rawMessage, &message); err != nil {
-		log.Printf("Error parsing WebSocket message: %v", err)
+// startSession открывает новую сессию, отправляет полное состояние документа и оповещает участников
+func (s *WebSocketService) startSession(sess *session, document *pb.Document) error {
+	token, err := s.sessions.Open(sess.documentID, sess.userID, sess.client)
+	if err != nil {
+		return err
+	}
+	sess.token = token
+
+	// Получаем снимок присутствия вместе с записью нового участника
+	self, snapshot := s.presence.Join(sess.documentID, sess.userID, sess.username)
+	version := s.history.Track(sess.documentID)
+
+	// Отправляем начальное состояние документа
+	if err := sess.client.WriteJSON(wsproto.NewInit(sess.protocolVersion, token, version, s.withPendingChanges(document), snapshot, s.locks.Snapshot(sess.documentID))); err != nil {
+		return err
+	}
+
+	// Оповещаем других пользователей о новом участнике
+	s.BroadcastToOthers(sess.documentID, sess.userID, wsproto.NewUserJoined(self))
+	return nil
+}
+
+// resumeSession продолжает сессию без повторного user_joined.
+// Если история не покрывает пропущенный диапазон, клиент получает полное состояние документа.
+func (s *WebSocketService) resumeSession(sess *session, lastVersion int64, document *pb.Document) error {
+	entry, restored := s.presence.Touch(sess.documentID, sess.userID, sess.username)
+	if restored {
+		s.broadcastPresence(sess, entry)
+	}
+	snapshot := s.presence.Snapshot(sess.documentID)
+
+	events, version, ok := s.history.Since(sess.documentID, lastVersion)
+	if !ok {
+		return sess.client.WriteJSON(wsproto.NewInit(sess.protocolVersion, sess.token, s.history.Track(sess.documentID), s.withPendingChanges(document), snapshot, s.locks.Snapshot(sess.documentID)))
+	}
+
+	log.Printf("User %s resumed session in document %s, replaying %d events", sess.userID, sess.documentID, len(events))
+	return sess.client.WriteJSON(wsproto.NewResumed(sess.protocolVersion, sess.token, version, events, snapshot, s.locks.Snapshot(sess.documentID)))
+}
+
+// endSession закрывает соединение и приостанавливает сессию на grace-период.
+// user_left рассылается только если клиент не переподключился.
+func (s *WebSocketService) endSession(sess *session) {
+	sess.cancel()
+	sess.client.Close()
+	s.RemoveConnection(sess.documentID, sess.userID, sess.client)
+
+	// Последний пользователь покинул документ: сохраняем правки, не дожидаясь таймеров.
+	// Контекст соединения уже отменён, сохраняем с его метаданными, но со своим дедлайном.
+	if s.GetActiveConnections(sess.documentID) == 0 {
+		ctx, cancel := withTimeout(context.WithoutCancel(sess.ctx), s.saveTimeout)
+		defer cancel()
+		if err := s.writes.Flush(ctx, sess.documentID); err != nil {
+			log.Printf("Error saving document %s: %v", sess.documentID, err)
+		}
+	}
+
+	leave := func() {
+		// Пользователь мог открыть новую сессию, не продолжив эту
+		if s.isConnected(sess.documentID, sess.userID) {
+			return
+		}
+
+		s.presence.Leave(sess.documentID, sess.userID)
+
+		// Оповещаем других пользователей, что пользователь покинул документ
+		s.BroadcastToOthers(sess.documentID, sess.userID, wsproto.NewUserLeft(sess.userID))
+
+		if s.GetActiveConnections(sess.documentID) == 0 && !s.sessions.HasDocument(sess.documentID) {
+			s.history.Forget(sess.documentID)
+			s.locks.Forget(sess.documentID)
+		}
+	}
+
+	if sess.token == "" {
+		leave()
 		return
 	}
+	s.sessions.Suspend(sess.token, sess.client, leave)
+}
+
+// handshake ожидает сообщение hello и согласовывает версию протокола
+func (s *WebSocketService) handshake(sess *session) (*wsproto.Hello, int, error) {
+	conn := sess.client.conn
+	if s.handshakeTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(s.handshakeTimeout))
+		defer conn.SetReadDeadline(time.Time{})
+	}
+
+	_, rawMessage, err := conn.ReadMessage()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read hello: %w", err)
+	}
+
+	message, protoErr := wsproto.Decode(rawMessage)
+	if protoErr != nil {
+		sess.client.WriteJSON(protoErr)
+		return nil, 0, protoErr
+	}
+
+	hello, ok := message.(*wsproto.Hello)
+	if !ok {
+		protoErr := wsproto.NewError(message.MessageID(), wsproto.ErrCodeHandshakeRequired, "the first message must be hello")
+		sess.client.WriteJSON(protoErr)
+		return nil, 0, protoErr
+	}
 
-	messageType, ok := message["type"].(string)
+	version, ok := wsproto.Negotiate(hello.ProtocolVersions)
 	if !ok {
-		log.Println("WebSocket message missing 'type' field")
+		protoErr := wsproto.NewError(hello.ID, wsproto.ErrCodeUnsupportedVersion, fmt.Sprintf(
+			"supported protocol versions are %d..%d", wsproto.MinProtocolVersion, wsproto.MaxProtocolVersion,
+		))
+		sess.client.WriteJSON(protoErr)
+		return nil, 0, protoErr
+	}
+
+	return hello, version, nil
+}
+
+// handleMessage обрабатывает входящее WebSocket сообщение
+func (s *WebSocketService) handleMessage(sess *session, rawMessage []byte) {
+	// Декодируем и проверяем сообщение
+	message, protoErr := wsproto.Decode(rawMessage)
+
+	// Некорректные сообщения тоже расходуют лимит соединения
+	if protoErr != nil {
+		if !s.allowMessage(sess, protoErr.ReplyTo, "") {
+			return
+		}
+	} else if !s.allowMessage(sess, message.MessageID(), message.MessageType()) {
 		return
 	}
 
-	log.Printf("Received WebSocket message type: %s from user %s", messageType, userID)
+	if protoErr != nil {
+		log.Printf("Invalid WebSocket message from user %s: %v", sess.userID, protoErr)
+		sess.client.WriteJSON(protoErr)
+		return
+	}
 
 	// Обрабатываем сообщение в зависимости от типа
-	switch messageType {
-	case "document_update":
-		s.handleDocumentUpdate(documentID, userID, conn, message)
+	switch message := message.(type) {
+	case *wsproto.DocumentUpdate:
+		s.touchPresence(sess)
+		s.handleDocumentUpdate(sess, message)
 
-	case "cursor_position":
+	case *wsproto.CursorPositionUpdate:
 		// Трансляция позиции курсора другим пользователям
-		s.BroadcastToOthers(documentID, userID, message)
+		entry := s.presence.UpdateCursor(sess.documentID, sess.userID, sess.username, wsproto.CursorPosition{
+			Position: *message.Position,
+		})
+		s.broadcastPresence(sess, entry)
 
-	case "selection":
+	case *wsproto.SelectionUpdate:
 		// Трансляция выделения текста другим пользователям
-		s.BroadcastToOthers(documentID, userID, message)
+		entry := s.presence.UpdateSelection(sess.documentID, sess.userID, sess.username, wsproto.SelectionRange{
+			Anchor: *message.Anchor,
+			Head:   *message.Head,
+		})
+		s.broadcastPresence(sess, entry)
+
+	case *wsproto.Ping:
+		s.touchPresence(sess)
 
-	case "ping":
 		// Отвечаем на пинг для проверки соединения
-		pongMessage := map[string]interface{}{
-			"type": "pong",
-		}
-		if err := conn.WriteJSON(pongMessage); err != nil {
+		if err := sess.client.WriteJSON(wsproto.NewPong(message.ID)); err != nil {
 			log.Printf("Error sending pong: %v", err)
 		}
 
-	default:
-		log.Printf("Unknown message type: %s", messageType)
+	case *wsproto.Hello:
+		sess.client.WriteJSON(wsproto.NewError(message.ID, wsproto.ErrCodeInvalidMessage, "protocol version is already negotiated"))
 	}
 }
 
-// handleDocumentUpdate обрабатывает обновление документа через WebSocket
-func (s *WebSocketService) handleDocumentUpdate(documentID, userID string, conn *websocket.Conn, message map[string]interface{}) {
-	content, contentOk := message["content"].(string)
-	title, titleOk := message["title"].(string)
+// allowMessage проверяет лимиты сообщения. Отклонённое сообщение порождает уведомление
+// throttled, а после слишком частых нарушений соединение разрывается.
+func (s *WebSocketService) allowMessage(sess *session, messageID string, messageType wsproto.Type) bool {
+	allowed, retryAfter := s.limiter.allow(sess.limits, sess.userID, messageType)
+	if allowed {
+		return true
+	}
 
-	if !contentOk || !titleOk {
-		log.Println("Invalid document_update message format")
-		return
+	if s.limiter.violate(sess.limits) {
+		log.Printf("User %s exceeded rate limits in document %s, closing connection", sess.userID, sess.documentID)
+		sess.client.CloseWithReason(websocket.ClosePolicyViolation, "rate limit exceeded")
+		return false
 	}
 
-	// Отправляем изменения в document-сервис
-	updateRes, err := s.documentClient.UpdateDocument(context.Background(), &pb.UpdateDocumentRequest{
-		Id:      documentID,
-		UserId:  userID,
-		Title:   title,
-		Content: content,
-	})
+	sess.client.WriteJSON(wsproto.NewThrottled(messageID, messageType, retryAfter))
+	return false
+}
 
-	if err != nil {
-		log.Printf("Error updating document: %v", err)
-		// Отправляем ошибку только отправителю
-		errorMsg := map[string]interface{}{
-			"type":  "error",
-			"error": "Failed to save document: " + err.Error(),
-		}
-		conn.WriteJSON(errorMsg)
+// touchPresence отмечает активность пользователя и восстанавливает его присутствие, если оно истекло
+func (s *WebSocketService) touchPresence(sess *session) {
+	if entry, restored := s.presence.Touch(sess.documentID, sess.userID, sess.username); restored {
+		s.broadcastPresence(sess, entry)
+	}
+}
+
+// broadcastPresence рассылает другим участникам изменение присутствия пользователя
+func (s *WebSocketService) broadcastPresence(sess *session, entry wsproto.Presence) {
+	s.BroadcastToOthers(sess.documentID, sess.userID, wsproto.NewPresenceUpdate(entry))
+}
+
+// sweepPresence периодически удаляет неактивные записи присутствия и оповещает участников,
+// пока сервис не остановлен
+func (s *WebSocketService) sweepPresence(interval time.Duration) {
+	if interval <= 0 {
 		return
 	}
 
-	if !updateRes.Success {
-		log.Printf("Document service rejected update: %s", updateRes.Error)
-		errorMsg := map[string]interface{}{
-			"type":  "error",
-			"error": "Failed to save document: " + updateRes.Error,
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case now := <-ticker.C:
+			for documentID, userIDs := range s.presence.Expire(now) {
+				for _, userID := range userIDs {
+					s.BroadcastToOthers(documentID, userID, wsproto.NewPresenceRemoved(userID))
+				}
+			}
 		}
-		conn.WriteJSON(errorMsg)
+	}
+}
+
+// handleDocumentUpdate обрабатывает обновление документа через WebSocket.
+// Правка сохраняется в document-сервис отложенно, подтверждение означает, что она принята.
+func (s *WebSocketService) handleDocumentUpdate(sess *session, message *wsproto.DocumentUpdate) {
+	// Правку заблокированного документа document-сервис всё равно отклонит при сохранении
+	if lock, locked := s.locks.HeldByOther(sess.documentID, sess.userID); locked {
+		sess.client.WriteJSON(wsproto.NewError(message.ID, wsproto.ErrCodeDocumentLocked, fmt.Sprintf(
+			"document is locked by user %s until %s", lock.OwnerID, lock.ExpiresAt.Format(time.RFC3339),
+		)))
 		return
 	}
 
-	// Если обновление успешно, транслируем изменения другим пользователям
-	s.BroadcastToOthers(documentID, userID, message)
+	s.writes.Queue(sess.documentID, sess.userID, message.Title, message.Content)
+
+	// Присваиваем изменению версию для последующего продолжения сессий
+	event := s.history.Append(sess.documentID, *wsproto.NewDocumentChanged(sess.userID, message.Title, message.Content))
+
+	// Подтверждаем приём правки отправителю
+	if message.ID != "" {
+		sess.client.WriteJSON(wsproto.NewAck(message.ID, event.Version))
+	}
+
+	// Транслируем изменения другим пользователям
+	s.BroadcastToOthers(sess.documentID, sess.userID, &event)
 }
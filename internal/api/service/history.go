@@ -0,0 +1,96 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/malaxitlmax/penfeel/internal/api/wsproto"
+)
+
+// documentHistory последние изменения документа с их версиями
+type documentHistory struct {
+	version int64
+	events  []wsproto.DocumentChanged
+}
+
+// HistoryStore хранит ограниченную историю изменений документов,
+// чтобы переподключившийся клиент получил только пропущенные изменения
+type HistoryStore struct {
+	size int
+
+	mu        sync.Mutex
+	documents map[string]*documentHistory
+}
+
+// NewHistoryStore создаёт хранилище истории, сохраняющее не более size изменений на документ
+func NewHistoryStore(size int) *HistoryStore {
+	return &HistoryStore{
+		size:      size,
+		documents: make(map[string]*documentHistory),
+	}
+}
+
+// Track начинает вести историю документа и возвращает его текущую версию
+func (h *HistoryStore) Track(documentID string) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	history, exists := h.documents[documentID]
+	if !exists {
+		history = &documentHistory{}
+		h.documents[documentID] = history
+	}
+	return history.version
+}
+
+// Append присваивает изменению следующую версию и сохраняет его.
+// Для документов без истории изменение не сохраняется, а версия равна нулю.
+func (h *HistoryStore) Append(documentID string, event wsproto.DocumentChanged) wsproto.DocumentChanged {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	history, exists := h.documents[documentID]
+	if !exists {
+		return event
+	}
+
+	history.version++
+	event.Version = history.version
+	history.events = append(history.events, event)
+	if len(history.events) > h.size {
+		history.events = history.events[len(history.events)-h.size:]
+	}
+	return event
+}
+
+// Since возвращает изменения после указанной версии.
+// ok равен false, если история не покрывает запрошенный диапазон.
+func (h *HistoryStore) Since(documentID string, version int64) (events []wsproto.DocumentChanged, current int64, ok bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	history, exists := h.documents[documentID]
+	if !exists || version > history.version {
+		return nil, 0, false
+	}
+	if version == history.version {
+		return []wsproto.DocumentChanged{}, history.version, true
+	}
+
+	// Самое старое сохранённое изменение должно следовать сразу за версией клиента
+	missed := int(history.version - version)
+	if missed > len(history.events) {
+		return nil, history.version, false
+	}
+
+	events = make([]wsproto.DocumentChanged, missed)
+	copy(events, history.events[len(history.events)-missed:])
+	return events, history.version, true
+}
+
+// Forget удаляет историю документа
+func (h *HistoryStore) Forget(documentID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.documents, documentID)
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	pb "github.com/malaxitlmax/penfeel/api/proto"
+	"github.com/malaxitlmax/penfeel/internal/api/wsproto"
+)
+
+// LockTable блокировки документов открытых сессий.
+// Позволяет отклонять правки заблокированного документа до отложенного сохранения
+// и сообщать подключившимся клиентам текущие блокировки.
+type LockTable struct {
+	mu sync.Mutex
+	// documentID -> блокировка
+	documents map[string]wsproto.Lock
+}
+
+// NewLockTable создаёт таблицу блокировок
+func NewLockTable() *LockTable {
+	return &LockTable{
+		documents: make(map[string]wsproto.Lock),
+	}
+}
+
+// Set заменяет блокировки документа
+func (t *LockTable) Set(documentID string, locks []wsproto.Lock) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.documents, documentID)
+	for _, lock := range locks {
+		t.documents[documentID] = lock
+	}
+}
+
+// Acquire сохраняет установленную или продлённую блокировку
+func (t *LockTable) Acquire(documentID string, lock wsproto.Lock) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.documents[documentID] = lock
+}
+
+// Release удаляет снятую блокировку
+func (t *LockTable) Release(documentID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.documents, documentID)
+}
+
+// Snapshot возвращает действующие блокировки документа
+func (t *LockTable) Snapshot(documentID string) []wsproto.Lock {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	locks := []wsproto.Lock{}
+	if lock, exists := t.documents[documentID]; exists && lock.ExpiresAt.After(time.Now()) {
+		locks = append(locks, lock)
+	}
+	return locks
+}
+
+// HeldByOther возвращает действующую блокировку документа, принадлежащую другому пользователю
+func (t *LockTable) HeldByOther(documentID, userID string) (wsproto.Lock, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	lock, exists := t.documents[documentID]
+	if !exists || lock.OwnerID == userID || !lock.ExpiresAt.After(time.Now()) {
+		return wsproto.Lock{}, false
+	}
+	return lock, true
+}
+
+// Forget удаляет блокировки документа, когда у него не осталось сессий
+func (t *LockTable) Forget(documentID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.documents, documentID)
+}
+
+// LockFromProto преобразует блокировку document-сервиса в сообщение протокола
+func LockFromProto(lock *pb.DocumentLock) wsproto.Lock {
+	expiresAt, _ := time.Parse(time.RFC3339, lock.ExpiresAt)
+	return wsproto.Lock{
+		OwnerID:   lock.OwnerId,
+		ExpiresAt: expiresAt,
+	}
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/malaxitlmax/penfeel/internal/api/wsproto"
+)
+
+// presenceColors палитра цветов, назначаемых участникам документа
+var presenceColors = []string{
+	"#e6194b", "#3cb44b", "#4363d8", "#f58231", "#911eb4",
+	"#42d4f4", "#f032e6", "#bfef45", "#469990", "#9a6324",
+}
+
+// PresenceTracker хранит присутствие пользователей в документах
+type PresenceTracker struct {
+	ttl time.Duration
+
+	mu sync.Mutex
+	// documentID -> map[userID]*wsproto.Presence
+	documents map[string]map[string]*wsproto.Presence
+}
+
+// NewPresenceTracker создаёт трекер присутствия с заданным временем жизни неактивных записей
+func NewPresenceTracker(ttl time.Duration) *PresenceTracker {
+	return &PresenceTracker{
+		ttl:       ttl,
+		documents: make(map[string]map[string]*wsproto.Presence),
+	}
+}
+
+// Join добавляет пользователя в документ и возвращает его запись вместе со снимком присутствия
+func (t *PresenceTracker) Join(documentID, userID, username string) (wsproto.Presence, []wsproto.Presence) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry := t.upsert(documentID, userID, username)
+	return *entry, t.snapshot(documentID)
+}
+
+// Leave удаляет пользователя из документа
+func (t *PresenceTracker) Leave(documentID, userID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entries, exists := t.documents[documentID]
+	if !exists {
+		return false
+	}
+	if _, exists := entries[userID]; !exists {
+		return false
+	}
+
+	delete(entries, userID)
+	if len(entries) == 0 {
+		delete(t.documents, documentID)
+	}
+	return true
+}
+
+// Touch обновляет время активности пользователя.
+// Если запись уже была удалена по таймауту, она создаётся заново и restored равен true.
+func (t *PresenceTracker) Touch(documentID, userID, username string) (entry wsproto.Presence, restored bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_, exists := t.documents[documentID][userID]
+	return *t.upsert(documentID, userID, username), !exists
+}
+
+// UpdateCursor сохраняет позицию курсора пользователя
+func (t *PresenceTracker) UpdateCursor(documentID, userID, username string, cursor wsproto.CursorPosition) wsproto.Presence {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry := t.upsert(documentID, userID, username)
+	entry.Cursor = &cursor
+	return *entry
+}
+
+// UpdateSelection сохраняет выделение пользователя. Пустое выделение сбрасывает его.
+func (t *PresenceTracker) UpdateSelection(documentID, userID, username string, selection wsproto.SelectionRange) wsproto.Presence {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry := t.upsert(documentID, userID, username)
+	if selection.Anchor == selection.Head {
+		entry.Selection = nil
+	} else {
+		entry.Selection = &selection
+	}
+	return *entry
+}
+
+// Snapshot возвращает полное состояние присутствия в документе
+func (t *PresenceTracker) Snapshot(documentID string) []wsproto.Presence {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.snapshot(documentID)
+}
+
+// Expire удаляет записи, неактивные дольше ttl, и возвращает их по документам
+func (t *PresenceTracker) Expire(now time.Time) map[string][]string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	expired := make(map[string][]string)
+	for documentID, entries := range t.documents {
+		for userID, entry := range entries {
+			if now.Sub(entry.LastActive) > t.ttl {
+				delete(entries, userID)
+				expired[documentID] = append(expired[documentID], userID)
+			}
+		}
+		if len(entries) == 0 {
+			delete(t.documents, documentID)
+		}
+	}
+	return expired
+}
+
+// upsert возвращает запись пользователя, создавая её при необходимости. Вызывается под мьютексом.
+func (t *PresenceTracker) upsert(documentID, userID, username string) *wsproto.Presence {
+	entries, exists := t.documents[documentID]
+	if !exists {
+		entries = make(map[string]*wsproto.Presence)
+		t.documents[documentID] = entries
+	}
+
+	entry, exists := entries[userID]
+	if !exists {
+		entry = &wsproto.Presence{
+			UserID:   userID,
+			Username: username,
+			Color:    pickColor(entries, userID),
+		}
+		entries[userID] = entry
+	}
+	entry.LastActive = time.Now()
+	return entry
+}
+
+// snapshot копирует записи документа в стабильном порядке. Вызывается под мьютексом.
+func (t *PresenceTracker) snapshot(documentID string) []wsproto.Presence {
+	entries := t.documents[documentID]
+	result := make([]wsproto.Presence, 0, len(entries))
+	for _, entry := range entries {
+		result = append(result, *entry)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].UserID < result[j].UserID
+	})
+	return result
+}
+
+// pickColor выбирает первый свободный цвет палитры, а если все заняты — цвет по хешу ID пользователя
+func pickColor(entries map[string]*wsproto.Presence, userID string) string {
+	used := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		used[entry.Color] = true
+	}
+	for _, color := range presenceColors {
+		if !used[color] {
+			return color
+		}
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(userID))
+	return presenceColors[h.Sum32()%uint32(len(presenceColors))]
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"time"
+
+	"github.com/malaxitlmax/penfeel/config"
+	"github.com/malaxitlmax/penfeel/internal/api/wsproto"
+	"github.com/malaxitlmax/penfeel/pkg/ratelimit"
+)
+
+// MessageLimiter ограничивает частоту WebSocket сообщений.
+// Общий поток сообщений и обновления присутствия считаются на соединение,
+// сохранения документа — на пользователя по всем его соединениям.
+type MessageLimiter struct {
+	cfg     config.RateLimitConfig
+	updates *ratelimit.KeyedLimiter
+}
+
+// NewMessageLimiter создаёт ограничитель WebSocket сообщений
+func NewMessageLimiter(cfg config.RateLimitConfig) *MessageLimiter {
+	return &MessageLimiter{
+		cfg:     cfg,
+		updates: ratelimit.NewKeyedLimiter(cfg.WSUpdateRate, cfg.WSUpdateBurst),
+	}
+}
+
+// connectionLimits лимиты и счётчик нарушений одного соединения
+type connectionLimits struct {
+	messages *ratelimit.Limiter
+	presence *ratelimit.Limiter
+
+	violations  int
+	windowStart time.Time
+}
+
+// newConnection создаёт лимиты для нового соединения
+func (l *MessageLimiter) newConnection() *connectionLimits {
+	return &connectionLimits{
+		messages: ratelimit.NewLimiter(l.cfg.WSMessageRate, l.cfg.WSMessageBurst),
+		presence: ratelimit.NewLimiter(l.cfg.WSPresenceRate, l.cfg.WSPresenceBurst),
+	}
+}
+
+// allow проверяет лимиты для сообщения указанного типа.
+// Пустой тип означает нераспознанное сообщение, оно учитывается только в общем лимите.
+func (l *MessageLimiter) allow(limits *connectionLimits, userID string, messageType wsproto.Type) (bool, time.Duration) {
+	if ok, retryAfter := limits.messages.Allow(); !ok {
+		return false, retryAfter
+	}
+
+	switch messageType {
+	case wsproto.TypeDocumentUpdate:
+		return l.updates.Allow(userID)
+	case wsproto.TypeCursorPosition, wsproto.TypeSelection:
+		return limits.presence.Allow()
+	}
+	return true, 0
+}
+
+// violate учитывает превышение лимита и сообщает, нужно ли разорвать соединение
+func (l *MessageLimiter) violate(limits *connectionLimits) bool {
+	if l.cfg.WSMaxViolations <= 0 {
+		return false
+	}
+
+	now := time.Now()
+	if now.Sub(limits.windowStart) > l.cfg.WSViolationWindow {
+		limits.windowStart = now
+		limits.violations = 0
+	}
+	limits.violations++
+
+	return limits.violations >= l.cfg.WSMaxViolations
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// resumableSession сессия пользователя в документе, которую можно продолжить после переподключения
+type resumableSession struct {
+	documentID string
+	userID     string
+	// Текущее соединение сессии, nil пока сессия приостановлена
+	client *Client
+	expiry *time.Timer
+}
+
+// SessionStore выдаёт токены сессий и удерживает отключившиеся сессии в течение grace-периода
+type SessionStore struct {
+	grace time.Duration
+
+	mu       sync.Mutex
+	sessions map[string]*resumableSession
+}
+
+// NewSessionStore создаёт хранилище сессий с указанным grace-периодом
+func NewSessionStore(grace time.Duration) *SessionStore {
+	return &SessionStore{
+		grace:    grace,
+		sessions: make(map[string]*resumableSession),
+	}
+}
+
+// Open создаёт новую сессию для соединения и возвращает её токен
+func (st *SessionStore) Open(documentID, userID string, client *Client) (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate session token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.sessions[token] = &resumableSession{
+		documentID: documentID,
+		userID:     userID,
+		client:     client,
+	}
+	return token, nil
+}
+
+// Resume привязывает сессию к новому соединению.
+// Сессия должна принадлежать тому же пользователю и документу.
+func (st *SessionStore) Resume(token, documentID, userID string, client *Client) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	sess, exists := st.sessions[token]
+	if !exists || sess.documentID != documentID || sess.userID != userID {
+		return false
+	}
+
+	if sess.expiry != nil {
+		sess.expiry.Stop()
+		sess.expiry = nil
+	}
+	sess.client = client
+	return true
+}
+
+// Suspend приостанавливает сессию после разрыва соединения.
+// Если за grace-период сессию не продолжат, она удаляется и вызывается onExpire.
+// Возвращает false, если сессия уже продолжена другим соединением.
+func (st *SessionStore) Suspend(token string, client *Client, onExpire func()) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	sess, exists := st.sessions[token]
+	if !exists || sess.client != client {
+		return false
+	}
+
+	sess.client = nil
+	if st.grace <= 0 {
+		delete(st.sessions, token)
+		go onExpire()
+		return true
+	}
+
+	sess.expiry = time.AfterFunc(st.grace, func() {
+		st.mu.Lock()
+		current, exists := st.sessions[token]
+		expired := exists && current == sess && sess.client == nil
+		if expired {
+			delete(st.sessions, token)
+		}
+		st.mu.Unlock()
+
+		if expired {
+			onExpire()
+		}
+	})
+	return true
+}
+
+// Close удаляет сессию без ожидания переподключения
+func (st *SessionStore) Close(token string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if sess, exists := st.sessions[token]; exists {
+		if sess.expiry != nil {
+			sess.expiry.Stop()
+		}
+		delete(st.sessions, token)
+	}
+}
+
+// HasDocument сообщает, есть ли у документа активные или приостановленные сессии
+func (st *SessionStore) HasDocument(documentID string) bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, sess := range st.sessions {
+		if sess.documentID == documentID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Ticket одноразовый билет для подключения к WebSocket.
+// Браузер не может передать заголовок Authorization при открытии WebSocket,
+// поэтому клиент сначала получает билет через REST, а затем передаёт его в query-параметре.
+type Ticket struct {
+	UserID     string
+	Username   string
+	Email      string
+	DocumentID string
+	ExpiresAt  time.Time
+}
+
+// TicketStore выдаёт и погашает короткоживущие билеты
+type TicketStore struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	tickets map[string]Ticket
+}
+
+// NewTicketStore создаёт хранилище билетов с указанным временем жизни
+func NewTicketStore(ttl time.Duration) *TicketStore {
+	return &TicketStore{
+		ttl:     ttl,
+		tickets: make(map[string]Ticket),
+	}
+}
+
+// Issue выдаёт новый билет. Пустой DocumentID разрешает подключение к любому документу пользователя.
+func (st *TicketStore) Issue(ticket Ticket) (string, time.Time, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate ticket: %w", err)
+	}
+	value := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now()
+	ticket.ExpiresAt = now.Add(st.ttl)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	// Удаляем просроченные билеты, чтобы хранилище не росло
+	for key, existing := range st.tickets {
+		if now.After(existing.ExpiresAt) {
+			delete(st.tickets, key)
+		}
+	}
+	st.tickets[value] = ticket
+
+	return value, ticket.ExpiresAt, nil
+}
+
+// Redeem погашает билет для подключения к документу. Билет можно использовать только один раз.
+func (st *TicketStore) Redeem(value, documentID string) (Ticket, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	ticket, exists := st.tickets[value]
+	if !exists {
+		return Ticket{}, false
+	}
+	delete(st.tickets, value)
+
+	if time.Now().After(ticket.ExpiresAt) {
+		return Ticket{}, false
+	}
+	if ticket.DocumentID != "" && ticket.DocumentID != documentID {
+		return Ticket{}, false
+	}
+	return ticket, true
+}
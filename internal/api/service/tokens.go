@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	pb "github.com/malaxitlmax/penfeel/api/proto"
+	"github.com/malaxitlmax/penfeel/config"
+	"github.com/malaxitlmax/penfeel/pkg/apperrors"
+	pkgauth "github.com/malaxitlmax/penfeel/pkg/auth"
+	"github.com/malaxitlmax/penfeel/pkg/revocation"
+)
+
+// Ошибки локальной проверки; причины совпадают с ответами auth-сервиса
+var (
+	errInvalidToken   = apperrors.Unauthenticated("INVALID_TOKEN", "invalid token")
+	errSessionRevoked = apperrors.Unauthenticated("SESSION_REVOKED", "session has been revoked")
+)
+
+// AuthenticatedUser пользователь, подтверждённый access токеном или персональным токеном доступа
+type AuthenticatedUser struct {
+	ID            string
+	Username      string
+	Email         string
+	EmailVerified bool
+	SessionID     string
+	// Персональный токен, которым выполнен запрос, и его права; пусты для токена сессии
+	PersonalTokenID string
+	Scopes          []string
+}
+
+// Personal сообщает, выполнен ли запрос с персональным токеном доступа
+func (u *AuthenticatedUser) Personal() bool {
+	return u.PersonalTokenID != ""
+}
+
+// TokenValidator проверяет подпись и срок действия access токена
+type TokenValidator interface {
+	ValidateToken(token string) (*pkgauth.Claims, error)
+}
+
+// cachedUser данные пользователя, полученные от auth-сервиса
+type cachedUser struct {
+	username      string
+	email         string
+	emailVerified bool
+	expiresAt     time.Time
+}
+
+// TokenVerifier проверяет access токены запросов к шлюзу.
+// Подпись проверяется по открытым ключам auth-сервиса, отзыв сессий — по списку,
+// который периодически загружается из auth-сервиса, а имя и email пользователя
+// и подтверждение email кэшируются на UserCacheTTL. В auth-сервис запрос уходит только при промахе кэша,
+// при выключенной локальной проверке или если список отозванных сессий устарел.
+type TokenVerifier struct {
+	authClient pb.AuthServiceClient
+	// nil — каждый токен проверяется в auth-сервисе
+	tokens  TokenValidator
+	cfg     config.TokenVerificationConfig
+	timeout time.Duration
+
+	// Отозванные сессии; nil, если tokens не задан
+	revocations *revocation.List
+
+	mu    sync.Mutex
+	users map[string]cachedUser
+}
+
+// NewTokenVerifier создаёт проверку токенов. Если tokens задан, запускает синхронизацию
+// отозванных сессий; timeout ограничивает каждый вызов auth-сервиса.
+func NewTokenVerifier(authClient pb.AuthServiceClient, tokens TokenValidator, cfg config.TokenVerificationConfig, timeout time.Duration) *TokenVerifier {
+	v := &TokenVerifier{
+		authClient: authClient,
+		tokens:     tokens,
+		cfg:        cfg,
+		timeout:    timeout,
+		users:      make(map[string]cachedUser),
+	}
+	if tokens != nil {
+		v.revocations = revocation.NewList(authClient, cfg, timeout)
+	}
+	return v
+}
+
+// Close останавливает синхронизацию отозванных сессий
+func (v *TokenVerifier) Close() {
+	if v.revocations != nil {
+		v.revocations.Close()
+	}
+}
+
+// Verify проверяет токен и возвращает его пользователя.
+// Ошибка — статус gRPC, как при проверке в auth-сервисе.
+func (v *TokenVerifier) Verify(ctx context.Context, token string) (*AuthenticatedUser, error) {
+	// Персональные токены не подписаны и отзываются сразу, поэтому всегда проверяются в auth-сервисе
+	if pkgauth.IsPersonalToken(token) {
+		return v.validatePersonal(ctx, token)
+	}
+
+	// Без актуального списка отозванных сессий локальная проверка пропустила бы завершённые сессии
+	if v.tokens == nil || !v.revocations.Fresh() {
+		return v.validateRemote(ctx, token)
+	}
+
+	claims, err := v.tokens.ValidateToken(token)
+	if err != nil {
+		// Открытые ключи не удалось загрузить: токен проверит auth-сервис
+		if errors.Is(err, jwt.ErrTokenUnverifiable) && !errors.Is(err, pkgauth.ErrUnknownKey) {
+			return v.validateRemote(ctx, token)
+		}
+		return nil, apperrors.ToStatus(errInvalidToken.Wrap(err))
+	}
+
+	if v.revocations.Revoked(claims.ID) {
+		return nil, apperrors.ToStatus(errSessionRevoked)
+	}
+
+	user, ok := v.cachedUser(claims.UserID)
+	if !ok {
+		// Имя и email пользователя знает только auth-сервис
+		return v.validateRemote(ctx, token)
+	}
+	user.SessionID = claims.ID
+	return user, nil
+}
+
+// validateRemote проверяет токен в auth-сервисе и кэширует данные пользователя
+func (v *TokenVerifier) validateRemote(ctx context.Context, token string) (*AuthenticatedUser, error) {
+	if v.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v.timeout)
+		defer cancel()
+	}
+
+	res, err := v.authClient.ValidateToken(ctx, &pb.ValidateTokenRequest{Token: token})
+	if err != nil {
+		return nil, err
+	}
+
+	v.cacheUser(res.User)
+	return &AuthenticatedUser{
+		ID:            res.User.Id,
+		Username:      res.User.Username,
+		Email:         res.User.Email,
+		EmailVerified: res.User.EmailVerified,
+		SessionID:     res.SessionId,
+	}, nil
+}
+
+// validatePersonal проверяет персональный токен доступа в auth-сервисе
+func (v *TokenVerifier) validatePersonal(ctx context.Context, token string) (*AuthenticatedUser, error) {
+	if v.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, v.timeout)
+		defer cancel()
+	}
+
+	res, err := v.authClient.ValidatePersonalAccessToken(ctx, &pb.ValidatePersonalAccessTokenRequest{Token: token})
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthenticatedUser{
+		ID:              res.User.Id,
+		Username:        res.User.Username,
+		Email:           res.User.Email,
+		EmailVerified:   res.User.EmailVerified,
+		PersonalTokenID: res.TokenId,
+		Scopes:          res.Scopes,
+	}, nil
+}
+
+// cachedUser возвращает данные пользователя из кэша
+func (v *TokenVerifier) cachedUser(userID string) (*AuthenticatedUser, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	cached, ok := v.users[userID]
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(cached.expiresAt) {
+		delete(v.users, userID)
+		return nil, false
+	}
+	return &AuthenticatedUser{
+		ID:            userID,
+		Username:      cached.username,
+		Email:         cached.email,
+		EmailVerified: cached.emailVerified,
+	}, true
+}
+
+// cacheUser сохраняет данные пользователя. Заполненный кэш сначала освобождается
+// от просроченных записей, затем от произвольных.
+func (v *TokenVerifier) cacheUser(user *pb.UserInfo) {
+	if v.tokens == nil || v.cfg.UserCacheSize <= 0 || user == nil {
+		return
+	}
+
+	now := time.Now()
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if _, exists := v.users[user.Id]; !exists && len(v.users) >= v.cfg.UserCacheSize {
+		for id, cached := range v.users {
+			if now.After(cached.expiresAt) {
+				delete(v.users, id)
+			}
+		}
+		for id := range v.users {
+			if len(v.users) < v.cfg.UserCacheSize {
+				break
+			}
+			delete(v.users, id)
+		}
+	}
+
+	v.users[user.Id] = cachedUser{
+		username:      user.Username,
+		email:         user.Email,
+		emailVerified: user.EmailVerified,
+		expiresAt:     now.Add(v.cfg.UserCacheTTL),
+	}
+}
+
+// ForgetUser удаляет данные пользователя из кэша, например после изменения его профиля.
+// Кэши других экземпляров шлюза обновятся по истечении UserCacheTTL.
+func (v *TokenVerifier) ForgetUser(userID string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.users, userID)
+}
+
+// AuthJWKSFetcher загружает открытые ключи подписи токенов из auth-сервиса
+func AuthJWKSFetcher(authClient pb.AuthServiceClient) pkgauth.JWKSFetcher {
+	return func(ctx context.Context) (*pkgauth.JWKS, error) {
+		res, err := authClient.GetJWKS(ctx, &pb.GetJWKSRequest{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+		}
+		jwks := JWKSFromProto(res.Keys)
+		return &jwks, nil
+	}
+}
+
+// JWKSFromProto преобразует ключи из ответа auth-сервиса в JWKS
+func JWKSFromProto(keys []*pb.JWK) pkgauth.JWKS {
+	jwks := pkgauth.JWKS{Keys: make([]pkgauth.JWK, 0, len(keys))}
+	for _, key := range keys {
+		jwks.Keys = append(jwks.Keys, pkgauth.JWK{
+			KeyID:     key.Kid,
+			KeyType:   key.Kty,
+			Algorithm: key.Alg,
+			Use:       key.Use,
+			N:         key.N,
+			E:         key.E,
+			Curve:     key.Crv,
+			X:         key.X,
+		})
+	}
+	return jwks
+}
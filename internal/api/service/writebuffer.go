@@ -0,0 +1,258 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	pb "github.com/malaxitlmax/penfeel/api/proto"
+	"github.com/malaxitlmax/penfeel/pkg/requestmeta"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxFlushAttempts число попыток сохранить изменение, после которого оно отбрасывается
+const maxFlushAttempts = 5
+
+// pendingWrite последнее несохранённое состояние документа.
+// Каждое обновление содержит документ целиком, поэтому из серии правок достаточно сохранить последнюю.
+type pendingWrite struct {
+	userID   string
+	title    string
+	content  string
+	attempts int
+}
+
+// bufferedDocument буфер записи одного документа
+type bufferedDocument struct {
+	// Сериализует сохранения документа, чтобы старое состояние не перезаписало новое
+	flushLock sync.Mutex
+
+	pending *pendingWrite
+	// Состояние, которое сохраняется прямо сейчас
+	saving *pendingWrite
+	// Сохранение после паузы в правках и не позднее интервала с первой несохранённой правки
+	idle     *time.Timer
+	deadline *time.Timer
+}
+
+// stopTimers отменяет запланированные сохранения
+func (d *bufferedDocument) stopTimers() {
+	if d.idle != nil {
+		d.idle.Stop()
+		d.idle = nil
+	}
+	if d.deadline != nil {
+		d.deadline.Stop()
+		d.deadline = nil
+	}
+}
+
+// WriteBuffer откладывает сохранение правок документов и объединяет частые правки в одну запись.
+// Документ сохраняется после паузы в правках, не позднее интервала с первой несохранённой правки
+// и по явному вызову Flush, например когда документ покидает последний пользователь.
+type WriteBuffer struct {
+	documentClient pb.DocumentServiceClient
+	interval       time.Duration
+	idleDelay      time.Duration
+	// Дедлайн сохранения по таймеру
+	timeout time.Duration
+	// Вызывается, когда правку не удалось сохранить и она отброшена
+	onError func(documentID, userID string, err error)
+
+	mu        sync.Mutex
+	documents map[string]*bufferedDocument
+}
+
+// NewWriteBuffer создаёт буфер записи. Неположительные interval и idleDelay
+// отключают соответствующий таймер; если отключены оба, правки сохраняются сразу.
+// timeout ограничивает сохранение по таймеру.
+func NewWriteBuffer(documentClient pb.DocumentServiceClient, interval, idleDelay, timeout time.Duration, onError func(documentID, userID string, err error)) *WriteBuffer {
+	return &WriteBuffer{
+		documentClient: documentClient,
+		interval:       interval,
+		idleDelay:      idleDelay,
+		timeout:        timeout,
+		onError:        onError,
+		documents:      make(map[string]*bufferedDocument),
+	}
+}
+
+// Queue ставит состояние документа в очередь на сохранение, заменяя несохранённое
+func (b *WriteBuffer) Queue(documentID, userID, title, content string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	doc, exists := b.documents[documentID]
+	if !exists {
+		doc = &bufferedDocument{}
+		b.documents[documentID] = doc
+	}
+	doc.pending = &pendingWrite{userID: userID, title: title, content: content}
+
+	if b.interval <= 0 && b.idleDelay <= 0 {
+		go b.flushInBackground(documentID)
+		return
+	}
+
+	if b.idleDelay > 0 {
+		if doc.idle != nil {
+			doc.idle.Stop()
+		}
+		doc.idle = time.AfterFunc(b.idleDelay, func() { b.flushInBackground(documentID) })
+	}
+	if b.interval > 0 && doc.deadline == nil {
+		doc.deadline = time.AfterFunc(b.interval, func() { b.flushInBackground(documentID) })
+	}
+}
+
+// Flush сохраняет несохранённое состояние документа
+func (b *WriteBuffer) Flush(ctx context.Context, documentID string) error {
+	b.mu.Lock()
+	doc, exists := b.documents[documentID]
+	b.mu.Unlock()
+	if !exists {
+		return nil
+	}
+
+	doc.flushLock.Lock()
+	defer doc.flushLock.Unlock()
+
+	b.mu.Lock()
+	write := doc.pending
+	doc.pending = nil
+	doc.saving = write
+	doc.stopTimers()
+	b.mu.Unlock()
+
+	var err error
+	if write != nil {
+		err = b.save(ctx, documentID, write)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	doc.saving = nil
+	if err != nil {
+		write.attempts++
+		switch {
+		case doc.pending != nil:
+			// Более новая правка заменит несохранённую
+		case b.documents[documentID] != doc:
+			// Правки документа отброшены во время сохранения
+		case write.attempts >= maxFlushAttempts || !retryable(err):
+			log.Printf("Dropping unsaved changes of document %s after %d attempts: %v", documentID, write.attempts, err)
+			if b.onError != nil {
+				go b.onError(documentID, write.userID, err)
+			}
+		default:
+			// Возвращаем правку в буфер и повторяем попытку позже
+			doc.pending = write
+			b.scheduleRetry(documentID, doc)
+		}
+	}
+
+	if doc.pending == nil && b.documents[documentID] == doc {
+		delete(b.documents, documentID)
+	}
+	return err
+}
+
+// FlushAll сохраняет несохранённые состояния всех документов
+func (b *WriteBuffer) FlushAll(ctx context.Context) error {
+	b.mu.Lock()
+	documentIDs := make([]string, 0, len(b.documents))
+	for documentID := range b.documents {
+		documentIDs = append(documentIDs, documentID)
+	}
+	b.mu.Unlock()
+
+	var errs []error
+	for _, documentID := range documentIDs {
+		if err := b.Flush(ctx, documentID); err != nil {
+			errs = append(errs, fmt.Errorf("document %s: %w", documentID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Pending возвращает несохранённое состояние документа, включая сохраняемое в данный момент
+func (b *WriteBuffer) Pending(documentID string) (title, content string, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	doc, exists := b.documents[documentID]
+	if !exists {
+		return "", "", false
+	}
+
+	write := doc.pending
+	if write == nil {
+		write = doc.saving
+	}
+	if write == nil {
+		return "", "", false
+	}
+	return write.title, write.content, true
+}
+
+// Discard отбрасывает несохранённое состояние документа, например после его удаления
+func (b *WriteBuffer) Discard(documentID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if doc, exists := b.documents[documentID]; exists {
+		doc.pending = nil
+		doc.stopTimers()
+		delete(b.documents, documentID)
+	}
+}
+
+// scheduleRetry планирует повторное сохранение. Вызывается под мьютексом.
+func (b *WriteBuffer) scheduleRetry(documentID string, doc *bufferedDocument) {
+	delay := b.interval
+	if delay <= 0 {
+		delay = b.idleDelay
+	}
+	if delay <= 0 {
+		delay = time.Second
+	}
+	doc.deadline = time.AfterFunc(delay, func() { b.flushInBackground(documentID) })
+}
+
+// retryable сообщает, может ли повторная попытка сохранить документ.
+// Отказ document-сервиса по существу запроса, например из-за блокировки, повторять бесполезно.
+// Отменённое вместе с запросом сохранение повторяется по таймеру.
+func retryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled, codes.ResourceExhausted, codes.Internal, codes.Unknown:
+		return true
+	default:
+		return false
+	}
+}
+
+// flushInBackground сохраняет документ по таймеру
+func (b *WriteBuffer) flushInBackground(documentID string) {
+	ctx, cancel := withTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	if err := b.Flush(ctx, documentID); err != nil {
+		log.Printf("Error saving document %s: %v", documentID, err)
+	}
+}
+
+// save отправляет состояние документа в document-сервис от имени автора правки
+func (b *WriteBuffer) save(ctx context.Context, documentID string, write *pendingWrite) error {
+	ctx = requestmeta.WithUserID(ctx, write.userID)
+	_, err := b.documentClient.UpdateDocument(ctx, &pb.UpdateDocumentRequest{
+		Id:      documentID,
+		Title:   write.title,
+		Content: write.content,
+	})
+	return err
+}
@@ -0,0 +1,424 @@
+package wsproto
+
+import (
+	"errors"
+	"time"
+
+	pb "github.com/malaxitlmax/penfeel/api/proto"
+)
+
+// CursorPosition позиция курсора пользователя в документе
+type CursorPosition struct {
+	Position int `json:"position"`
+}
+
+// SelectionRange выделенный пользователем фрагмент текста
+type SelectionRange struct {
+	Anchor int `json:"anchor"`
+	Head   int `json:"head"`
+}
+
+// Presence состояние присутствия пользователя в документе
+type Presence struct {
+	UserID     string          `json:"user_id"`
+	Username   string          `json:"username"`
+	Color      string          `json:"color"`
+	Cursor     *CursorPosition `json:"cursor,omitempty"`
+	Selection  *SelectionRange `json:"selection,omitempty"`
+	LastActive time.Time       `json:"last_active"`
+}
+
+// ResumeRequest данные для продолжения сессии после переподключения
+type ResumeRequest struct {
+	SessionToken string `json:"session_token"`
+	LastVersion  int64  `json:"last_version"`
+}
+
+// Hello первое сообщение клиента со списком поддерживаемых версий протокола.
+// Переподключившийся клиент передаёт токен сессии и последнюю подтверждённую версию.
+type Hello struct {
+	Envelope
+	ProtocolVersions []int          `json:"protocol_versions"`
+	Resume           *ResumeRequest `json:"resume,omitempty"`
+}
+
+// Validate проверяет сообщение
+func (m *Hello) Validate() error {
+	if len(m.ProtocolVersions) == 0 {
+		return errors.New("protocol_versions must not be empty")
+	}
+	if m.Resume != nil && (m.Resume.SessionToken == "" || m.Resume.LastVersion < 0) {
+		return errors.New("resume requires session_token and a non-negative last_version")
+	}
+	return nil
+}
+
+// DocumentUpdate изменение документа, отправленное клиентом
+type DocumentUpdate struct {
+	Envelope
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// Validate проверяет сообщение
+func (m *DocumentUpdate) Validate() error {
+	if m.Title == "" {
+		return errors.New("title is required")
+	}
+	return nil
+}
+
+// CursorPositionUpdate перемещение курсора клиента
+type CursorPositionUpdate struct {
+	Envelope
+	Position *int `json:"position"`
+}
+
+// Validate проверяет сообщение
+func (m *CursorPositionUpdate) Validate() error {
+	if m.Position == nil || *m.Position < 0 {
+		return errors.New("position must be a non-negative integer")
+	}
+	return nil
+}
+
+// SelectionUpdate изменение выделения клиента. Совпадающие anchor и head сбрасывают выделение.
+type SelectionUpdate struct {
+	Envelope
+	Anchor *int `json:"anchor"`
+	Head   *int `json:"head"`
+}
+
+// Validate проверяет сообщение
+func (m *SelectionUpdate) Validate() error {
+	if m.Anchor == nil || m.Head == nil || *m.Anchor < 0 || *m.Head < 0 {
+		return errors.New("anchor and head must be non-negative integers")
+	}
+	return nil
+}
+
+// Ping проверка соединения
+type Ping struct {
+	Envelope
+}
+
+// Validate проверяет сообщение
+func (m *Ping) Validate() error {
+	return nil
+}
+
+// Lock блокировка документа одним пользователем
+type Lock struct {
+	OwnerID   string    `json:"owner_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Init начальное состояние документа, отправляемое после рукопожатия
+type Init struct {
+	Envelope
+	ProtocolVersion int          `json:"protocol_version"`
+	SessionToken    string       `json:"session_token"`
+	Version         int64        `json:"version"`
+	Document        *pb.Document `json:"document"`
+	Presence        []Presence   `json:"presence"`
+	Locks           []Lock       `json:"locks"`
+}
+
+// NewInit создаёт сообщение с начальным состоянием документа
+func NewInit(protocolVersion int, sessionToken string, version int64, document *pb.Document, presence []Presence, locks []Lock) *Init {
+	return &Init{
+		Envelope:        Envelope{Type: TypeInit},
+		ProtocolVersion: protocolVersion,
+		SessionToken:    sessionToken,
+		Version:         version,
+		Document:        document,
+		Presence:        presence,
+		Locks:           locks,
+	}
+}
+
+// Resumed ответ на продолжение сессии: только пропущенные изменения и текущее присутствие
+type Resumed struct {
+	Envelope
+	ProtocolVersion int               `json:"protocol_version"`
+	SessionToken    string            `json:"session_token"`
+	Version         int64             `json:"version"`
+	Events          []DocumentChanged `json:"events"`
+	Presence        []Presence        `json:"presence"`
+	Locks           []Lock            `json:"locks"`
+}
+
+// NewResumed создаёт ответ на продолжение сессии
+func NewResumed(protocolVersion int, sessionToken string, version int64, events []DocumentChanged, presence []Presence, locks []Lock) *Resumed {
+	return &Resumed{
+		Envelope:        Envelope{Type: TypeResumed},
+		ProtocolVersion: protocolVersion,
+		SessionToken:    sessionToken,
+		Version:         version,
+		Events:          events,
+		Presence:        presence,
+		Locks:           locks,
+	}
+}
+
+// Ack подтверждение обработки сообщения клиента.
+// Для изменений документа содержит присвоенную версию.
+type Ack struct {
+	Envelope
+	ReplyTo string `json:"reply_to"`
+	Version int64  `json:"version,omitempty"`
+}
+
+// NewAck создаёт подтверждение для сообщения с указанным ID
+func NewAck(replyTo string, version int64) *Ack {
+	return &Ack{
+		Envelope: Envelope{Type: TypeAck},
+		ReplyTo:  replyTo,
+		Version:  version,
+	}
+}
+
+// Error ошибка обработки сообщения клиента
+type Error struct {
+	Envelope
+	ReplyTo string    `json:"reply_to,omitempty"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// NewError создаёт сообщение об ошибке
+func NewError(replyTo string, code ErrorCode, message string) *Error {
+	return &Error{
+		Envelope: Envelope{Type: TypeError},
+		ReplyTo:  replyTo,
+		Code:     code,
+		Message:  message,
+	}
+}
+
+// Error реализует интерфейс error
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// Throttled сообщение клиента отклонено из-за превышения лимита.
+// Клиенту следует повторить его не раньше чем через RetryAfterMs миллисекунд.
+type Throttled struct {
+	Envelope
+	ReplyTo      string `json:"reply_to,omitempty"`
+	MessageType  Type   `json:"message_type"`
+	RetryAfterMs int64  `json:"retry_after_ms"`
+}
+
+// NewThrottled создаёт уведомление об отклонённом сообщении
+func NewThrottled(replyTo string, messageType Type, retryAfter time.Duration) *Throttled {
+	return &Throttled{
+		Envelope:     Envelope{Type: TypeThrottled},
+		ReplyTo:      replyTo,
+		MessageType:  messageType,
+		RetryAfterMs: retryAfter.Milliseconds(),
+	}
+}
+
+// ServerRestarting сервер перезапускается и закроет соединение с кодом 1012.
+// Клиенту следует переподключиться и продолжить сессию через RetryAfterMs миллисекунд.
+type ServerRestarting struct {
+	Envelope
+	RetryAfterMs int64 `json:"retry_after_ms"`
+}
+
+// NewServerRestarting создаёт уведомление о перезапуске сервера
+func NewServerRestarting(retryAfter time.Duration) *ServerRestarting {
+	return &ServerRestarting{
+		Envelope:     Envelope{Type: TypeServerRestarting},
+		RetryAfterMs: retryAfter.Milliseconds(),
+	}
+}
+
+// Pong ответ на ping
+type Pong struct {
+	Envelope
+	ReplyTo string `json:"reply_to,omitempty"`
+}
+
+// NewPong создаёт ответ на ping
+func NewPong(replyTo string) *Pong {
+	return &Pong{
+		Envelope: Envelope{Type: TypePong},
+		ReplyTo:  replyTo,
+	}
+}
+
+// UserJoined уведомление о подключении участника
+type UserJoined struct {
+	Envelope
+	UserID   string   `json:"user_id"`
+	Presence Presence `json:"presence"`
+}
+
+// NewUserJoined создаёт уведомление о подключении участника
+func NewUserJoined(presence Presence) *UserJoined {
+	return &UserJoined{
+		Envelope: Envelope{Type: TypeUserJoined},
+		UserID:   presence.UserID,
+		Presence: presence,
+	}
+}
+
+// UserLeft уведомление об отключении участника
+type UserLeft struct {
+	Envelope
+	UserID string `json:"user_id"`
+}
+
+// NewUserLeft создаёт уведомление об отключении участника
+func NewUserLeft(userID string) *UserLeft {
+	return &UserLeft{
+		Envelope: Envelope{Type: TypeUserLeft},
+		UserID:   userID,
+	}
+}
+
+// PresenceUpdate изменение присутствия участника
+type PresenceUpdate struct {
+	Envelope
+	Presence Presence `json:"presence"`
+}
+
+// NewPresenceUpdate создаёт сообщение об изменении присутствия
+func NewPresenceUpdate(presence Presence) *PresenceUpdate {
+	return &PresenceUpdate{
+		Envelope: Envelope{Type: TypePresenceUpdate},
+		Presence: presence,
+	}
+}
+
+// PresenceRemoved удаление неактивного участника из присутствия
+type PresenceRemoved struct {
+	Envelope
+	UserID string `json:"user_id"`
+}
+
+// NewPresenceRemoved создаёт сообщение об удалении присутствия
+func NewPresenceRemoved(userID string) *PresenceRemoved {
+	return &PresenceRemoved{
+		Envelope: Envelope{Type: TypePresenceRemoved},
+		UserID:   userID,
+	}
+}
+
+// DocumentChanged изменение документа другим участником
+type DocumentChanged struct {
+	Envelope
+	Version int64  `json:"version"`
+	UserID  string `json:"user_id"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+// NewDocumentChanged создаёт сообщение об изменении документа участником
+func NewDocumentChanged(userID, title, content string) *DocumentChanged {
+	return &DocumentChanged{
+		Envelope: Envelope{Type: TypeDocumentChanged},
+		UserID:   userID,
+		Title:    title,
+		Content:  content,
+	}
+}
+
+// DocumentUpdatedExternally изменение документа через REST API
+type DocumentUpdatedExternally struct {
+	Envelope
+	Version  int64        `json:"version"`
+	UserID   string       `json:"user_id"`
+	Document *pb.Document `json:"document"`
+}
+
+// NewDocumentUpdatedExternally создаёт сообщение об изменении документа через REST API
+func NewDocumentUpdatedExternally(version int64, userID string, document *pb.Document) *DocumentUpdatedExternally {
+	return &DocumentUpdatedExternally{
+		Envelope: Envelope{Type: TypeDocumentUpdatedExternally},
+		Version:  version,
+		UserID:   userID,
+		Document: document,
+	}
+}
+
+// DocumentDeleted уведомление об удалении документа
+type DocumentDeleted struct {
+	Envelope
+	UserID string `json:"user_id"`
+}
+
+// NewDocumentDeleted создаёт уведомление об удалении документа
+func NewDocumentDeleted(userID string) *DocumentDeleted {
+	return &DocumentDeleted{
+		Envelope: Envelope{Type: TypeDocumentDeleted},
+		UserID:   userID,
+	}
+}
+
+// LockAcquired пользователь заблокировал документ или секцию либо продлил блокировку
+type LockAcquired struct {
+	Envelope
+	Lock Lock `json:"lock"`
+}
+
+// NewLockAcquired создаёт уведомление об установке блокировки
+func NewLockAcquired(lock Lock) *LockAcquired {
+	return &LockAcquired{
+		Envelope: Envelope{Type: TypeLockAcquired},
+		Lock:     lock,
+	}
+}
+
+// LockReleased блокировка снята. Forced означает, что её принудительно снял владелец документа.
+type LockReleased struct {
+	Envelope
+	UserID string `json:"user_id"`
+	Forced bool   `json:"forced"`
+}
+
+// NewLockReleased создаёт уведомление о снятии блокировки
+func NewLockReleased(userID string, forced bool) *LockReleased {
+	return &LockReleased{
+		Envelope: Envelope{Type: TypeLockReleased},
+		UserID:   userID,
+		Forced:   forced,
+	}
+}
+
+// Schema связывает тип сообщения с его структурой для генерации клиентских типов
+type Schema struct {
+	Type    Type
+	Message interface{}
+}
+
+// ClientSchema сообщения, которые клиент отправляет серверу
+var ClientSchema = []Schema{
+	{TypeHello, Hello{}},
+	{TypeDocumentUpdate, DocumentUpdate{}},
+	{TypeCursorPosition, CursorPositionUpdate{}},
+	{TypeSelection, SelectionUpdate{}},
+	{TypePing, Ping{}},
+}
+
+// ServerSchema сообщения, которые сервер отправляет клиенту
+var ServerSchema = []Schema{
+	{TypeInit, Init{}},
+	{TypeResumed, Resumed{}},
+	{TypeAck, Ack{}},
+	{TypeError, Error{}},
+	{TypePong, Pong{}},
+	{TypeUserJoined, UserJoined{}},
+	{TypeUserLeft, UserLeft{}},
+	{TypePresenceUpdate, PresenceUpdate{}},
+	{TypePresenceRemoved, PresenceRemoved{}},
+	{TypeDocumentChanged, DocumentChanged{}},
+	{TypeDocumentUpdatedExternally, DocumentUpdatedExternally{}},
+	{TypeDocumentDeleted, DocumentDeleted{}},
+	{TypeThrottled, Throttled{}},
+	{TypeServerRestarting, ServerRestarting{}},
+	{TypeLockAcquired, LockAcquired{}},
+	{TypeLockReleased, LockReleased{}},
+}
@@ -0,0 +1,150 @@
+// Package wsproto описывает протокол WebSocket сообщений между клиентом и API Gateway.
+//
+// Go-структуры этого пакета являются схемой протокола: TypeScript-типы для клиента
+// генерируются из них командой cmd/wsproto-ts (make ws-types).
+package wsproto
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Поддерживаемые версии протокола
+const (
+	MinProtocolVersion = 1
+	MaxProtocolVersion = 1
+)
+
+// Подпротоколы WebSocket. Клиент обязан запросить Subprotocol и может передать
+// access-токен вторым подпротоколом вида "access_token.<jwt>", так как браузер
+// не позволяет задать заголовок Authorization при открытии WebSocket.
+const (
+	Subprotocol            = "penfeel"
+	TokenSubprotocolPrefix = "access_token."
+)
+
+// Type тип WebSocket сообщения
+type Type string
+
+// Сообщения клиента
+const (
+	TypeHello          Type = "hello"
+	TypeDocumentUpdate Type = "document_update"
+	TypeCursorPosition Type = "cursor_position"
+	TypeSelection      Type = "selection"
+	TypePing           Type = "ping"
+)
+
+// Сообщения сервера
+const (
+	TypeInit                      Type = "init"
+	TypeResumed                   Type = "resumed"
+	TypeAck                       Type = "ack"
+	TypeError                     Type = "error"
+	TypePong                      Type = "pong"
+	TypeUserJoined                Type = "user_joined"
+	TypeUserLeft                  Type = "user_left"
+	TypePresenceUpdate            Type = "presence_update"
+	TypePresenceRemoved           Type = "presence_removed"
+	TypeDocumentChanged           Type = "document_changed"
+	TypeDocumentUpdatedExternally Type = "document_updated_externally"
+	TypeDocumentDeleted           Type = "document_deleted"
+	TypeThrottled                 Type = "throttled"
+	TypeServerRestarting          Type = "server_restarting"
+	TypeLockAcquired              Type = "lock_acquired"
+	TypeLockReleased              Type = "lock_released"
+)
+
+// ErrorCode код ошибки протокола
+type ErrorCode string
+
+// Коды ошибок, передаваемые клиенту
+const (
+	ErrCodeInvalidMessage     ErrorCode = "invalid_message"
+	ErrCodeUnknownType        ErrorCode = "unknown_type"
+	ErrCodeHandshakeRequired  ErrorCode = "handshake_required"
+	ErrCodeUnsupportedVersion ErrorCode = "unsupported_version"
+	ErrCodeSaveFailed         ErrorCode = "save_failed"
+	ErrCodeDocumentLocked     ErrorCode = "document_locked"
+)
+
+// ErrorCodes все коды ошибок протокола
+var ErrorCodes = []ErrorCode{
+	ErrCodeInvalidMessage,
+	ErrCodeUnknownType,
+	ErrCodeHandshakeRequired,
+	ErrCodeUnsupportedVersion,
+	ErrCodeSaveFailed,
+	ErrCodeDocumentLocked,
+}
+
+// Envelope общие поля всех сообщений.
+// ID задаётся клиентом и возвращается сервером в поле reply_to подтверждений и ошибок.
+type Envelope struct {
+	Type Type   `json:"type"`
+	ID   string `json:"id,omitempty"`
+}
+
+// clientMessages фабрики сообщений, которые сервер принимает от клиента
+var clientMessages = map[Type]func() Message{
+	TypeHello:          func() Message { return &Hello{} },
+	TypeDocumentUpdate: func() Message { return &DocumentUpdate{} },
+	TypeCursorPosition: func() Message { return &CursorPositionUpdate{} },
+	TypeSelection:      func() Message { return &SelectionUpdate{} },
+	TypePing:           func() Message { return &Ping{} },
+}
+
+// Message входящее сообщение клиента
+type Message interface {
+	MessageID() string
+	MessageType() Type
+	Validate() error
+}
+
+// MessageID возвращает идентификатор сообщения для корреляции ответов
+func (e Envelope) MessageID() string {
+	return e.ID
+}
+
+// MessageType возвращает тип сообщения
+func (e Envelope) MessageType() Type {
+	return e.Type
+}
+
+// Decode разбирает и проверяет входящее сообщение клиента.
+// При ошибке возвращается готовое к отправке сообщение об ошибке.
+func Decode(raw []byte) (Message, *Error) {
+	var envelope Envelope
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, NewError("", ErrCodeInvalidMessage, "message must be a JSON object")
+	}
+	if envelope.Type == "" {
+		return nil, NewError(envelope.ID, ErrCodeInvalidMessage, "message is missing the 'type' field")
+	}
+
+	factory, exists := clientMessages[envelope.Type]
+	if !exists {
+		return nil, NewError(envelope.ID, ErrCodeUnknownType, fmt.Sprintf("unknown message type %q", envelope.Type))
+	}
+
+	message := factory()
+	if err := json.Unmarshal(raw, message); err != nil {
+		return nil, NewError(envelope.ID, ErrCodeInvalidMessage, fmt.Sprintf("invalid %s message: %v", envelope.Type, err))
+	}
+	if err := message.Validate(); err != nil {
+		return nil, NewError(envelope.ID, ErrCodeInvalidMessage, fmt.Sprintf("invalid %s message: %v", envelope.Type, err))
+	}
+
+	return message, nil
+}
+
+// Negotiate выбирает наибольшую версию протокола, поддерживаемую и клиентом, и сервером
+func Negotiate(versions []int) (int, bool) {
+	selected := 0
+	for _, version := range versions {
+		if version >= MinProtocolVersion && version <= MaxProtocolVersion && version > selected {
+			selected = version
+		}
+	}
+	return selected, selected != 0
+}
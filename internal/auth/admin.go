@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"context"
+
+	pb "github.com/malaxitlmax/penfeel/api/proto"
+	"github.com/malaxitlmax/penfeel/pkg/apperrors"
+	"github.com/malaxitlmax/penfeel/pkg/grpctls"
+	"google.golang.org/grpc"
+)
+
+// adminMethods методы, которые шлюз не публикует и которые доступны только администраторам
+var adminMethods = map[string]bool{
+	pb.AuthService_AdminUnlockLogin_FullMethodName: true,
+}
+
+// AdminUnaryInterceptor разрешает административные методы только клиентам, подключившимся
+// с сертификатом CA, CommonName которого входит в clients. Без mutual TLS или с пустым
+// списком административные методы недоступны.
+func AdminUnaryInterceptor(clients []string) grpc.UnaryServerInterceptor {
+	allowed := make(map[string]bool, len(clients))
+	for _, client := range clients {
+		allowed[client] = true
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if adminMethods[info.FullMethod] {
+			name, ok := grpctls.PeerName(ctx)
+			if !ok || !allowed[name] {
+				return nil, apperrors.ToStatus(ErrAdminRequired)
+			}
+		}
+		return handler(ctx, req)
+	}
+}
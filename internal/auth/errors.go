@@ -0,0 +1,116 @@
+package auth
+
+import "github.com/malaxitlmax/penfeel/pkg/apperrors"
+
+var (
+	// ErrUserNotFound ошибка, когда пользователь не найден
+	ErrUserNotFound = apperrors.NotFound("USER_NOT_FOUND", "user not found")
+	// ErrEmailTaken пользователь с таким email уже зарегистрирован
+	ErrEmailTaken = apperrors.AlreadyExists("EMAIL_TAKEN", "user with this email already exists")
+	// ErrUsernameTaken пользователь с таким именем уже зарегистрирован
+	ErrUsernameTaken = apperrors.AlreadyExists("USERNAME_TAKEN", "user with this username already exists")
+	// ErrInvalidCredentials неверный email или пароль
+	ErrInvalidCredentials = apperrors.Unauthenticated("INVALID_CREDENTIALS", "invalid email or password")
+	// ErrInvalidToken токен не прошёл проверку
+	ErrInvalidToken = apperrors.Unauthenticated("INVALID_TOKEN", "invalid token")
+	// ErrInvalidRefreshToken refresh токен не прошёл проверку, истёк или отозван
+	ErrInvalidRefreshToken = apperrors.Unauthenticated("INVALID_REFRESH_TOKEN", "invalid refresh token")
+	// ErrRefreshTokenReused refresh токен предъявлен повторно, его сессия отозвана
+	ErrRefreshTokenReused = apperrors.Unauthenticated("REFRESH_TOKEN_REUSED", "refresh token has already been used")
+	// ErrRefreshTokenNotFound refresh токен не найден в хранилище
+	ErrRefreshTokenNotFound = apperrors.NotFound("REFRESH_TOKEN_NOT_FOUND", "refresh token not found")
+	// ErrSessionRevoked сессия токена завершена или истекла
+	ErrSessionRevoked = apperrors.Unauthenticated("SESSION_REVOKED", "session has been revoked")
+	// ErrSessionNotFound у пользователя нет такой действующей сессии
+	ErrSessionNotFound = apperrors.NotFound("SESSION_NOT_FOUND", "session not found")
+	// ErrInvalidSessionID идентификатор сессии не является UUID
+	ErrInvalidSessionID = apperrors.InvalidArgument("session_id", "invalid session ID")
+	// ErrInvalidRevokedAfter время в запросе отозванных сессий не в формате RFC 3339
+	ErrInvalidRevokedAfter = apperrors.InvalidArgument("revoked_after", "invalid revoked_after time")
+	// ErrInvalidResetToken токен сброса пароля не найден, истёк или уже использован
+	ErrInvalidResetToken = apperrors.Unauthenticated("INVALID_RESET_TOKEN", "invalid or expired password reset token")
+	// ErrInvalidVerificationToken токен подтверждения email не найден, истёк или уже использован
+	ErrInvalidVerificationToken = apperrors.Unauthenticated("INVALID_VERIFICATION_TOKEN", "invalid or expired email verification token")
+	// ErrEmailNotVerified вход запрещён до подтверждения email
+	ErrEmailNotVerified = apperrors.PermissionDenied("EMAIL_NOT_VERIFIED", "email address is not verified")
+	// ErrTwoFactorAlreadyEnabled двухфакторная аутентификация уже включена
+	ErrTwoFactorAlreadyEnabled = apperrors.Conflict("TWO_FACTOR_ALREADY_ENABLED", "two-factor authentication is already enabled")
+	// ErrTwoFactorNotSetUp настройка двухфакторной аутентификации не начата
+	ErrTwoFactorNotSetUp = apperrors.Conflict("TWO_FACTOR_NOT_SET_UP", "two-factor authentication setup has not been started")
+	// ErrTwoFactorNotEnabled двухфакторная аутентификация не включена
+	ErrTwoFactorNotEnabled = apperrors.Conflict("TWO_FACTOR_NOT_ENABLED", "two-factor authentication is not enabled")
+	// ErrInvalidTwoFactorCode неверный или уже использованный код TOTP или код восстановления
+	ErrInvalidTwoFactorCode = apperrors.Unauthenticated("INVALID_TWO_FACTOR_CODE", "invalid two-factor authentication code")
+	// ErrInvalidLoginChallenge токен второго шага входа не найден, истёк, использован или исчерпал попытки
+	ErrInvalidLoginChallenge = apperrors.Unauthenticated("INVALID_LOGIN_CHALLENGE", "invalid or expired login challenge")
+	// ErrTooManyLoginAttempts слишком много неудачных попыток входа подряд, нужно подождать
+	ErrTooManyLoginAttempts = apperrors.TooManyRequests("TOO_MANY_LOGIN_ATTEMPTS", "too many failed login attempts, try again later")
+	// ErrAccountLocked вход временно заблокирован после слишком большого числа неудачных попыток
+	ErrAccountLocked = apperrors.TooManyRequests("ACCOUNT_LOCKED", "sign-in is temporarily locked after too many failed attempts")
+	// ErrLoginThrottleChanged счётчик попыток входа изменился параллельным входом, попытку нужно учесть заново
+	ErrLoginThrottleChanged = apperrors.Conflict("LOGIN_THROTTLE_CHANGED", "login throttle has been changed concurrently")
+	// ErrInvalidUnlockToken токен разблокировки не найден, истёк или уже использован
+	ErrInvalidUnlockToken = apperrors.Unauthenticated("INVALID_UNLOCK_TOKEN", "invalid or expired unlock token")
+	// ErrUnlockTargetRequired не указаны ни email, ни IP для разблокировки
+	ErrUnlockTargetRequired = apperrors.InvalidArgument("email", "email or IP address is required")
+	// ErrPersonalTokenNotFound у пользователя нет такого действующего персонального токена
+	ErrPersonalTokenNotFound = apperrors.NotFound("PERSONAL_TOKEN_NOT_FOUND", "personal access token not found")
+	// ErrInvalidPersonalTokenID идентификатор персонального токена не является UUID
+	ErrInvalidPersonalTokenID = apperrors.InvalidArgument("id", "invalid personal access token ID")
+	// ErrPersonalTokenNameRequired не указано название персонального токена
+	ErrPersonalTokenNameRequired = apperrors.InvalidArgument("name", "token name is required")
+	// ErrPersonalTokenNameTooLong название персонального токена длиннее допустимого
+	ErrPersonalTokenNameTooLong = apperrors.InvalidArgument("name", "token name must be at most 100 characters long")
+	// ErrInvalidScopes права токена не указаны или среди них есть неизвестные
+	ErrInvalidScopes = apperrors.InvalidArgument("scopes", "scopes must be a non-empty list of documents:read, documents:write or admin")
+	// ErrInvalidPersonalTokenExpiry срок действия персонального токена отрицателен или больше допустимого
+	ErrInvalidPersonalTokenExpiry = apperrors.InvalidArgument("expires_in_days", "token expiry is out of the allowed range")
+	// ErrPersonalTokenLimit у пользователя слишком много действующих персональных токенов
+	ErrPersonalTokenLimit = apperrors.Conflict("PERSONAL_TOKEN_LIMIT", "too many active personal access tokens")
+	// ErrPersonalTokenSessionRequired персональный токен создаётся только после входа, а не другим персональным токеном
+	ErrPersonalTokenSessionRequired = apperrors.PermissionDenied("SESSION_REQUIRED", "personal access tokens can only be created after signing in")
+	// ErrAdminRequired административный метод вызван без сертификата администратора
+	ErrAdminRequired = apperrors.PermissionDenied("ADMIN_REQUIRED", "admin client certificate required")
+	// ErrInsufficientScope у персонального токена нет права на операцию
+	ErrInsufficientScope = apperrors.PermissionDenied("INSUFFICIENT_SCOPE", "token does not have the required scope")
+	// ErrUnknownOIDCProvider провайдер OpenID Connect не настроен
+	ErrUnknownOIDCProvider = apperrors.NotFound("OIDC_PROVIDER_NOT_FOUND", "identity provider not found")
+	// ErrInvalidOIDCState вход через провайдера не начинался, истёк или уже завершён
+	ErrInvalidOIDCState = apperrors.Unauthenticated("INVALID_OIDC_STATE", "invalid or expired sign-in state")
+	// ErrOIDCLoginFailed провайдер не подтвердил вход: код не обменялся или ID токен не прошёл проверку
+	ErrOIDCLoginFailed = apperrors.Unauthenticated("OIDC_LOGIN_FAILED", "sign-in with the identity provider failed")
+	// ErrOIDCEmailNotVerified провайдер не подтвердил email, поэтому учётную запись нельзя найти или создать по нему
+	ErrOIDCEmailNotVerified = apperrors.PermissionDenied("OIDC_EMAIL_NOT_VERIFIED", "the identity provider did not verify the email address")
+	// ErrIdentityNotFound учётная запись провайдера не связана ни с одним пользователем
+	ErrIdentityNotFound = apperrors.NotFound("IDENTITY_NOT_FOUND", "identity not found")
+	// ErrCodeRequired не указан код
+	ErrCodeRequired = apperrors.InvalidArgument("code", "code is required")
+	// ErrUsernameRequired не указано имя пользователя
+	ErrUsernameRequired = apperrors.InvalidArgument("username", "username is required")
+	// ErrStateRequired не указан state из адреса возврата
+	ErrStateRequired = apperrors.InvalidArgument("state", "state is required")
+	// ErrEmailRequired не указан email
+	ErrEmailRequired = apperrors.InvalidArgument("email", "email is required")
+	// ErrPasswordTooShort пароль короче минимальной длины
+	ErrPasswordTooShort = apperrors.InvalidArgument("password", "password must be at least 6 characters long")
+	// ErrInvalidUsername имя пользователя неподходящей длины
+	ErrInvalidUsername = apperrors.InvalidArgument("username", "username must be between 3 and 50 characters long")
+	// ErrDisplayNameTooLong отображаемое имя длиннее допустимого
+	ErrDisplayNameTooLong = apperrors.InvalidArgument("display_name", "display name must be at most 100 characters long")
+	// ErrBioTooLong описание профиля длиннее допустимого
+	ErrBioTooLong = apperrors.InvalidArgument("bio", "bio must be at most 500 characters long")
+	// ErrInvalidEmail email без адреса получателя или домена
+	ErrInvalidEmail = apperrors.InvalidArgument("email", "invalid email address")
+	// ErrEmailUnchanged новый email совпадает с текущим
+	ErrEmailUnchanged = apperrors.InvalidArgument("email", "new email is the same as the current one")
+	// ErrPasswordNotSet у пользователя нет пароля: он входит только через провайдера
+	ErrPasswordNotSet = apperrors.Conflict("PASSWORD_NOT_SET", "account has no password, set one with password reset first")
+	// ErrAvatarNotFound у пользователя нет аватара
+	ErrAvatarNotFound = apperrors.NotFound("AVATAR_NOT_FOUND", "avatar not found")
+	// ErrAvatarTooLarge аватар больше допустимого размера
+	ErrAvatarTooLarge = apperrors.InvalidArgument("avatar", "avatar is too large")
+	// ErrInvalidAvatar аватар не является изображением PNG, JPEG или GIF допустимых размеров
+	ErrInvalidAvatar = apperrors.InvalidArgument("avatar", "avatar must be a PNG, JPEG or GIF image up to 4096x4096 pixels")
+	// ErrInvalidUserID некорректный идентификатор пользователя
+	ErrInvalidUserID = apperrors.InvalidArgument("user_id", "invalid user ID")
+)
@@ -2,8 +2,11 @@ package auth
 
 import (
 	"context"
+	"time"
 
 	pb "github.com/malaxitlmax/penfeel/api/proto"
+	"github.com/malaxitlmax/penfeel/pkg/apperrors"
+	"github.com/malaxitlmax/penfeel/pkg/requestmeta"
 )
 
 // GRPCServer реализация gRPC сервера для авторизации
@@ -31,16 +34,12 @@ func (s *GRPCServer) Register(ctx context.Context, req *pb.RegisterRequest) (*pb
 	// Вызываем сервис для регистрации
 	user, err := s.service.Register(ctx, domainReq)
 	if err != nil {
-		return &pb.RegisterResponse{
-			Success: false,
-			Error:   err.Error(),
-		}, nil
+		return nil, apperrors.ToStatus(err)
 	}
 
 	// Формируем ответ
 	return &pb.RegisterResponse{
-		Success: true,
-		UserId:  user.ID.String(),
+		UserId: user.ID.String(),
 	}, nil
 }
 
@@ -50,27 +49,69 @@ func (s *GRPCServer) Login(ctx context.Context, req *pb.LoginRequest) (*pb.Login
 	domainReq := LoginRequest{
 		Email:    req.Email,
 		Password: req.Password,
+		Client:   clientInfo(ctx),
 	}
 
 	// Вызываем сервис для входа
 	response, err := s.service.Login(ctx, domainReq)
 	if err != nil {
-		return &pb.LoginResponse{
-			Success: false,
-			Error:   err.Error(),
-		}, nil
+		return nil, apperrors.ToStatus(err)
 	}
 
-	// Формируем ответ
-	return &pb.LoginResponse{
-		Success:      true,
+	return loginResponse(response), nil
+}
+
+// CompleteLogin обрабатывает запрос на завершение входа кодом двухфакторной аутентификации
+func (s *GRPCServer) CompleteLogin(ctx context.Context, req *pb.CompleteLoginRequest) (*pb.LoginResponse, error) {
+	response, err := s.service.CompleteLogin(ctx, req.ChallengeToken, req.Code, clientInfo(ctx))
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+
+	return loginResponse(response), nil
+}
+
+// SetupTOTP обрабатывает запрос на создание секрета TOTP
+func (s *GRPCServer) SetupTOTP(ctx context.Context, req *pb.SetupTOTPRequest) (*pb.SetupTOTPResponse, error) {
+	setup, err := s.service.SetupTOTP(ctx, req.Token)
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+
+	return &pb.SetupTOTPResponse{
+		Secret:     setup.Secret,
+		OtpauthUri: setup.URI,
+	}, nil
+}
+
+// ConfirmTOTP обрабатывает запрос на включение двухфакторной аутентификации
+func (s *GRPCServer) ConfirmTOTP(ctx context.Context, req *pb.ConfirmTOTPRequest) (*pb.ConfirmTOTPResponse, error) {
+	codes, err := s.service.ConfirmTOTP(ctx, req.Token, req.Code)
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.ConfirmTOTPResponse{RecoveryCodes: codes}, nil
+}
+
+// DisableTOTP обрабатывает запрос на выключение двухфакторной аутентификации
+func (s *GRPCServer) DisableTOTP(ctx context.Context, req *pb.DisableTOTPRequest) (*pb.DisableTOTPResponse, error) {
+	if err := s.service.DisableTOTP(ctx, req.Token, req.Password, req.Code, clientInfo(ctx)); err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.DisableTOTPResponse{}, nil
+}
+
+// RefreshToken обрабатывает запрос на обмен refresh токена
+func (s *GRPCServer) RefreshToken(ctx context.Context, req *pb.RefreshTokenRequest) (*pb.RefreshTokenResponse, error) {
+	response, err := s.service.RefreshToken(ctx, req.RefreshToken, clientInfo(ctx))
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+
+	return &pb.RefreshTokenResponse{
 		Token:        response.Token,
 		RefreshToken: response.RefreshToken,
-		User: &pb.UserInfo{
-			Id:       response.User.ID.String(),
-			Username: response.User.Username,
-			Email:    response.User.Email,
-		},
+		User:         userInfo(&response.User),
 	}, nil
 }
 
@@ -79,27 +120,401 @@ func (s *GRPCServer) ValidateToken(ctx context.Context, req *pb.ValidateTokenReq
 	// Вызываем сервис для проверки токена
 	response, err := s.service.ValidateToken(ctx, req.Token)
 	if err != nil {
-		return &pb.ValidateTokenResponse{
-			Valid: false,
-			Error: err.Error(),
-		}, nil
+		return nil, apperrors.ToStatus(err)
 	}
 
 	// Если токен не валиден, возвращаем ошибку
 	if !response.Valid {
-		return &pb.ValidateTokenResponse{
-			Valid: false,
-			Error: "invalid token",
-		}, nil
+		return nil, apperrors.ToStatus(ErrInvalidToken)
 	}
 
 	// Формируем ответ
 	return &pb.ValidateTokenResponse{
-		Valid: true,
-		User: &pb.UserInfo{
-			Id:       response.User.ID.String(),
-			Username: response.User.Username,
-			Email:    response.User.Email,
-		},
+		User:      userInfo(&response.User),
+		SessionId: response.SessionID.String(),
+	}, nil
+}
+
+// Logout обрабатывает запрос на завершение текущей сессии
+func (s *GRPCServer) Logout(ctx context.Context, req *pb.LogoutRequest) (*pb.LogoutResponse, error) {
+	if err := s.service.Logout(ctx, req.Token); err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.LogoutResponse{}, nil
+}
+
+// LogoutAll обрабатывает запрос на завершение всех сессий пользователя
+func (s *GRPCServer) LogoutAll(ctx context.Context, req *pb.LogoutAllRequest) (*pb.LogoutAllResponse, error) {
+	if err := s.service.LogoutAll(ctx, req.Token); err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.LogoutAllResponse{}, nil
+}
+
+// ListSessions обрабатывает запрос на получение действующих сессий пользователя
+func (s *GRPCServer) ListSessions(ctx context.Context, req *pb.ListSessionsRequest) (*pb.ListSessionsResponse, error) {
+	sessions, currentID, err := s.service.ListSessions(ctx, req.Token)
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+
+	pbSessions := make([]*pb.SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		pbSessions = append(pbSessions, &pb.SessionInfo{
+			Id:         session.ID.String(),
+			UserAgent:  session.UserAgent,
+			IpAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			LastSeenAt: session.LastSeenAt.Format("2006-01-02T15:04:05Z07:00"),
+			Current:    session.ID == currentID,
+		})
+	}
+
+	return &pb.ListSessionsResponse{Sessions: pbSessions}, nil
+}
+
+// RevokeSession обрабатывает запрос на завершение сессии пользователя
+func (s *GRPCServer) RevokeSession(ctx context.Context, req *pb.RevokeSessionRequest) (*pb.RevokeSessionResponse, error) {
+	if err := s.service.RevokeSession(ctx, req.Token, req.SessionId); err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.RevokeSessionResponse{}, nil
+}
+
+// GetJWKS обрабатывает запрос открытых ключей подписи access токенов
+func (s *GRPCServer) GetJWKS(ctx context.Context, req *pb.GetJWKSRequest) (*pb.GetJWKSResponse, error) {
+	jwks := s.service.JWKS(ctx)
+
+	keys := make([]*pb.JWK, 0, len(jwks.Keys))
+	for _, key := range jwks.Keys {
+		keys = append(keys, &pb.JWK{
+			Kid: key.KeyID,
+			Kty: key.KeyType,
+			Alg: key.Algorithm,
+			Use: key.Use,
+			N:   key.N,
+			E:   key.E,
+			Crv: key.Curve,
+			X:   key.X,
+		})
+	}
+
+	return &pb.GetJWKSResponse{Keys: keys}, nil
+}
+
+// ListRevokedSessions обрабатывает запрос отозванных сессий для синхронизации шлюза.
+// Время передаётся с долями секунды, чтобы шлюз мог продолжить синхронизацию с последней загруженной сессии.
+func (s *GRPCServer) ListRevokedSessions(ctx context.Context, req *pb.ListRevokedSessionsRequest) (*pb.ListRevokedSessionsResponse, error) {
+	var revokedAfter time.Time
+	if req.RevokedAfter != "" {
+		var err error
+		revokedAfter, err = time.Parse(time.RFC3339Nano, req.RevokedAfter)
+		if err != nil {
+			return nil, apperrors.ToStatus(ErrInvalidRevokedAfter.Wrap(err))
+		}
+	}
+
+	sessions, err := s.service.ListRevokedSessions(ctx, revokedAfter)
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+
+	pbSessions := make([]*pb.RevokedSession, 0, len(sessions))
+	for _, session := range sessions {
+		pbSessions = append(pbSessions, &pb.RevokedSession{
+			Id:        session.ID.String(),
+			RevokedAt: session.RevokedAt.Format(time.RFC3339Nano),
+			ExpiresAt: session.ExpiresAt.Format(time.RFC3339Nano),
+		})
+	}
+
+	return &pb.ListRevokedSessionsResponse{Sessions: pbSessions}, nil
+}
+
+// RequestPasswordReset обрабатывает запрос ссылки для сброса пароля
+func (s *GRPCServer) RequestPasswordReset(ctx context.Context, req *pb.RequestPasswordResetRequest) (*pb.RequestPasswordResetResponse, error) {
+	if err := s.service.RequestPasswordReset(ctx, req.Email); err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.RequestPasswordResetResponse{}, nil
+}
+
+// ResetPassword обрабатывает запрос на установку нового пароля по токену из письма
+func (s *GRPCServer) ResetPassword(ctx context.Context, req *pb.ResetPasswordRequest) (*pb.ResetPasswordResponse, error) {
+	if err := s.service.ResetPassword(ctx, req.Token, req.NewPassword); err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.ResetPasswordResponse{}, nil
+}
+
+// VerifyEmail обрабатывает запрос подтверждения email по токену из письма
+func (s *GRPCServer) VerifyEmail(ctx context.Context, req *pb.VerifyEmailRequest) (*pb.VerifyEmailResponse, error) {
+	user, err := s.service.VerifyEmail(ctx, req.Token)
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.VerifyEmailResponse{User: userInfo(user)}, nil
+}
+
+// ResendVerification обрабатывает запрос повторной отправки письма подтверждения
+func (s *GRPCServer) ResendVerification(ctx context.Context, req *pb.ResendVerificationRequest) (*pb.ResendVerificationResponse, error) {
+	if err := s.service.ResendVerification(ctx, req.Email); err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.ResendVerificationResponse{}, nil
+}
+
+// UnlockAccount обрабатывает запрос на снятие блокировки входа по токену из письма
+func (s *GRPCServer) UnlockAccount(ctx context.Context, req *pb.UnlockAccountRequest) (*pb.UnlockAccountResponse, error) {
+	if err := s.service.UnlockAccount(ctx, req.Token); err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.UnlockAccountResponse{}, nil
+}
+
+// AdminUnlockLogin обрабатывает запрос администратора на снятие блокировки входа
+func (s *GRPCServer) AdminUnlockLogin(ctx context.Context, req *pb.AdminUnlockLoginRequest) (*pb.AdminUnlockLoginResponse, error) {
+	if err := s.service.AdminUnlockLogin(ctx, req.Email, req.IpAddress); err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.AdminUnlockLoginResponse{}, nil
+}
+
+// CreatePersonalAccessToken обрабатывает запрос на создание персонального токена доступа
+func (s *GRPCServer) CreatePersonalAccessToken(ctx context.Context, req *pb.CreatePersonalAccessTokenRequest) (*pb.CreatePersonalAccessTokenResponse, error) {
+	personal, token, err := s.service.CreatePersonalAccessToken(ctx, req.Token, CreatePersonalTokenRequest{
+		Name:          req.Name,
+		Scopes:        req.Scopes,
+		ExpiresInDays: int(req.ExpiresInDays),
+	})
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+
+	return &pb.CreatePersonalAccessTokenResponse{
+		Info:        personalTokenInfo(personal),
+		AccessToken: token,
+	}, nil
+}
+
+// ListPersonalAccessTokens обрабатывает запрос на получение персональных токенов пользователя
+func (s *GRPCServer) ListPersonalAccessTokens(ctx context.Context, req *pb.ListPersonalAccessTokensRequest) (*pb.ListPersonalAccessTokensResponse, error) {
+	tokens, err := s.service.ListPersonalAccessTokens(ctx, req.Token)
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+
+	pbTokens := make([]*pb.PersonalAccessTokenInfo, 0, len(tokens))
+	for _, personal := range tokens {
+		pbTokens = append(pbTokens, personalTokenInfo(personal))
+	}
+
+	return &pb.ListPersonalAccessTokensResponse{Tokens: pbTokens}, nil
+}
+
+// RevokePersonalAccessToken обрабатывает запрос на отзыв персонального токена
+func (s *GRPCServer) RevokePersonalAccessToken(ctx context.Context, req *pb.RevokePersonalAccessTokenRequest) (*pb.RevokePersonalAccessTokenResponse, error) {
+	if err := s.service.RevokePersonalAccessToken(ctx, req.Token, req.Id); err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.RevokePersonalAccessTokenResponse{}, nil
+}
+
+// ValidatePersonalAccessToken обрабатывает запрос на проверку персонального токена
+func (s *GRPCServer) ValidatePersonalAccessToken(ctx context.Context, req *pb.ValidatePersonalAccessTokenRequest) (*pb.ValidatePersonalAccessTokenResponse, error) {
+	personal, user, err := s.service.ValidatePersonalAccessToken(ctx, req.Token, clientInfo(ctx))
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+
+	return &pb.ValidatePersonalAccessTokenResponse{
+		User:    userInfo(user),
+		TokenId: personal.ID.String(),
+		Scopes:  personal.Scopes,
+	}, nil
+}
+
+// ListOIDCProviders обрабатывает запрос на получение провайдеров OpenID Connect
+func (s *GRPCServer) ListOIDCProviders(ctx context.Context, req *pb.ListOIDCProvidersRequest) (*pb.ListOIDCProvidersResponse, error) {
+	providers := s.service.ListOIDCProviders(ctx)
+
+	response := &pb.ListOIDCProvidersResponse{
+		Providers: make([]*pb.OIDCProvider, 0, len(providers)),
+	}
+	for _, provider := range providers {
+		response.Providers = append(response.Providers, &pb.OIDCProvider{
+			Id:   provider.ID,
+			Name: provider.Name,
+		})
+	}
+	return response, nil
+}
+
+// StartOIDCLogin обрабатывает запрос на начало входа через провайдера OpenID Connect
+func (s *GRPCServer) StartOIDCLogin(ctx context.Context, req *pb.StartOIDCLoginRequest) (*pb.StartOIDCLoginResponse, error) {
+	start, err := s.service.StartOIDCLogin(ctx, req.Provider)
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+
+	return &pb.StartOIDCLoginResponse{
+		AuthorizationUrl: start.AuthorizationURL,
+		ExpiresAt:        start.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+		Binding:          start.Binding,
+	}, nil
+}
+
+// CompleteOIDCLogin обрабатывает запрос на завершение входа через провайдера OpenID Connect
+func (s *GRPCServer) CompleteOIDCLogin(ctx context.Context, req *pb.CompleteOIDCLoginRequest) (*pb.LoginResponse, error) {
+	response, err := s.service.CompleteOIDCLogin(ctx, req.State, req.Binding, req.Code, clientInfo(ctx))
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+
+	return loginResponse(response), nil
+}
+
+// GetProfile обрабатывает запрос профиля
+func (s *GRPCServer) GetProfile(ctx context.Context, req *pb.GetProfileRequest) (*pb.GetProfileResponse, error) {
+	user, err := s.service.GetProfile(ctx, req.Token)
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.GetProfileResponse{Profile: profile(user)}, nil
+}
+
+// UpdateProfile обрабатывает запрос на изменение профиля
+func (s *GRPCServer) UpdateProfile(ctx context.Context, req *pb.UpdateProfileRequest) (*pb.UpdateProfileResponse, error) {
+	user, err := s.service.UpdateProfile(ctx, req.Token, UpdateProfileRequest{
+		Username:    req.Username,
+		DisplayName: req.DisplayName,
+		Bio:         req.Bio,
+	})
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.UpdateProfileResponse{Profile: profile(user)}, nil
+}
+
+// ChangePassword обрабатывает запрос на смену пароля
+func (s *GRPCServer) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.ChangePasswordResponse, error) {
+	if err := s.service.ChangePassword(ctx, req.Token, req.CurrentPassword, req.NewPassword, clientInfo(ctx)); err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.ChangePasswordResponse{}, nil
+}
+
+// ChangeEmail обрабатывает запрос на смену email
+func (s *GRPCServer) ChangeEmail(ctx context.Context, req *pb.ChangeEmailRequest) (*pb.ChangeEmailResponse, error) {
+	if err := s.service.ChangeEmail(ctx, req.Token, req.NewEmail, req.Password, clientInfo(ctx)); err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.ChangeEmailResponse{}, nil
+}
+
+// UploadAvatar обрабатывает загрузку аватара
+func (s *GRPCServer) UploadAvatar(ctx context.Context, req *pb.UploadAvatarRequest) (*pb.UploadAvatarResponse, error) {
+	user, err := s.service.UploadAvatar(ctx, req.Token, req.Data)
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.UploadAvatarResponse{Profile: profile(user)}, nil
+}
+
+// DeleteAvatar обрабатывает удаление аватара
+func (s *GRPCServer) DeleteAvatar(ctx context.Context, req *pb.DeleteAvatarRequest) (*pb.DeleteAvatarResponse, error) {
+	if err := s.service.DeleteAvatar(ctx, req.Token); err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.DeleteAvatarResponse{}, nil
+}
+
+// GetAvatar обрабатывает запрос аватара пользователя
+func (s *GRPCServer) GetAvatar(ctx context.Context, req *pb.GetAvatarRequest) (*pb.GetAvatarResponse, error) {
+	avatar, err := s.service.GetAvatar(ctx, req.UserId)
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+	return &pb.GetAvatarResponse{
+		ContentType: avatar.ContentType,
+		Data:        avatar.Data,
+		UpdatedAt:   avatar.UpdatedAt.Format(time.RFC3339Nano),
 	}, nil
 }
+
+// profile преобразует пользователя в профиль для ответа
+func profile(user *User) *pb.Profile {
+	info := &pb.Profile{
+		Id:               user.ID.String(),
+		Username:         user.Username,
+		Email:            user.Email,
+		EmailVerified:    user.EmailVerified(),
+		DisplayName:      user.DisplayName,
+		Bio:              user.Bio,
+		HasPassword:      user.HasPassword(),
+		TwoFactorEnabled: user.TwoFactorEnabled(),
+		CreatedAt:        user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if user.AvatarUpdatedAt != nil {
+		info.AvatarUpdatedAt = user.AvatarUpdatedAt.Format(time.RFC3339Nano)
+	}
+	if user.PendingEmail != nil {
+		info.PendingEmail = *user.PendingEmail
+	}
+	return info
+}
+
+// personalTokenInfo преобразует персональный токен в сообщение ответа
+func personalTokenInfo(personal *PersonalAccessToken) *pb.PersonalAccessTokenInfo {
+	info := &pb.PersonalAccessTokenInfo{
+		Id:        personal.ID.String(),
+		Name:      personal.Name,
+		Prefix:    personal.TokenPrefix,
+		Scopes:    personal.Scopes,
+		CreatedAt: personal.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		ExpiresAt: personal.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if personal.LastUsedAt != nil {
+		info.LastUsedAt = personal.LastUsedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	if personal.LastUsedIP != nil {
+		info.LastUsedIp = *personal.LastUsedIP
+	}
+	return info
+}
+
+// loginResponse преобразует результат входа в сообщение ответа: токены или токен второго шага входа.
+// До проверки кода данные пользователя не возвращаются.
+func loginResponse(response *TokenResponse) *pb.LoginResponse {
+	if response.Challenge != nil {
+		return &pb.LoginResponse{
+			TwoFactorRequired:  true,
+			ChallengeToken:     response.Challenge.Token,
+			ChallengeExpiresAt: response.Challenge.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+		}
+	}
+
+	return &pb.LoginResponse{
+		Token:        response.Token,
+		RefreshToken: response.RefreshToken,
+		User:         userInfo(&response.User),
+	}
+}
+
+// userInfo преобразует пользователя в сообщение ответа
+func userInfo(user *User) *pb.UserInfo {
+	return &pb.UserInfo{
+		Id:            user.ID.String(),
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified(),
+	}
+}
+
+// clientInfo возвращает клиента шлюза, переданного в метаданных запроса
+func clientInfo(ctx context.Context) ClientInfo {
+	return ClientInfo{
+		UserAgent: requestmeta.UserAgent(ctx),
+		IPAddress: requestmeta.ClientIP(ctx),
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // User представляет пользователя системы
@@ -14,6 +15,240 @@ type User struct {
 	PasswordHash string    `db:"password_hash" json:"-"`
 	CreatedAt    time.Time `db:"created_at" json:"created_at"`
 	UpdatedAt    time.Time `db:"updated_at" json:"updated_at"`
+	// Время подтверждения email, nil пока адрес не подтверждён
+	EmailVerifiedAt *time.Time `db:"email_verified_at" json:"email_verified_at"`
+	// Секрет TOTP; до подтверждения первым кодом (TOTPEnabledAt) двухфакторная аутентификация не действует
+	TOTPSecret      *string    `db:"totp_secret" json:"-"`
+	TOTPEnabledAt   *time.Time `db:"totp_enabled_at" json:"-"`
+	TOTPLastCounter int64      `db:"totp_last_counter" json:"-"`
+	DisplayName     string     `db:"display_name" json:"display_name"`
+	Bio             string     `db:"bio" json:"bio"`
+	// Новый email, ожидающий подтверждения по ссылке из письма
+	PendingEmail *string `db:"pending_email" json:"pending_email"`
+	// Время загрузки аватара, nil если аватара нет
+	AvatarUpdatedAt *time.Time `db:"avatar_updated_at" json:"avatar_updated_at"`
+}
+
+// TwoFactorEnabled сообщает, требуется ли при входе код TOTP
+func (u *User) TwoFactorEnabled() bool {
+	return u.TOTPEnabledAt != nil && u.TOTPSecret != nil
+}
+
+// HasPassword сообщает, может ли пользователь входить по паролю.
+// У пользователей, созданных при входе через провайдера, пароля нет.
+func (u *User) HasPassword() bool {
+	return u.PasswordHash != ""
+}
+
+// EmailVerified сообщает, подтверждён ли email пользователя
+func (u *User) EmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// Session сессия пользователя, начатая входом. Access токены сессии содержат её ID в jti,
+// refresh токены, полученные ротацией, принадлежат сессии и отзываются вместе с ней.
+type Session struct {
+	ID         uuid.UUID  `db:"id"`
+	UserID     uuid.UUID  `db:"user_id"`
+	UserAgent  string     `db:"user_agent"`
+	IPAddress  string     `db:"ip_address"`
+	CreatedAt  time.Time  `db:"created_at"`
+	LastSeenAt time.Time  `db:"last_seen_at"`
+	ExpiresAt  time.Time  `db:"expires_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+}
+
+// Active проверяет, что сессия не отозвана и не истекла
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// PersonalAccessToken персональный токен доступа для скриптов и интеграций.
+// Действует вместо пароля и сессии, но только для операций из Scopes.
+type PersonalAccessToken struct {
+	ID     uuid.UUID `db:"id"`
+	UserID uuid.UUID `db:"user_id"`
+	Name   string    `db:"name"`
+	// Начало токена для показа в списке
+	TokenPrefix string         `db:"token_prefix"`
+	TokenHash   string         `db:"token_hash"`
+	Scopes      pq.StringArray `db:"scopes"`
+	CreatedAt   time.Time      `db:"created_at"`
+	ExpiresAt   time.Time      `db:"expires_at"`
+	LastUsedAt  *time.Time     `db:"last_used_at"`
+	LastUsedIP  *string        `db:"last_used_ip"`
+	RevokedAt   *time.Time     `db:"revoked_at"`
+}
+
+// Active сообщает, действует ли токен: он не отозван и не истёк
+func (t *PersonalAccessToken) Active() bool {
+	return t.RevokedAt == nil && time.Now().Before(t.ExpiresAt)
+}
+
+// CreatePersonalTokenRequest запрос на создание персонального токена доступа
+type CreatePersonalTokenRequest struct {
+	Name   string
+	Scopes []string
+	// Срок действия в днях; ноль — срок по умолчанию
+	ExpiresInDays int
+}
+
+// ClientInfo клиент, от которого пришёл запрос
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+// RefreshToken выданный refresh токен сессии SessionID.
+// Каждый токен обменивается на новый только один раз.
+type RefreshToken struct {
+	ID        uuid.UUID  `db:"id"`
+	SessionID uuid.UUID  `db:"session_id"`
+	UserID    uuid.UUID  `db:"user_id"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
+
+// PasswordResetToken одноразовый токен сброса пароля из письма.
+// Хранится только хеш токена; новый запрос сброса отменяет прежние неиспользованные токены.
+type PasswordResetToken struct {
+	ID        uuid.UUID  `db:"id"`
+	UserID    uuid.UUID  `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
+
+// EmailVerificationToken одноразовый токен подтверждения email из письма.
+// Подтверждает только адрес Email, на который было отправлено письмо.
+type EmailVerificationToken struct {
+	ID        uuid.UUID  `db:"id"`
+	UserID    uuid.UUID  `db:"user_id"`
+	Email     string     `db:"email"`
+	TokenHash string     `db:"token_hash"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+}
+
+// LoginChallenge незавершённый вход: пароль проверен, ожидается код двухфакторной аутентификации.
+// Клиент получает токен, по которому обменивает код на токены сессии.
+// FailedAttempts — попытки ввести код, они учитываются до проверки кода.
+type LoginChallenge struct {
+	ID             uuid.UUID  `db:"id"`
+	UserID         uuid.UUID  `db:"user_id"`
+	TokenHash      string     `db:"token_hash"`
+	CreatedAt      time.Time  `db:"created_at"`
+	ExpiresAt      time.Time  `db:"expires_at"`
+	FailedAttempts int        `db:"failed_attempts"`
+	CompletedAt    *time.Time `db:"completed_at"`
+}
+
+// Счётчики неудачных попыток входа
+const (
+	// ThrottleScopeAccount попытки входа с одним email
+	ThrottleScopeAccount = "account"
+	// ThrottleScopeIP попытки входа с одного IP
+	ThrottleScopeIP = "ip"
+)
+
+// Кто снял блокировку входа
+const (
+	UnlockedByEmail         = "email"
+	UnlockedByPasswordReset = "password_reset"
+	UnlockedByAdmin         = "admin"
+)
+
+// LoginThrottle неудачные попытки входа по email или IP (Scope) со значением Key
+type LoginThrottle struct {
+	Scope          string    `db:"scope"`
+	Key            string    `db:"throttle_key"`
+	FailedAttempts int       `db:"failed_attempts"`
+	LastFailedAt   time.Time `db:"last_failed_at"`
+}
+
+// LoginLockout блокировка входа после слишком большого числа неудачных попыток
+type LoginLockout struct {
+	ID             uuid.UUID  `db:"id"`
+	Scope          string     `db:"scope"`
+	Key            string     `db:"throttle_key"`
+	UserID         *uuid.UUID `db:"user_id"`
+	IPAddress      string     `db:"ip_address"`
+	FailedAttempts int        `db:"failed_attempts"`
+	LockedUntil    time.Time  `db:"locked_until"`
+	CreatedAt      time.Time  `db:"created_at"`
+	// Хеш токена ссылки разблокировки, отправленной владельцу учётной записи
+	UnlockTokenHash *string    `db:"unlock_token_hash"`
+	UnlockExpiresAt *time.Time `db:"unlock_expires_at"`
+	UnlockedAt      *time.Time `db:"unlocked_at"`
+	UnlockedBy      *string    `db:"unlocked_by"`
+}
+
+// UserIdentity учётная запись пользователя у внешнего провайдера OpenID Connect
+type UserIdentity struct {
+	ID       uuid.UUID `db:"id"`
+	UserID   uuid.UUID `db:"user_id"`
+	Provider string    `db:"provider"`
+	// Идентификатор пользователя у провайдера
+	Subject     string    `db:"subject"`
+	Email       string    `db:"email"`
+	CreatedAt   time.Time `db:"created_at"`
+	LastLoginAt time.Time `db:"last_login_at"`
+}
+
+// OIDCLoginState начатый вход через провайдера OpenID Connect, ожидающий возврата пользователя.
+// Используется один раз.
+type OIDCLoginState struct {
+	ID        uuid.UUID `db:"id"`
+	Provider  string    `db:"provider"`
+	StateHash string    `db:"state_hash"`
+	// Хеш привязки к браузеру, который начал вход
+	BindingHash string `db:"binding_hash"`
+	Nonce       string `db:"nonce"`
+	// Верификатор PKCE, который подтверждает обмен кода авторизации
+	CodeVerifier string     `db:"code_verifier"`
+	CreatedAt    time.Time  `db:"created_at"`
+	ExpiresAt    time.Time  `db:"expires_at"`
+	UsedAt       *time.Time `db:"used_at"`
+}
+
+// OIDCLoginStart начатый вход через провайдера OpenID Connect
+type OIDCLoginStart struct {
+	// Страница входа провайдера, на которую перенаправляется пользователь
+	AuthorizationURL string
+	// Привязка к браузеру: её нужно сохранить у клиента и передать в CompleteOIDCLogin вместе со state
+	Binding   string
+	ExpiresAt time.Time
+}
+
+// OIDCProviderInfo провайдер OpenID Connect для кнопки входа
+type OIDCProviderInfo struct {
+	ID   string
+	Name string
+}
+
+// Avatar изображение профиля пользователя
+type Avatar struct {
+	UserID      uuid.UUID `db:"user_id"`
+	ContentType string    `db:"content_type"`
+	Data        []byte    `db:"data"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+// UpdateProfileRequest изменение профиля; nil поля не меняются
+type UpdateProfileRequest struct {
+	Username    *string
+	DisplayName *string
+	Bio         *string
+}
+
+// TOTPSetup секрет TOTP, ожидающий подтверждения кодом
+type TOTPSetup struct {
+	Secret string
+	// otpauth URI для QR-кода
+	URI string
 }
 
 // RegisterRequest представляет запрос на регистрацию
@@ -27,6 +262,8 @@ type RegisterRequest struct {
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
+	// Клиент, для которого открывается сессия
+	Client ClientInfo `json:"-"`
 }
 
 // TokenResponse представляет ответ с токеном авторизации
@@ -35,6 +272,14 @@ type TokenResponse struct {
 	RefreshToken string    `json:"refresh_token"`
 	ExpiresAt    time.Time `json:"expires_at"`
 	User         User      `json:"user"`
+	// Если задан, вход не завершён: токенов нет, нужен код двухфакторной аутентификации
+	Challenge *ChallengeResponse `json:"challenge,omitempty"`
+}
+
+// ChallengeResponse токен второго шага входа
+type ChallengeResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 // TokenClaims представляет данные, хранящиеся в JWT токене
@@ -44,6 +289,7 @@ type TokenClaims struct {
 
 // ValidationResponse представляет ответ с проверкой токена
 type ValidationResponse struct {
-	Valid bool `json:"valid"`
-	User  User `json:"user,omitempty"`
+	Valid     bool      `json:"valid"`
+	User      User      `json:"user,omitempty"`
+	SessionID uuid.UUID `json:"session_id"`
 }
@@ -0,0 +1,270 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/malaxitlmax/penfeel/config"
+	pkgauth "github.com/malaxitlmax/penfeel/pkg/auth"
+	"github.com/malaxitlmax/penfeel/pkg/mailer"
+	"github.com/malaxitlmax/penfeel/pkg/oidc"
+)
+
+const (
+	// maxOIDCUsernameLength наибольшая длина имени, которое берётся из профиля провайдера
+	maxOIDCUsernameLength = 40
+	// oidcUsernameAttempts сколько раз пробовать создать пользователя с другим суффиксом занятого имени
+	oidcUsernameAttempts = 5
+)
+
+// ListOIDCProviders возвращает провайдеров OpenID Connect, через которых можно войти
+func (s *AuthService) ListOIDCProviders(ctx context.Context) []OIDCProviderInfo {
+	providers := make([]OIDCProviderInfo, 0, len(s.oidcProviders))
+	for _, provider := range s.oidcProviders {
+		providers = append(providers, OIDCProviderInfo{
+			ID:   provider.ID(),
+			Name: provider.Name(),
+		})
+	}
+	return providers
+}
+
+// StartOIDCLogin начинает вход через провайдера providerID и возвращает адрес его страницы входа.
+// state, nonce и верификатор PKCE сохраняются до возврата пользователя и действуют до ExpiresAt.
+// Возвращённую привязку клиент хранит у себя (шлюз — в HttpOnly cookie), чтобы вход мог завершить
+// только браузер, который его начал: иначе по чужой ссылке возврата пользователь вошёл бы в учётную запись злоумышленника.
+func (s *AuthService) StartOIDCLogin(ctx context.Context, providerID string) (*OIDCLoginStart, error) {
+	provider, err := s.oidcProvider(providerID)
+	if err != nil {
+		return nil, err
+	}
+
+	state, stateHash, err := pkgauth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	binding, bindingHash, err := pkgauth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, _, err := pkgauth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+	// 43 символа base64url подходят как верификатор PKCE (RFC 7636, раздел 4.1)
+	verifier, _, err := pkgauth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// Адрес строится до сохранения, чтобы недоступный провайдер не оставлял начатых входов
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start OIDC login: %w", err)
+	}
+
+	loginState := &OIDCLoginState{
+		ID:           uuid.New(),
+		Provider:     provider.ID(),
+		StateHash:    stateHash,
+		BindingHash:  bindingHash,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(s.oidcStateTTL),
+	}
+	if err := s.repo.CreateOIDCLoginState(ctx, loginState); err != nil {
+		return nil, err
+	}
+
+	return &OIDCLoginStart{
+		AuthorizationURL: authURL,
+		Binding:          binding,
+		ExpiresAt:        loginState.ExpiresAt,
+	}, nil
+}
+
+// CompleteOIDCLogin завершает вход через провайдера по state и коду авторизации, с которыми
+// провайдер вернул пользователя, и привязке, полученной клиентом в StartOIDCLogin.
+// Пользователь находится по учётной записи провайдера или по email, подтверждённому провайдером;
+// если такого нет, он создаётся. С двухфакторной аутентификацией вместо токенов возвращается
+// второй шаг входа, как в Login.
+func (s *AuthService) CompleteOIDCLogin(ctx context.Context, state, binding, code string, client ClientInfo) (*TokenResponse, error) {
+	if state == "" {
+		return nil, ErrStateRequired
+	}
+	if code == "" {
+		return nil, ErrCodeRequired
+	}
+	// Без привязки вход начат в другом браузере или cookie не дошла
+	if binding == "" {
+		return nil, ErrInvalidOIDCState
+	}
+
+	loginState, err := s.repo.UseOIDCLoginState(ctx, pkgauth.HashOpaqueToken(state), pkgauth.HashOpaqueToken(binding))
+	if err != nil {
+		return nil, err
+	}
+	// Провайдера могли убрать из конфигурации, пока пользователь входил
+	provider, err := s.oidcProvider(loginState.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	rawIDToken, err := provider.Exchange(ctx, code, loginState.CodeVerifier)
+	if err != nil {
+		log.Printf("OIDC login with %s failed: %v", provider.ID(), err)
+		return nil, ErrOIDCLoginFailed.Wrap(err)
+	}
+	idToken, err := provider.VerifyIDToken(ctx, rawIDToken, loginState.Nonce)
+	if err != nil {
+		log.Printf("OIDC login with %s failed: %v", provider.ID(), err)
+		return nil, ErrOIDCLoginFailed.Wrap(err)
+	}
+
+	user, err := s.oidcUser(ctx, provider, idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Email мог смениться после привязки провайдера
+	if s.account.EmailVerificationRequired == config.EmailVerificationLogin && !user.EmailVerified() {
+		return nil, ErrEmailNotVerified
+	}
+
+	if user.TwoFactorEnabled() {
+		return s.startLoginChallenge(ctx, user)
+	}
+
+	session := &Session{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		UserAgent: client.UserAgent,
+		IPAddress: client.IPAddress,
+	}
+	return s.issueTokens(ctx, user, session)
+}
+
+// oidcProvider возвращает настроенного провайдера
+func (s *AuthService) oidcProvider(id string) (*oidc.Provider, error) {
+	for _, provider := range s.oidcProviders {
+		if provider.ID() == id {
+			return provider, nil
+		}
+	}
+	return nil, ErrUnknownOIDCProvider
+}
+
+// oidcUser возвращает пользователя, который вошёл через провайдера. Новая учётная запись провайдера
+// связывается с пользователем только по email, владение которым подтвердил провайдер.
+func (s *AuthService) oidcUser(ctx context.Context, provider *oidc.Provider, idToken *oidc.IDToken) (*User, error) {
+	identity, err := s.repo.GetUserIdentity(ctx, provider.ID(), idToken.Subject)
+	if err == nil {
+		if err := s.repo.TouchUserIdentity(ctx, identity.ID, idToken.Email); err != nil {
+			log.Printf("Error updating identity %s: %v", identity.ID, err)
+		}
+		return s.repo.GetUserByID(ctx, identity.UserID)
+	}
+	if !errors.Is(err, ErrIdentityNotFound) {
+		return nil, err
+	}
+
+	if idToken.Email == "" || !idToken.EmailVerified {
+		return nil, ErrOIDCEmailNotVerified
+	}
+
+	identity = &UserIdentity{
+		ID:       uuid.New(),
+		Provider: provider.ID(),
+		Subject:  idToken.Subject,
+		Email:    idToken.Email,
+	}
+
+	user, err := s.repo.GetUserByEmail(ctx, idToken.Email)
+	if errors.Is(err, ErrUserNotFound) {
+		return s.createOIDCUser(ctx, identity, idToken)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// Неподтверждённую учётную запись мог заранее зарегистрировать любой, кто знал email, и оставить
+	// себе пароль, сессии или токены. Провайдер подтвердил, что email принадлежит входящему,
+	// поэтому всё, что позволяет войти без провайдера, удаляется.
+	identity.UserID = user.ID
+	resetCredentials := !user.EmailVerified()
+	if err := s.repo.LinkUserIdentity(ctx, identity, resetCredentials); err != nil {
+		return nil, err
+	}
+	log.Printf("Identity %s of %s linked to user %s, credentials reset: %t", identity.Subject, provider.ID(), user.ID, resetCredentials)
+
+	// Вход не отменяется из-за неотправленного письма
+	if err := s.sendIdentityLinked(ctx, user, provider); err != nil {
+		log.Printf("Error sending identity linked email to user %s: %v", user.ID, err)
+	}
+
+	if resetCredentials {
+		return s.repo.GetUserByID(ctx, user.ID)
+	}
+	return user, nil
+}
+
+// createOIDCUser создаёт пользователя для учётной записи провайдера. Имя берётся из профиля
+// провайдера, а если оно занято — дополняется случайным суффиксом.
+func (s *AuthService) createOIDCUser(ctx context.Context, identity *UserIdentity, idToken *oidc.IDToken) (*User, error) {
+	username := oidcUsername(idToken)
+	for attempt := 0; ; attempt++ {
+		user := &User{
+			ID:       uuid.New(),
+			Username: username,
+			Email:    idToken.Email,
+		}
+		err := s.repo.CreateUserWithIdentity(ctx, user, identity)
+		if err == nil {
+			log.Printf("User %s created for identity %s of %s", user.ID, identity.Subject, identity.Provider)
+			return user, nil
+		}
+		if !errors.Is(err, ErrUsernameTaken) || attempt+1 >= oidcUsernameAttempts {
+			return nil, err
+		}
+
+		suffix, _, err := pkgauth.GenerateOpaqueToken()
+		if err != nil {
+			return nil, err
+		}
+		username = oidcUsername(idToken) + "-" + suffix[:6]
+	}
+}
+
+// oidcUsername выбирает имя пользователя из профиля провайдера
+func oidcUsername(idToken *oidc.IDToken) string {
+	localPart, _, _ := strings.Cut(idToken.Email, "@")
+	for _, candidate := range []string{idToken.PreferredUsername, idToken.Name, localPart} {
+		candidate = strings.TrimSpace(candidate)
+		if utf8.RuneCountInString(candidate) > maxOIDCUsernameLength {
+			candidate = string([]rune(candidate)[:maxOIDCUsernameLength])
+		}
+		if utf8.RuneCountInString(candidate) >= 3 {
+			return candidate
+		}
+	}
+	return "user"
+}
+
+// sendIdentityLinked сообщает пользователю, что к его учётной записи привязан вход через провайдера
+func (s *AuthService) sendIdentityLinked(ctx context.Context, user *User, provider *oidc.Provider) error {
+	return s.sendMail(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: fmt.Sprintf("%s sign-in was added to your PenFeel account", provider.Name()),
+		Body: fmt.Sprintf(
+			"Hello, %s!\n\nYou can now sign in to your PenFeel account with %s.\n\n"+
+				"If it was not you, contact support immediately.\n",
+			user.Username, provider.Name(),
+		),
+	})
+}
@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/malaxitlmax/penfeel/config"
+	pkgauth "github.com/malaxitlmax/penfeel/pkg/auth"
+)
+
+// maxPersonalTokenNameLength наибольшая длина названия персонального токена
+const maxPersonalTokenNameLength = 100
+
+// CreatePersonalAccessToken создаёт персональный токен доступа владельцу токена.
+// Возвращает сохранённый токен и сам токен, который показывается пользователю только один раз.
+// Создать токен можно только после входа: иначе утёкший токен с правом admin продлевал бы себя,
+// выпуская новые токены, которые переживают его отзыв и срок действия.
+func (s *AuthService) CreatePersonalAccessToken(ctx context.Context, token string, req CreatePersonalTokenRequest) (*PersonalAccessToken, string, error) {
+	if pkgauth.IsPersonalToken(token) {
+		return nil, "", ErrPersonalTokenSessionRequired
+	}
+	session, err := s.authenticate(ctx, token)
+	if err != nil {
+		return nil, "", err
+	}
+	userID := session.UserID
+
+	name := strings.TrimSpace(req.Name)
+	switch {
+	case name == "":
+		return nil, "", ErrPersonalTokenNameRequired
+	case utf8.RuneCountInString(name) > maxPersonalTokenNameLength:
+		return nil, "", ErrPersonalTokenNameTooLong
+	}
+
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ttl := s.account.PersonalTokenDefaultTTL
+	if req.ExpiresInDays != 0 {
+		// Дни сравниваются до умножения, чтобы большое число не переполнило Duration
+		if req.ExpiresInDays < 0 || req.ExpiresInDays > int(s.account.PersonalTokenMaxTTL/(24*time.Hour)) {
+			return nil, "", ErrInvalidPersonalTokenExpiry
+		}
+		ttl = time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	}
+
+	plain, prefix, hash, err := pkgauth.GeneratePersonalToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	personal := &PersonalAccessToken{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Name:        name,
+		TokenPrefix: prefix,
+		TokenHash:   hash,
+		Scopes:      pq.StringArray(scopes),
+		ExpiresAt:   time.Now().Add(ttl),
+	}
+	if err := s.repo.CreatePersonalAccessToken(ctx, personal, s.account.PersonalTokenLimit); err != nil {
+		return nil, "", err
+	}
+
+	log.Printf("Personal access token %s with scopes %s created for user %s", personal.ID, strings.Join(scopes, ","), userID)
+	return personal, plain, nil
+}
+
+// ListPersonalAccessTokens возвращает неотозванные персональные токены владельца токена
+func (s *AuthService) ListPersonalAccessTokens(ctx context.Context, token string) ([]*PersonalAccessToken, error) {
+	userID, err := s.authenticateTokenOwner(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.repo.ListPersonalAccessTokens(ctx, userID)
+}
+
+// RevokePersonalAccessToken отзывает персональный токен tokenID владельца токена
+func (s *AuthService) RevokePersonalAccessToken(ctx context.Context, token, tokenID string) error {
+	userID, err := s.authenticateTokenOwner(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	id, err := uuid.Parse(tokenID)
+	if err != nil {
+		return ErrInvalidPersonalTokenID
+	}
+
+	if err := s.repo.RevokePersonalAccessToken(ctx, id, userID); err != nil {
+		return err
+	}
+
+	log.Printf("Personal access token %s of user %s revoked", id, userID)
+	return nil
+}
+
+// ValidatePersonalAccessToken проверяет персональный токен и возвращает его вместе с владельцем.
+// Время и адрес использования обновляются не чаще sessionTouchInterval.
+func (s *AuthService) ValidatePersonalAccessToken(ctx context.Context, token string, client ClientInfo) (*PersonalAccessToken, *User, error) {
+	personal, err := s.personalToken(ctx, token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, personal.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, nil, ErrInvalidToken.Wrap(err)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// Токен не должен обходить запрет входа до подтверждения email
+	if s.account.EmailVerificationRequired == config.EmailVerificationLogin && !user.EmailVerified() {
+		return nil, nil, ErrEmailNotVerified
+	}
+
+	ipChanged := personal.LastUsedIP == nil || *personal.LastUsedIP != client.IPAddress
+	if personal.LastUsedAt == nil || time.Since(*personal.LastUsedAt) > sessionTouchInterval || ipChanged {
+		if err := s.repo.TouchPersonalAccessToken(ctx, personal.ID, client.IPAddress); err != nil {
+			log.Printf("Error updating usage of personal access token %s: %v", personal.ID, err)
+		}
+	}
+
+	return personal, user, nil
+}
+
+// authenticateTokenOwner возвращает владельца токена сессии или персонального токена с правом admin.
+// Просматривать и отзывать персональные токены могут только они.
+func (s *AuthService) authenticateTokenOwner(ctx context.Context, token string) (uuid.UUID, error) {
+	if pkgauth.IsPersonalToken(token) {
+		personal, err := s.personalToken(ctx, token)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if !pkgauth.HasScope(personal.Scopes, pkgauth.ScopeAdmin) {
+			return uuid.Nil, ErrInsufficientScope
+		}
+		return personal.UserID, nil
+	}
+
+	session, err := s.authenticate(ctx, token)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return session.UserID, nil
+}
+
+// personalToken возвращает действующий персональный токен
+func (s *AuthService) personalToken(ctx context.Context, token string) (*PersonalAccessToken, error) {
+	personal, err := s.repo.GetPersonalAccessTokenByHash(ctx, pkgauth.HashOpaqueToken(token))
+	if errors.Is(err, ErrPersonalTokenNotFound) {
+		return nil, ErrInvalidToken.Wrap(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !personal.Active() {
+		return nil, ErrInvalidToken
+	}
+	return personal, nil
+}
+
+// normalizeScopes проверяет права токена и убирает повторы
+func normalizeScopes(scopes []string) ([]string, error) {
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScopes
+	}
+
+	normalized := make([]string, 0, len(scopes))
+	seen := make(map[string]bool, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !pkgauth.ValidScope(scope) {
+			return nil, ErrInvalidScopes
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	return normalized, nil
+}
@@ -0,0 +1,304 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/malaxitlmax/penfeel/pkg/mailer"
+)
+
+const (
+	// minUsernameLength и maxUsernameLength допустимая длина имени пользователя при изменении профиля
+	minUsernameLength = 3
+	maxUsernameLength = 50
+	// maxDisplayNameLength наибольшая длина отображаемого имени
+	maxDisplayNameLength = 100
+	// maxBioLength наибольшая длина описания профиля
+	maxBioLength = 500
+	// maxAvatarDimension наибольшая ширина и высота аватара в пикселях
+	maxAvatarDimension = 4096
+)
+
+// avatarContentTypes форматы, в которых принимаются аватары
+var avatarContentTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+// GetProfile возвращает профиль владельца токена
+func (s *AuthService) GetProfile(ctx context.Context, token string) (*User, error) {
+	session, err := s.authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.GetUserByID(ctx, session.UserID)
+}
+
+// UpdateProfile изменяет имя пользователя, отображаемое имя и описание профиля владельца токена.
+// Поля, которые не заданы в запросе, не меняются.
+func (s *AuthService) UpdateProfile(ctx context.Context, token string, req UpdateProfileRequest) (*User, error) {
+	session, err := s.authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err = normalizeProfileRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	if req.Username == nil && req.DisplayName == nil && req.Bio == nil {
+		return s.repo.GetUserByID(ctx, session.UserID)
+	}
+
+	return s.repo.UpdateProfile(ctx, session.UserID, req)
+}
+
+// normalizeProfileRequest обрезает пробелы в полях профиля и проверяет их длину
+func normalizeProfileRequest(req UpdateProfileRequest) (UpdateProfileRequest, error) {
+	if req.Username != nil {
+		username := strings.TrimSpace(*req.Username)
+		if length := utf8.RuneCountInString(username); length < minUsernameLength || length > maxUsernameLength {
+			return req, ErrInvalidUsername
+		}
+		req.Username = &username
+	}
+	if req.DisplayName != nil {
+		displayName := strings.TrimSpace(*req.DisplayName)
+		if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+			return req, ErrDisplayNameTooLong
+		}
+		req.DisplayName = &displayName
+	}
+	if req.Bio != nil {
+		bio := strings.TrimSpace(*req.Bio)
+		if utf8.RuneCountInString(bio) > maxBioLength {
+			return req, ErrBioTooLong
+		}
+		req.Bio = &bio
+	}
+	return req, nil
+}
+
+// ChangePassword меняет пароль владельца токена после проверки текущего.
+// Все остальные сессии пользователя завершаются, а персональные токены доступа отзываются.
+func (s *AuthService) ChangePassword(ctx context.Context, token, currentPassword, newPassword string, client ClientInfo) error {
+	session, err := s.authenticate(ctx, token)
+	if err != nil {
+		return err
+	}
+	if len(newPassword) < minPasswordLength {
+		return ErrPasswordTooShort
+	}
+
+	user, err := s.repo.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if err := s.checkCurrentPassword(ctx, user, currentPassword, client); err != nil {
+		return err
+	}
+
+	passwordHash, err := s.passwordService.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.repo.ChangePassword(ctx, user.ID, session.ID, passwordHash); err != nil {
+		return err
+	}
+	log.Printf("Password of user %s has been changed, other sessions and personal access tokens revoked", user.ID)
+
+	// Пароль уже изменён, так что неотправленное письмо только записывается в лог
+	err = s.sendMail(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your PenFeel password was changed",
+		Body: fmt.Sprintf(
+			"Hello, %s!\n\nThe password of your PenFeel account was just changed "+
+				"and all other sessions were signed out. Your personal access tokens have been revoked.\n\n"+
+				"If it was not you, reset your password immediately and contact support.\n",
+			user.Username,
+		),
+	})
+	if err != nil {
+		log.Printf("Error sending password changed email to user %s: %v", user.ID, err)
+	}
+
+	return nil
+}
+
+// ChangeEmail начинает смену email владельца токена после проверки пароля.
+// Новый адрес заменяет текущий только после перехода по ссылке, отправленной на него;
+// до этого пользователь входит с прежним адресом, а прежние ссылки подтверждения перестают действовать.
+func (s *AuthService) ChangeEmail(ctx context.Context, token, newEmail, password string, client ClientInfo) error {
+	session, err := s.authenticate(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	newEmail, err = normalizeEmail(newEmail)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if err := s.checkCurrentPassword(ctx, user, password, client); err != nil {
+		return err
+	}
+	if newEmail == user.Email {
+		return ErrEmailUnchanged
+	}
+
+	// Занятость адреса проверяется ещё раз при подтверждении: его могут занять до перехода по ссылке
+	_, err = s.repo.GetUserByEmail(ctx, newEmail)
+	if err == nil {
+		return ErrEmailTaken
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		return fmt.Errorf("failed to check email: %w", err)
+	}
+
+	if err := s.repo.SetPendingEmail(ctx, user.ID, newEmail); err != nil {
+		return err
+	}
+	link, err := s.verificationLink(ctx, user, newEmail)
+	if err != nil {
+		return err
+	}
+
+	err = s.sendMail(ctx, mailer.Message{
+		To:      newEmail,
+		Subject: "Confirm your new PenFeel email address",
+		Body: fmt.Sprintf(
+			"Hello, %s!\n\nPlease confirm your new email address by opening this link:\n\n%s\n\n"+
+				"The link is valid for %d hours.\n"+
+				"If you did not request this change, ignore this email.\n",
+			user.Username, link, int(s.account.EmailVerificationTTL.Hours()),
+		),
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("User %s requested email change", user.ID)
+
+	// Прежний адрес предупреждается, чтобы владелец заметил смену, которую не начинал
+	err = s.sendMail(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your PenFeel email address is being changed",
+		Body: fmt.Sprintf(
+			"Hello, %s!\n\nA change of your PenFeel account email to %s was requested. "+
+				"It takes effect once the new address is confirmed.\n\n"+
+				"If it was not you, change your password immediately and contact support.\n",
+			user.Username, newEmail,
+		),
+	})
+	if err != nil {
+		log.Printf("Error sending email change notice to user %s: %v", user.ID, err)
+	}
+
+	return nil
+}
+
+// checkCurrentPassword проверяет пароль пользователя перед изменением учётных данных.
+// Проверка учитывается в счётчиках попыток входа с email пользователя и IP клиента,
+// чтобы по украденной сессии нельзя было подбирать пароль без задержек и блокировки.
+func (s *AuthService) checkCurrentPassword(ctx context.Context, user *User, password string, client ClientInfo) error {
+	if !user.HasPassword() {
+		return ErrPasswordNotSet
+	}
+
+	attempts, err := s.reserveLoginAttempt(ctx, s.loginTargets(user.Email, client), time.Now())
+	if err != nil {
+		return err
+	}
+	if err := s.passwordService.CheckPassword(user.PasswordHash, password); err != nil {
+		if err := s.recordLoginFailure(ctx, attempts, user, client); err != nil {
+			return err
+		}
+		return ErrInvalidCredentials
+	}
+	return s.clearLoginAttempt(ctx, attempts)
+}
+
+// normalizeEmail обрезает пробелы и проверяет, что строка — один адрес email без имени получателя
+func normalizeEmail(email string) (string, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return "", ErrEmailRequired
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+// UploadAvatar заменяет аватар владельца токена изображением PNG, JPEG или GIF
+// не больше AvatarMaxSize байт и maxAvatarDimension пикселей по каждой стороне
+func (s *AuthService) UploadAvatar(ctx context.Context, token string, data []byte) (*User, error) {
+	session, err := s.authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.account.AvatarMaxSize > 0 && len(data) > s.account.AvatarMaxSize {
+		return nil, ErrAvatarTooLarge
+	}
+	// Формат определяется по содержимому, а не по имени или заголовкам клиента
+	contentType := http.DetectContentType(data)
+	if !avatarContentTypes[contentType] {
+		return nil, ErrInvalidAvatar
+	}
+	imageConfig, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidAvatar.Wrap(err)
+	}
+	if imageConfig.Width <= 0 || imageConfig.Height <= 0 ||
+		imageConfig.Width > maxAvatarDimension || imageConfig.Height > maxAvatarDimension {
+		return nil, ErrInvalidAvatar
+	}
+
+	avatar := &Avatar{
+		UserID:      session.UserID,
+		ContentType: contentType,
+		Data:        data,
+	}
+	if err := s.repo.SaveAvatar(ctx, avatar); err != nil {
+		return nil, err
+	}
+
+	return s.repo.GetUserByID(ctx, session.UserID)
+}
+
+// DeleteAvatar удаляет аватар владельца токена
+func (s *AuthService) DeleteAvatar(ctx context.Context, token string) error {
+	session, err := s.authenticate(ctx, token)
+	if err != nil {
+		return err
+	}
+	return s.repo.DeleteAvatar(ctx, session.UserID)
+}
+
+// GetAvatar возвращает аватар пользователя. Аватары публичны, поэтому токен не требуется.
+func (s *AuthService) GetAvatar(ctx context.Context, userID string) (*Avatar, error) {
+	id, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, ErrInvalidUserID
+	}
+	return s.repo.GetAvatar(ctx, id)
+}
@@ -2,18 +2,71 @@ package auth
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
+// uniqueViolation код ошибки PostgreSQL при нарушении ограничения уникальности
+const uniqueViolation = "23505"
+
 // Repository интерфейс для работы с хранилищем пользователей
 type Repository interface {
 	CreateUser(ctx context.Context, user *User) error
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	GetUserByID(ctx context.Context, id uuid.UUID) (*User, error)
+	SaveSession(ctx context.Context, session *Session) error
+	GetSession(ctx context.Context, id uuid.UUID) (*Session, error)
+	TouchSession(ctx context.Context, id uuid.UUID) error
+	ListSessions(ctx context.Context, userID uuid.UUID) ([]*Session, error)
+	RevokeSession(ctx context.Context, id, userID uuid.UUID) error
+	RevokeUserSessions(ctx context.Context, userID uuid.UUID) error
+	ListRevokedSessions(ctx context.Context, revokedAfter time.Time) ([]*Session, error)
+	CreatePasswordResetToken(ctx context.Context, token *PasswordResetToken) error
+	ResetPassword(ctx context.Context, tokenHash, passwordHash string) (uuid.UUID, error)
+	CreateEmailVerificationToken(ctx context.Context, token *EmailVerificationToken) error
+	VerifyEmail(ctx context.Context, tokenHash string) (*User, error)
+	StartTOTPSetup(ctx context.Context, userID uuid.UUID, secret string) error
+	EnableTOTP(ctx context.Context, userID uuid.UUID, counter int64, recoveryCodeHashes []string) error
+	DisableTOTP(ctx context.Context, userID uuid.UUID) error
+	UseTOTPCounter(ctx context.Context, userID uuid.UUID, counter int64) error
+	UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error
+	CreateLoginChallenge(ctx context.Context, challenge *LoginChallenge) error
+	GetLoginChallenge(ctx context.Context, tokenHash string) (*LoginChallenge, error)
+	ClaimLoginChallengeAttempt(ctx context.Context, id uuid.UUID, maxAttempts int) error
+	CompleteLoginChallenge(ctx context.Context, id uuid.UUID) error
+	GetLoginThrottle(ctx context.Context, scope, key string) (*LoginThrottle, error)
+	ReserveLoginAttempt(ctx context.Context, seen *LoginThrottle, now, resetBefore time.Time) (*LoginThrottle, error)
+	ReleaseLoginAttempt(ctx context.Context, scope, key string) error
+	ClearLoginThrottle(ctx context.Context, scope, key string) error
+	CreateLoginLockout(ctx context.Context, lockout *LoginLockout) error
+	UnlockWithToken(ctx context.Context, tokenHash string) (*LoginLockout, error)
+	UnlockLogin(ctx context.Context, scope, key, unlockedBy string) error
+	CreatePersonalAccessToken(ctx context.Context, token *PersonalAccessToken, limit int) error
+	ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]*PersonalAccessToken, error)
+	GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*PersonalAccessToken, error)
+	RevokePersonalAccessToken(ctx context.Context, id, userID uuid.UUID) error
+	TouchPersonalAccessToken(ctx context.Context, id uuid.UUID, ipAddress string) error
+	CreateOIDCLoginState(ctx context.Context, state *OIDCLoginState) error
+	UseOIDCLoginState(ctx context.Context, stateHash, bindingHash string) (*OIDCLoginState, error)
+	GetUserIdentity(ctx context.Context, provider, subject string) (*UserIdentity, error)
+	TouchUserIdentity(ctx context.Context, id uuid.UUID, email string) error
+	LinkUserIdentity(ctx context.Context, identity *UserIdentity, resetCredentials bool) error
+	CreateUserWithIdentity(ctx context.Context, user *User, identity *UserIdentity) error
+	UpdateProfile(ctx context.Context, userID uuid.UUID, req UpdateProfileRequest) (*User, error)
+	ChangePassword(ctx context.Context, userID, keepSessionID uuid.UUID, passwordHash string) error
+	SetPendingEmail(ctx context.Context, userID uuid.UUID, email string) error
+	SaveAvatar(ctx context.Context, avatar *Avatar) error
+	GetAvatar(ctx context.Context, userID uuid.UUID) (*Avatar, error)
+	DeleteAvatar(ctx context.Context, userID uuid.UUID) error
+	CreateRefreshToken(ctx context.Context, token *RefreshToken) error
+	UseRefreshToken(ctx context.Context, id uuid.UUID) (*RefreshToken, error)
+	GetRefreshToken(ctx context.Context, id uuid.UUID) (*RefreshToken, error)
 }
 
 // PostgresRepository реализация репозитория для PostgreSQL
@@ -50,7 +103,7 @@ func (r *PostgresRepository) CreateUser(ctx context.Context, user *User) error {
 	).StructScan(user)
 
 	if err != nil {
-		return fmt.Errorf("failed to create user: %w", err)
+		return fmt.Errorf("failed to create user: %w", userError(err))
 	}
 
 	return nil
@@ -63,7 +116,7 @@ func (r *PostgresRepository) GetUserByEmail(ctx context.Context, email string) (
 
 	err := r.db.GetContext(ctx, &user, query, email)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user by email: %w", err)
+		return nil, fmt.Errorf("failed to get user by email: %w", userError(err))
 	}
 
 	return &user, nil
@@ -76,11 +129,1142 @@ func (r *PostgresRepository) GetUserByID(ctx context.Context, id uuid.UUID) (*Us
 
 	err := r.db.GetContext(ctx, &user, query, id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user by id: %w", err)
+		return nil, fmt.Errorf("failed to get user by id: %w", userError(err))
+	}
+
+	return &user, nil
+}
+
+// SaveSession создаёт сессию или обновляет клиента, время активности и срок действия существующей
+func (r *PostgresRepository) SaveSession(ctx context.Context, session *Session) error {
+	query := `
+		INSERT INTO sessions (id, user_id, user_agent, ip_address, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE
+		SET user_agent = EXCLUDED.user_agent,
+		    ip_address = EXCLUDED.ip_address,
+		    last_seen_at = NOW(),
+		    expires_at = EXCLUDED.expires_at
+		RETURNING created_at, last_seen_at
+	`
+
+	err := r.db.QueryRowxContext(
+		ctx,
+		query,
+		session.ID,
+		session.UserID,
+		session.UserAgent,
+		session.IPAddress,
+		session.ExpiresAt,
+	).Scan(&session.CreatedAt, &session.LastSeenAt)
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+
+	return nil
+}
+
+// GetSession получает сессию по ID
+func (r *PostgresRepository) GetSession(ctx context.Context, id uuid.UUID) (*Session, error) {
+	var session Session
+	query := `SELECT * FROM sessions WHERE id = $1`
+
+	err := r.db.GetContext(ctx, &session, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", sessionError(err))
+	}
+
+	return &session, nil
+}
+
+// TouchSession обновляет время последней активности сессии
+func (r *PostgresRepository) TouchSession(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE sessions SET last_seen_at = NOW() WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to touch session: %w", err)
+	}
+
+	return nil
+}
+
+// ListSessions возвращает действующие сессии пользователя, начиная с последней активной
+func (r *PostgresRepository) ListSessions(ctx context.Context, userID uuid.UUID) ([]*Session, error) {
+	var sessions []*Session
+	query := `
+		SELECT * FROM sessions
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC
+	`
+
+	if err := r.db.SelectContext(ctx, &sessions, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession отзывает действующую сессию пользователя.
+// Возвращает ErrSessionNotFound, если такой сессии нет.
+func (r *PostgresRepository) RevokeSession(ctx context.Context, id, userID uuid.UUID) error {
+	query := `
+		UPDATE sessions SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL AND expires_at > NOW()
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if affected == 0 {
+		return ErrSessionNotFound
+	}
+
+	return nil
+}
+
+// RevokeUserSessions отзывает все сессии пользователя
+func (r *PostgresRepository) RevokeUserSessions(ctx context.Context, userID uuid.UUID) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+
+	if _, err := r.db.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to revoke user sessions: %w", err)
+	}
+
+	return nil
+}
+
+// ListRevokedSessions возвращает сессии, отозванные после revokedAfter и ещё не истекшие
+func (r *PostgresRepository) ListRevokedSessions(ctx context.Context, revokedAfter time.Time) ([]*Session, error) {
+	var sessions []*Session
+	query := `
+		SELECT * FROM sessions
+		WHERE revoked_at > $1 AND expires_at > NOW()
+		ORDER BY revoked_at
+	`
+
+	if err := r.db.SelectContext(ctx, &sessions, query, revokedAfter); err != nil {
+		return nil, fmt.Errorf("failed to list revoked sessions: %w", err)
+	}
+
+	return sessions, nil
+}
+
+// CreatePasswordResetToken сохраняет токен сброса пароля и удаляет неиспользованные токены пользователя
+func (r *PostgresRepository) CreatePasswordResetToken(ctx context.Context, token *PasswordResetToken) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+	defer tx.Rollback()
+
+	deleteQuery := `DELETE FROM password_reset_tokens WHERE user_id = $1 AND used_at IS NULL`
+	if _, err := tx.ExecContext(ctx, deleteQuery, token.UserID); err != nil {
+		return fmt.Errorf("failed to delete previous password reset tokens: %w", err)
+	}
+
+	insertQuery := `
+		INSERT INTO password_reset_tokens (id, user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`
+	err = tx.QueryRowxContext(ctx, insertQuery, token.ID, token.UserID, token.TokenHash, token.ExpiresAt).
+		Scan(&token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+	return nil
+}
+
+// ResetPassword погашает токен сброса пароля, устанавливает новый хеш пароля
+// и отзывает все сессии и персональные токены доступа пользователя. Возвращает ID пользователя или
+// ErrInvalidResetToken, если токен не найден, истёк или уже использован.
+func (r *PostgresRepository) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (uuid.UUID, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to reset password: %w", err)
 	}
+	defer tx.Rollback()
 
+	var userID uuid.UUID
+	useQuery := `
+		UPDATE password_reset_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id
+	`
+	err = tx.GetContext(ctx, &userID, useQuery, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return uuid.Nil, ErrInvalidResetToken
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to use password reset token: %w", err)
+	}
+
+	passwordQuery := `UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2`
+	if _, err := tx.ExecContext(ctx, passwordQuery, passwordHash, userID); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to update password: %w", err)
+	}
+
+	sessionsQuery := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.ExecContext(ctx, sessionsQuery, userID); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to revoke user sessions: %w", err)
+	}
+
+	tokensQuery := `UPDATE personal_access_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.ExecContext(ctx, tokensQuery, userID); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to revoke personal access tokens: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, fmt.Errorf("failed to reset password: %w", err)
+	}
+	return userID, nil
+}
+
+// CreateEmailVerificationToken сохраняет токен подтверждения email и удаляет неиспользованные токены пользователя
+func (r *PostgresRepository) CreateEmailVerificationToken(ctx context.Context, token *EmailVerificationToken) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create email verification token: %w", err)
+	}
+	defer tx.Rollback()
+
+	deleteQuery := `DELETE FROM email_verification_tokens WHERE user_id = $1 AND used_at IS NULL`
+	if _, err := tx.ExecContext(ctx, deleteQuery, token.UserID); err != nil {
+		return fmt.Errorf("failed to delete previous email verification tokens: %w", err)
+	}
+
+	insertQuery := `
+		INSERT INTO email_verification_tokens (id, user_id, email, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at
+	`
+	err = tx.QueryRowxContext(ctx, insertQuery, token.ID, token.UserID, token.Email, token.TokenHash, token.ExpiresAt).
+		Scan(&token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create email verification token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create email verification token: %w", err)
+	}
+	return nil
+}
+
+// VerifyEmail погашает токен подтверждения и отмечает email пользователя подтверждённым.
+// Токен нового email, ожидающего подтверждения, заменяет им прежний email.
+// Возвращает ErrInvalidVerificationToken, если токен не найден, истёк, уже использован
+// или выдан для адреса, который пользователь с тех пор сменил, и ErrEmailTaken,
+// если новый email успел занять другой пользователь.
+func (r *PostgresRepository) VerifyEmail(ctx context.Context, tokenHash string) (*User, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify email: %w", err)
+	}
+	defer tx.Rollback()
+
+	var token EmailVerificationToken
+	useQuery := `
+		UPDATE email_verification_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING *
+	`
+	err = tx.GetContext(ctx, &token, useQuery, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to use email verification token: %w", err)
+	}
+
+	var user User
+	verifyQuery := `
+		UPDATE users SET
+			email_verified_at = CASE WHEN email = $2 THEN COALESCE(email_verified_at, NOW()) ELSE NOW() END,
+			email = $2,
+			pending_email = CASE WHEN pending_email = $2 THEN NULL ELSE pending_email END,
+			updated_at = NOW()
+		WHERE id = $1 AND (email = $2 OR pending_email = $2)
+		RETURNING *
+	`
+	err = tx.GetContext(ctx, &user, verifyQuery, token.UserID, token.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify email: %w", userError(err))
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to verify email: %w", err)
+	}
 	return &user, nil
 }
 
-// ErrUserNotFound ошибка, когда пользователь не найден
-var ErrUserNotFound = errors.New("user not found")
+// StartTOTPSetup сохраняет новый, ещё не подтверждённый секрет TOTP.
+// Возвращает ErrTwoFactorAlreadyEnabled, если двухфакторная аутентификация уже включена.
+func (r *PostgresRepository) StartTOTPSetup(ctx context.Context, userID uuid.UUID, secret string) error {
+	query := `
+		UPDATE users SET totp_secret = $2, totp_last_counter = 0, updated_at = NOW()
+		WHERE id = $1 AND totp_enabled_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, secret)
+	if err != nil {
+		return fmt.Errorf("failed to save TOTP secret: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to save TOTP secret: %w", err)
+	}
+	if affected == 0 {
+		return ErrTwoFactorAlreadyEnabled
+	}
+
+	return nil
+}
+
+// EnableTOTP включает двухфакторную аутентификацию, запоминая интервал подтверждающего кода,
+// и заменяет коды восстановления пользователя
+func (r *PostgresRepository) EnableTOTP(ctx context.Context, userID uuid.UUID, counter int64, recoveryCodeHashes []string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+	defer tx.Rollback()
+
+	enableQuery := `
+		UPDATE users SET totp_enabled_at = NOW(), totp_last_counter = $2, updated_at = NOW()
+		WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL
+	`
+	result, err := tx.ExecContext(ctx, enableQuery, userID, counter)
+	if err != nil {
+		return fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+	if affected == 0 {
+		return ErrTwoFactorAlreadyEnabled
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	for _, hash := range recoveryCodeHashes {
+		insertQuery := `INSERT INTO recovery_codes (id, user_id, code_hash) VALUES ($1, $2, $3)`
+		if _, err := tx.ExecContext(ctx, insertQuery, uuid.New(), userID, hash); err != nil {
+			return fmt.Errorf("failed to save recovery code: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to enable TOTP: %w", err)
+	}
+	return nil
+}
+
+// DisableTOTP выключает двухфакторную аутентификацию и удаляет коды восстановления
+func (r *PostgresRepository) DisableTOTP(ctx context.Context, userID uuid.UUID) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to disable TOTP: %w", err)
+	}
+	defer tx.Rollback()
+
+	disableQuery := `
+		UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_counter = 0, updated_at = NOW()
+		WHERE id = $1
+	`
+	if _, err := tx.ExecContext(ctx, disableQuery, userID); err != nil {
+		return fmt.Errorf("failed to disable TOTP: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to disable TOTP: %w", err)
+	}
+	return nil
+}
+
+// UseTOTPCounter запоминает интервал принятого кода TOTP.
+// Возвращает ErrInvalidTwoFactorCode, если код этого или более позднего интервала уже использован.
+func (r *PostgresRepository) UseTOTPCounter(ctx context.Context, userID uuid.UUID, counter int64) error {
+	query := `UPDATE users SET totp_last_counter = $2 WHERE id = $1 AND totp_last_counter < $2`
+
+	result, err := r.db.ExecContext(ctx, query, userID, counter)
+	if err != nil {
+		return fmt.Errorf("failed to use TOTP code: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to use TOTP code: %w", err)
+	}
+	if affected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// UseRecoveryCode погашает код восстановления пользователя.
+// Возвращает ErrInvalidTwoFactorCode, если такого неиспользованного кода нет.
+func (r *PostgresRepository) UseRecoveryCode(ctx context.Context, userID uuid.UUID, codeHash string) error {
+	query := `
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	if affected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+
+	return nil
+}
+
+// CreateLoginChallenge сохраняет незавершённый вход
+func (r *PostgresRepository) CreateLoginChallenge(ctx context.Context, challenge *LoginChallenge) error {
+	query := `
+		INSERT INTO login_challenges (id, user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`
+
+	err := r.db.QueryRowxContext(ctx, query, challenge.ID, challenge.UserID, challenge.TokenHash, challenge.ExpiresAt).
+		Scan(&challenge.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create login challenge: %w", err)
+	}
+
+	return nil
+}
+
+// GetLoginChallenge получает незавершённый вход по хешу токена.
+// Возвращает ErrInvalidLoginChallenge, если такого нет.
+func (r *PostgresRepository) GetLoginChallenge(ctx context.Context, tokenHash string) (*LoginChallenge, error) {
+	var challenge LoginChallenge
+	query := `SELECT * FROM login_challenges WHERE token_hash = $1`
+
+	err := r.db.GetContext(ctx, &challenge, query, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidLoginChallenge
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login challenge: %w", err)
+	}
+
+	return &challenge, nil
+}
+
+// ClaimLoginChallengeAttempt учитывает попытку ввести код до его проверки. Проверка и учёт
+// выполняются одним запросом, поэтому параллельные запросы не получат больше maxAttempts попыток.
+// Возвращает ErrInvalidLoginChallenge, если вход завершён, истёк или попытки исчерпаны.
+func (r *PostgresRepository) ClaimLoginChallengeAttempt(ctx context.Context, id uuid.UUID, maxAttempts int) error {
+	query := `
+		UPDATE login_challenges SET failed_attempts = failed_attempts + 1
+		WHERE id = $1 AND completed_at IS NULL AND expires_at > NOW() AND failed_attempts < $2
+		RETURNING failed_attempts
+	`
+
+	var attempts int
+	err := r.db.QueryRowxContext(ctx, query, id, maxAttempts).Scan(&attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrInvalidLoginChallenge
+	}
+	if err != nil {
+		return fmt.Errorf("failed to claim login challenge attempt: %w", err)
+	}
+
+	return nil
+}
+
+// CompleteLoginChallenge завершает вход. Возвращает ErrInvalidLoginChallenge,
+// если вход уже завершён параллельным запросом.
+func (r *PostgresRepository) CompleteLoginChallenge(ctx context.Context, id uuid.UUID) error {
+	query := `UPDATE login_challenges SET completed_at = NOW() WHERE id = $1 AND completed_at IS NULL`
+
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to complete login challenge: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to complete login challenge: %w", err)
+	}
+	if affected == 0 {
+		return ErrInvalidLoginChallenge
+	}
+
+	return nil
+}
+
+// GetLoginThrottle получает неудачные попытки входа. Если попыток не было,
+// возвращает счётчик с нулём попыток.
+func (r *PostgresRepository) GetLoginThrottle(ctx context.Context, scope, key string) (*LoginThrottle, error) {
+	var throttle LoginThrottle
+	query := `SELECT * FROM login_throttles WHERE scope = $1 AND throttle_key = $2`
+
+	err := r.db.GetContext(ctx, &throttle, query, scope, key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &LoginThrottle{Scope: scope, Key: key}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login throttle: %w", err)
+	}
+
+	return &throttle, nil
+}
+
+// ReserveLoginAttempt учитывает попытку входа и возвращает обновлённый счётчик.
+// Попытка учитывается, только если счётчик не менялся с чтения seen, иначе возвращает ErrLoginThrottleChanged.
+// Попытки до resetBefore не учитываются, счёт начинается заново.
+func (r *PostgresRepository) ReserveLoginAttempt(ctx context.Context, seen *LoginThrottle, now, resetBefore time.Time) (*LoginThrottle, error) {
+	var throttle LoginThrottle
+	query := `
+		INSERT INTO login_throttles (scope, throttle_key, failed_attempts, last_failed_at)
+		VALUES ($1, $2, 1, $3)
+		ON CONFLICT (scope, throttle_key) DO UPDATE SET
+			failed_attempts = CASE
+				WHEN login_throttles.last_failed_at < $4 THEN 1
+				ELSE login_throttles.failed_attempts + 1
+			END,
+			last_failed_at = $3
+		WHERE login_throttles.failed_attempts = $5 AND login_throttles.last_failed_at = $6
+		RETURNING *
+	`
+
+	err := r.db.GetContext(ctx, &throttle, query,
+		seen.Scope, seen.Key, now, resetBefore, seen.FailedAttempts, seen.LastFailedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrLoginThrottleChanged
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to reserve login attempt: %w", err)
+	}
+
+	return &throttle, nil
+}
+
+// ReleaseLoginAttempt отменяет учтённую попытку входа, которая оказалась удачной
+func (r *PostgresRepository) ReleaseLoginAttempt(ctx context.Context, scope, key string) error {
+	query := `
+		UPDATE login_throttles SET failed_attempts = failed_attempts - 1
+		WHERE scope = $1 AND throttle_key = $2 AND failed_attempts > 0
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, scope, key); err != nil {
+		return fmt.Errorf("failed to release login attempt: %w", err)
+	}
+
+	return nil
+}
+
+// ClearLoginThrottle сбрасывает неудачные попытки входа
+func (r *PostgresRepository) ClearLoginThrottle(ctx context.Context, scope, key string) error {
+	query := `DELETE FROM login_throttles WHERE scope = $1 AND throttle_key = $2`
+
+	if _, err := r.db.ExecContext(ctx, query, scope, key); err != nil {
+		return fmt.Errorf("failed to clear login throttle: %w", err)
+	}
+
+	return nil
+}
+
+// CreateLoginLockout записывает блокировку входа в журнал
+func (r *PostgresRepository) CreateLoginLockout(ctx context.Context, lockout *LoginLockout) error {
+	query := `
+		INSERT INTO login_lockouts (
+			id, scope, throttle_key, user_id, ip_address, failed_attempts, locked_until,
+			unlock_token_hash, unlock_expires_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING created_at
+	`
+
+	err := r.db.QueryRowxContext(ctx, query,
+		lockout.ID, lockout.Scope, lockout.Key, lockout.UserID, lockout.IPAddress, lockout.FailedAttempts,
+		lockout.LockedUntil, lockout.UnlockTokenHash, lockout.UnlockExpiresAt,
+	).Scan(&lockout.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create login lockout: %w", err)
+	}
+
+	return nil
+}
+
+// UnlockWithToken снимает блокировку по токену из письма.
+// Возвращает ErrInvalidUnlockToken, если токен не найден, истёк или блокировка уже снята.
+func (r *PostgresRepository) UnlockWithToken(ctx context.Context, tokenHash string) (*LoginLockout, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock login: %w", err)
+	}
+	defer tx.Rollback()
+
+	var lockout LoginLockout
+	unlockQuery := `
+		UPDATE login_lockouts SET unlocked_at = NOW(), unlocked_by = $2
+		WHERE unlock_token_hash = $1 AND unlocked_at IS NULL AND unlock_expires_at > NOW()
+		RETURNING *
+	`
+	err = tx.GetContext(ctx, &lockout, unlockQuery, tokenHash, UnlockedByEmail)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidUnlockToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock login: %w", err)
+	}
+
+	clearQuery := `DELETE FROM login_throttles WHERE scope = $1 AND throttle_key = $2`
+	if _, err := tx.ExecContext(ctx, clearQuery, lockout.Scope, lockout.Key); err != nil {
+		return nil, fmt.Errorf("failed to clear login throttle: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to unlock login: %w", err)
+	}
+	return &lockout, nil
+}
+
+// UnlockLogin сбрасывает неудачные попытки входа и отмечает действующие блокировки снятыми
+func (r *PostgresRepository) UnlockLogin(ctx context.Context, scope, key, unlockedBy string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to unlock login: %w", err)
+	}
+	defer tx.Rollback()
+
+	clearQuery := `DELETE FROM login_throttles WHERE scope = $1 AND throttle_key = $2`
+	if _, err := tx.ExecContext(ctx, clearQuery, scope, key); err != nil {
+		return fmt.Errorf("failed to clear login throttle: %w", err)
+	}
+
+	unlockQuery := `
+		UPDATE login_lockouts SET unlocked_at = NOW(), unlocked_by = $3
+		WHERE scope = $1 AND throttle_key = $2 AND unlocked_at IS NULL AND locked_until > NOW()
+	`
+	if _, err := tx.ExecContext(ctx, unlockQuery, scope, key, unlockedBy); err != nil {
+		return fmt.Errorf("failed to unlock login: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to unlock login: %w", err)
+	}
+	return nil
+}
+
+// CreatePersonalAccessToken сохраняет персональный токен доступа.
+// Возвращает ErrPersonalTokenLimit, если у пользователя уже limit действующих токенов.
+func (r *PostgresRepository) CreatePersonalAccessToken(ctx context.Context, token *PersonalAccessToken, limit int) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create personal access token: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Блокировка строки пользователя не даёт параллельным запросам превысить лимит
+	if _, err := tx.ExecContext(ctx, `SELECT id FROM users WHERE id = $1 FOR UPDATE`, token.UserID); err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	var count int
+	countQuery := `
+		SELECT COUNT(*) FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL AND expires_at > NOW()
+	`
+	if err := tx.GetContext(ctx, &count, countQuery, token.UserID); err != nil {
+		return fmt.Errorf("failed to count personal access tokens: %w", err)
+	}
+	if count >= limit {
+		return ErrPersonalTokenLimit
+	}
+
+	insertQuery := `
+		INSERT INTO personal_access_tokens (id, user_id, name, token_prefix, token_hash, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at
+	`
+	err = tx.QueryRowxContext(ctx, insertQuery,
+		token.ID, token.UserID, token.Name, token.TokenPrefix, token.TokenHash, token.Scopes, token.ExpiresAt,
+	).Scan(&token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create personal access token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create personal access token: %w", err)
+	}
+	return nil
+}
+
+// ListPersonalAccessTokens возвращает неотозванные персональные токены пользователя, включая истёкшие
+func (r *PostgresRepository) ListPersonalAccessTokens(ctx context.Context, userID uuid.UUID) ([]*PersonalAccessToken, error) {
+	var tokens []*PersonalAccessToken
+	query := `
+		SELECT * FROM personal_access_tokens
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`
+
+	if err := r.db.SelectContext(ctx, &tokens, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to list personal access tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// GetPersonalAccessTokenByHash получает персональный токен по хешу.
+// Возвращает ErrPersonalTokenNotFound, если такого нет.
+func (r *PostgresRepository) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*PersonalAccessToken, error) {
+	var token PersonalAccessToken
+	query := `SELECT * FROM personal_access_tokens WHERE token_hash = $1`
+
+	err := r.db.GetContext(ctx, &token, query, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrPersonalTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get personal access token: %w", err)
+	}
+
+	return &token, nil
+}
+
+// RevokePersonalAccessToken отзывает персональный токен пользователя userID.
+// Возвращает ErrPersonalTokenNotFound, если у пользователя нет такого неотозванного токена.
+func (r *PostgresRepository) RevokePersonalAccessToken(ctx context.Context, id, userID uuid.UUID) error {
+	query := `
+		UPDATE personal_access_tokens SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke personal access token: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke personal access token: %w", err)
+	}
+	if affected == 0 {
+		return ErrPersonalTokenNotFound
+	}
+
+	return nil
+}
+
+// TouchPersonalAccessToken обновляет время и адрес последнего использования персонального токена
+func (r *PostgresRepository) TouchPersonalAccessToken(ctx context.Context, id uuid.UUID, ipAddress string) error {
+	query := `UPDATE personal_access_tokens SET last_used_at = NOW(), last_used_ip = $2 WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, id, ipAddress); err != nil {
+		return fmt.Errorf("failed to update personal access token usage: %w", err)
+	}
+
+	return nil
+}
+
+// CreateOIDCLoginState сохраняет начатый вход через провайдера и удаляет истёкшие
+func (r *PostgresRepository) CreateOIDCLoginState(ctx context.Context, state *OIDCLoginState) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM oidc_login_states WHERE expires_at < NOW()`); err != nil {
+		return fmt.Errorf("failed to delete expired OIDC login states: %w", err)
+	}
+
+	query := `
+		INSERT INTO oidc_login_states (id, provider, state_hash, binding_hash, nonce, code_verifier, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at
+	`
+
+	err := r.db.QueryRowxContext(ctx, query, state.ID, state.Provider, state.StateHash, state.BindingHash, state.Nonce, state.CodeVerifier, state.ExpiresAt).
+		Scan(&state.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create OIDC login state: %w", err)
+	}
+
+	return nil
+}
+
+// UseOIDCLoginState помечает начатый вход использованным и возвращает его.
+// Проверка и отметка выполняются одним запросом, поэтому state принимается только один раз.
+// Возвращает ErrInvalidOIDCState, если вход не найден, истёк, уже завершён или начат с другой привязкой;
+// вход с чужой привязкой не помечается использованным.
+func (r *PostgresRepository) UseOIDCLoginState(ctx context.Context, stateHash, bindingHash string) (*OIDCLoginState, error) {
+	var state OIDCLoginState
+	query := `
+		UPDATE oidc_login_states SET used_at = NOW()
+		WHERE state_hash = $1 AND binding_hash = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING *
+	`
+
+	err := r.db.GetContext(ctx, &state, query, stateHash, bindingHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to use OIDC login state: %w", err)
+	}
+
+	return &state, nil
+}
+
+// GetUserIdentity получает учётную запись провайдера provider с идентификатором subject.
+// Возвращает ErrIdentityNotFound, если она не связана с пользователем.
+func (r *PostgresRepository) GetUserIdentity(ctx context.Context, provider, subject string) (*UserIdentity, error) {
+	var identity UserIdentity
+	query := `SELECT * FROM user_identities WHERE provider = $1 AND subject = $2`
+
+	err := r.db.GetContext(ctx, &identity, query, provider, subject)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrIdentityNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user identity: %w", err)
+	}
+
+	return &identity, nil
+}
+
+// TouchUserIdentity обновляет время входа и email учётной записи провайдера
+func (r *PostgresRepository) TouchUserIdentity(ctx context.Context, id uuid.UUID, email string) error {
+	query := `UPDATE user_identities SET last_login_at = NOW(), email = $2 WHERE id = $1`
+	if _, err := r.db.ExecContext(ctx, query, id, email); err != nil {
+		return fmt.Errorf("failed to update user identity: %w", err)
+	}
+	return nil
+}
+
+// LinkUserIdentity связывает учётную запись провайдера с существующим пользователем.
+// С resetCredentials email пользователя помечается подтверждённым, а пароль, двухфакторная
+// аутентификация, сессии и персональные токены удаляются вместе с привязкой.
+func (r *PostgresRepository) LinkUserIdentity(ctx context.Context, identity *UserIdentity, resetCredentials bool) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to link user identity: %w", err)
+	}
+	defer tx.Rollback()
+
+	if resetCredentials {
+		resetQueries := []string{
+			`UPDATE users SET email_verified_at = NOW(), password_hash = '',
+				totp_secret = NULL, totp_enabled_at = NULL, totp_last_counter = 0, updated_at = NOW()
+			WHERE id = $1`,
+			`DELETE FROM recovery_codes WHERE user_id = $1`,
+			`UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
+			`UPDATE personal_access_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
+		}
+		for _, query := range resetQueries {
+			if _, err := tx.ExecContext(ctx, query, identity.UserID); err != nil {
+				return fmt.Errorf("failed to reset user credentials: %w", err)
+			}
+		}
+	}
+
+	if err := insertUserIdentity(ctx, tx, identity); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to link user identity: %w", err)
+	}
+	return nil
+}
+
+// CreateUserWithIdentity создаёт пользователя с подтверждённым email и связывает с ним учётную запись провайдера
+func (r *PostgresRepository) CreateUserWithIdentity(ctx context.Context, user *User, identity *UserIdentity) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	defer tx.Rollback()
+
+	userQuery := `
+		INSERT INTO users (id, username, email, password_hash, email_verified_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING created_at, updated_at, email_verified_at
+	`
+	err = tx.QueryRowxContext(ctx, userQuery, user.ID, user.Username, user.Email, user.PasswordHash).StructScan(user)
+	if err != nil {
+		return fmt.Errorf("failed to create user: %w", userError(err))
+	}
+
+	identity.UserID = user.ID
+	if err := insertUserIdentity(ctx, tx, identity); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create user: %w", err)
+	}
+	return nil
+}
+
+// insertUserIdentity сохраняет учётную запись провайдера в транзакции
+func insertUserIdentity(ctx context.Context, tx *sqlx.Tx, identity *UserIdentity) error {
+	query := `
+		INSERT INTO user_identities (id, user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at, last_login_at
+	`
+
+	err := tx.QueryRowxContext(ctx, query, identity.ID, identity.UserID, identity.Provider, identity.Subject, identity.Email).
+		Scan(&identity.CreatedAt, &identity.LastLoginAt)
+	if err != nil {
+		return fmt.Errorf("failed to save user identity: %w", err)
+	}
+	return nil
+}
+
+// UpdateProfile изменяет заданные поля профиля пользователя.
+// Возвращает ErrUsernameTaken, если новое имя занято.
+func (r *PostgresRepository) UpdateProfile(ctx context.Context, userID uuid.UUID, req UpdateProfileRequest) (*User, error) {
+	var user User
+	query := `
+		UPDATE users SET
+			username = COALESCE($2, username),
+			display_name = COALESCE($3, display_name),
+			bio = COALESCE($4, bio),
+			updated_at = NOW()
+		WHERE id = $1
+		RETURNING *
+	`
+
+	err := r.db.GetContext(ctx, &user, query, userID, req.Username, req.DisplayName, req.Bio)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update profile: %w", userError(err))
+	}
+
+	return &user, nil
+}
+
+// ChangePassword устанавливает новый пароль, отзывает персональные токены доступа и все сессии пользователя, кроме keepSessionID
+func (r *PostgresRepository) ChangePassword(ctx context.Context, userID, keepSessionID uuid.UUID, passwordHash string) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+	defer tx.Rollback()
+
+	passwordQuery := `UPDATE users SET password_hash = $1, updated_at = NOW() WHERE id = $2`
+	if _, err := tx.ExecContext(ctx, passwordQuery, passwordHash, userID); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+
+	sessionsQuery := `UPDATE sessions SET revoked_at = NOW() WHERE user_id = $1 AND id <> $2 AND revoked_at IS NULL`
+	if _, err := tx.ExecContext(ctx, sessionsQuery, userID, keepSessionID); err != nil {
+		return fmt.Errorf("failed to revoke user sessions: %w", err)
+	}
+
+	tokensQuery := `UPDATE personal_access_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := tx.ExecContext(ctx, tokensQuery, userID); err != nil {
+		return fmt.Errorf("failed to revoke personal access tokens: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to change password: %w", err)
+	}
+	return nil
+}
+
+// SetPendingEmail запоминает новый email пользователя до его подтверждения
+func (r *PostgresRepository) SetPendingEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	query := `UPDATE users SET pending_email = $2, updated_at = NOW() WHERE id = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, userID, email); err != nil {
+		return fmt.Errorf("failed to set pending email: %w", err)
+	}
+
+	return nil
+}
+
+// SaveAvatar сохраняет аватар пользователя вместо прежнего
+func (r *PostgresRepository) SaveAvatar(ctx context.Context, avatar *Avatar) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to save avatar: %w", err)
+	}
+	defer tx.Rollback()
+
+	avatarQuery := `
+		INSERT INTO user_avatars (user_id, content_type, data, updated_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET
+		    content_type = EXCLUDED.content_type,
+		    data = EXCLUDED.data,
+		    updated_at = EXCLUDED.updated_at
+		RETURNING updated_at
+	`
+	err = tx.QueryRowxContext(ctx, avatarQuery, avatar.UserID, avatar.ContentType, avatar.Data).Scan(&avatar.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save avatar: %w", err)
+	}
+
+	userQuery := `UPDATE users SET avatar_updated_at = $2, updated_at = NOW() WHERE id = $1`
+	if _, err := tx.ExecContext(ctx, userQuery, avatar.UserID, avatar.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to save avatar: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save avatar: %w", err)
+	}
+	return nil
+}
+
+// GetAvatar получает аватар пользователя
+func (r *PostgresRepository) GetAvatar(ctx context.Context, userID uuid.UUID) (*Avatar, error) {
+	var avatar Avatar
+	query := `SELECT * FROM user_avatars WHERE user_id = $1`
+
+	err := r.db.GetContext(ctx, &avatar, query, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAvatarNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get avatar: %w", err)
+	}
+
+	return &avatar, nil
+}
+
+// DeleteAvatar удаляет аватар пользователя.
+// Возвращает ErrAvatarNotFound, если аватара нет.
+func (r *PostgresRepository) DeleteAvatar(ctx context.Context, userID uuid.UUID) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete avatar: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM user_avatars WHERE user_id = $1`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete avatar: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to delete avatar: %w", err)
+	}
+	if affected == 0 {
+		return ErrAvatarNotFound
+	}
+
+	userQuery := `UPDATE users SET avatar_updated_at = NULL, updated_at = NOW() WHERE id = $1`
+	if _, err := tx.ExecContext(ctx, userQuery, userID); err != nil {
+		return fmt.Errorf("failed to delete avatar: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete avatar: %w", err)
+	}
+	return nil
+}
+
+// CreateRefreshToken сохраняет выданный refresh токен
+func (r *PostgresRepository) CreateRefreshToken(ctx context.Context, token *RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (id, session_id, user_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`
+
+	err := r.db.QueryRowxContext(ctx, query, token.ID, token.SessionID, token.UserID, token.ExpiresAt).
+		Scan(&token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create refresh token: %w", err)
+	}
+
+	return nil
+}
+
+// UseRefreshToken помечает действующий refresh токен действующей сессии использованным.
+// Проверка и отметка выполняются одним запросом, поэтому токен обменивается только один раз.
+// Использованный, истёкший, неизвестный токен или токен отозванной сессии даёт ErrRefreshTokenNotFound.
+func (r *PostgresRepository) UseRefreshToken(ctx context.Context, id uuid.UUID) (*RefreshToken, error) {
+	var token RefreshToken
+	query := `
+		UPDATE refresh_tokens rt
+		SET used_at = NOW()
+		FROM sessions s
+		WHERE rt.id = $1 AND rt.used_at IS NULL AND rt.expires_at > NOW()
+		  AND s.id = rt.session_id AND s.revoked_at IS NULL
+		RETURNING rt.*
+	`
+
+	err := r.db.GetContext(ctx, &token, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use refresh token: %w", refreshTokenError(err))
+	}
+
+	return &token, nil
+}
+
+// GetRefreshToken получает refresh токен по ID
+func (r *PostgresRepository) GetRefreshToken(ctx context.Context, id uuid.UUID) (*RefreshToken, error) {
+	var token RefreshToken
+	query := `SELECT * FROM refresh_tokens WHERE id = $1`
+
+	err := r.db.GetContext(ctx, &token, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", refreshTokenError(err))
+	}
+
+	return &token, nil
+}
+
+// sessionError заменяет отсутствие строки на ErrSessionNotFound
+func sessionError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrSessionNotFound
+	}
+	return err
+}
+
+// refreshTokenError заменяет отсутствие строки на ErrRefreshTokenNotFound
+func refreshTokenError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRefreshTokenNotFound
+	}
+	return err
+}
+
+// userError заменяет отсутствие строки и нарушение уникальности на ошибки предметной области
+func userError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUserNotFound
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		switch pqErr.Constraint {
+		case "users_email_key":
+			return ErrEmailTaken
+		case "users_username_key":
+			return ErrUsernameTaken
+		}
+	}
+	return err
+}
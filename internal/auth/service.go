@@ -4,16 +4,66 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/malaxitlmax/penfeel/config"
 	pkgauth "github.com/malaxitlmax/penfeel/pkg/auth"
+	"github.com/malaxitlmax/penfeel/pkg/mailer"
+	"github.com/malaxitlmax/penfeel/pkg/oidc"
 )
 
+// minPasswordLength минимальная длина пароля
+const minPasswordLength = 6
+
+// sessionTouchInterval как часто обновлять время последней активности сессии
+const sessionTouchInterval = time.Minute
+
+// maxChallengeAttempts сколько неверных кодов можно ввести на втором шаге входа
+const maxChallengeAttempts = 5
+
+// recoveryCodeCount сколько кодов восстановления выдаётся при включении двухфакторной аутентификации
+const recoveryCodeCount = 10
+
 // Service интерфейс для сервиса авторизации
 type Service interface {
 	Register(ctx context.Context, req RegisterRequest) (*User, error)
 	Login(ctx context.Context, req LoginRequest) (*TokenResponse, error)
 	ValidateToken(ctx context.Context, token string) (*ValidationResponse, error)
+	RefreshToken(ctx context.Context, refreshToken string, client ClientInfo) (*TokenResponse, error)
+	Logout(ctx context.Context, token string) error
+	LogoutAll(ctx context.Context, token string) error
+	ListSessions(ctx context.Context, token string) ([]*Session, uuid.UUID, error)
+	RevokeSession(ctx context.Context, token, sessionID string) error
+	JWKS(ctx context.Context) pkgauth.JWKS
+	ListRevokedSessions(ctx context.Context, revokedAfter time.Time) ([]*Session, error)
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	VerifyEmail(ctx context.Context, token string) (*User, error)
+	ResendVerification(ctx context.Context, email string) error
+	CompleteLogin(ctx context.Context, challengeToken, code string, client ClientInfo) (*TokenResponse, error)
+	SetupTOTP(ctx context.Context, token string) (*TOTPSetup, error)
+	ConfirmTOTP(ctx context.Context, token, code string) ([]string, error)
+	DisableTOTP(ctx context.Context, token, password, code string, client ClientInfo) error
+	UnlockAccount(ctx context.Context, token string) error
+	AdminUnlockLogin(ctx context.Context, email, ipAddress string) error
+	CreatePersonalAccessToken(ctx context.Context, token string, req CreatePersonalTokenRequest) (*PersonalAccessToken, string, error)
+	ListPersonalAccessTokens(ctx context.Context, token string) ([]*PersonalAccessToken, error)
+	RevokePersonalAccessToken(ctx context.Context, token, tokenID string) error
+	ValidatePersonalAccessToken(ctx context.Context, token string, client ClientInfo) (*PersonalAccessToken, *User, error)
+	ListOIDCProviders(ctx context.Context) []OIDCProviderInfo
+	StartOIDCLogin(ctx context.Context, providerID string) (*OIDCLoginStart, error)
+	CompleteOIDCLogin(ctx context.Context, state, binding, code string, client ClientInfo) (*TokenResponse, error)
+	GetProfile(ctx context.Context, token string) (*User, error)
+	UpdateProfile(ctx context.Context, token string, req UpdateProfileRequest) (*User, error)
+	ChangePassword(ctx context.Context, token, currentPassword, newPassword string, client ClientInfo) error
+	ChangeEmail(ctx context.Context, token, newEmail, password string, client ClientInfo) error
+	UploadAvatar(ctx context.Context, token string, data []byte) (*User, error)
+	DeleteAvatar(ctx context.Context, token string) error
+	GetAvatar(ctx context.Context, userID string) (*Avatar, error)
 }
 
 // AuthService реализация сервиса авторизации
@@ -21,23 +71,44 @@ type AuthService struct {
 	repo            Repository
 	passwordService *pkgauth.PasswordService
 	jwtService      *pkgauth.JWTService
+	mailer          mailer.Mailer
+	mailTimeout     time.Duration
+	account         config.AccountConfig
+	protection      config.LoginProtectionConfig
+	oidcProviders   []*oidc.Provider
+	oidcStateTTL    time.Duration
 }
 
-// NewAuthService создает новый сервис авторизации
-func NewAuthService(repo Repository, passwordService *pkgauth.PasswordService, jwtService *pkgauth.JWTService) *AuthService {
+// NewAuthService создает новый сервис авторизации.
+// Письма пользователям отправляются через mail с дедлайном mailTimeout.
+// Через oidcProviders можно войти без пароля; начатый вход действует oidcStateTTL.
+func NewAuthService(repo Repository, passwordService *pkgauth.PasswordService, jwtService *pkgauth.JWTService, mail mailer.Mailer, mailTimeout time.Duration, account config.AccountConfig, protection config.LoginProtectionConfig, oidcProviders []*oidc.Provider, oidcStateTTL time.Duration) *AuthService {
 	return &AuthService{
 		repo:            repo,
 		passwordService: passwordService,
 		jwtService:      jwtService,
+		mailer:          mail,
+		mailTimeout:     mailTimeout,
+		account:         account,
+		protection:      protection,
+		oidcProviders:   oidcProviders,
+		oidcStateTTL:    oidcStateTTL,
 	}
 }
 
 // Register регистрирует нового пользователя
 func (s *AuthService) Register(ctx context.Context, req RegisterRequest) (*User, error) {
+	if err := validateRegisterRequest(req); err != nil {
+		return nil, err
+	}
+
 	// Проверяем, существует ли пользователь с таким email
 	existingUser, err := s.repo.GetUserByEmail(ctx, req.Email)
 	if err == nil && existingUser != nil {
-		return nil, errors.New("user with this email already exists")
+		return nil, ErrEmailTaken
+	}
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		return nil, fmt.Errorf("failed to check email: %w", err)
 	}
 
 	// Хешируем пароль
@@ -59,33 +130,161 @@ func (s *AuthService) Register(ctx context.Context, req RegisterRequest) (*User,
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
+	// Регистрация не отменяется из-за неотправленного письма: его можно запросить повторно
+	if err := s.sendVerification(ctx, user); err != nil {
+		log.Printf("Error sending verification email to user %s: %v", user.ID, err)
+	}
+
 	return user, nil
 }
 
-// Login выполняет вход пользователя
+// Login выполняет вход пользователя.
+// Неудачные попытки с email и IP клиента замедляют, а затем временно блокируют вход.
 func (s *AuthService) Login(ctx context.Context, req LoginRequest) (*TokenResponse, error) {
+	targets := s.loginTargets(req.Email, req.Client)
+	attempts, err := s.reserveLoginAttempt(ctx, targets, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
 	// Ищем пользователя по email
 	user, err := s.repo.GetUserByEmail(ctx, req.Email)
+	if errors.Is(err, ErrUserNotFound) {
+		if err := s.recordLoginFailure(ctx, attempts, nil, req.Client); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
 	if err != nil {
-		return nil, errors.New("invalid email or password")
+		s.releaseLoginAttempt(ctx, attempts)
+		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
 	// Проверяем пароль
 	if err := s.passwordService.CheckPassword(user.PasswordHash, req.Password); err != nil {
-		return nil, errors.New("invalid email or password")
+		if err := s.recordLoginFailure(ctx, attempts, user, req.Client); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	// С двухфакторной аутентификацией счётчик email сбрасывается только после проверки кода в CompleteLogin
+	if user.TwoFactorEnabled() {
+		s.releaseLoginAttempt(ctx, attempts)
+	} else if err := s.clearLoginAttempt(ctx, attempts); err != nil {
+		return nil, err
+	}
+
+	if s.account.EmailVerificationRequired == config.EmailVerificationLogin && !user.EmailVerified() {
+		return nil, ErrEmailNotVerified
+	}
+
+	// С двухфакторной аутентификацией токены выдаются только после проверки кода
+	if user.TwoFactorEnabled() {
+		return s.startLoginChallenge(ctx, user)
+	}
+
+	// Вход открывает новую сессию
+	session := &Session{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		UserAgent: req.Client.UserAgent,
+		IPAddress: req.Client.IPAddress,
+	}
+	return s.issueTokens(ctx, user, session)
+}
+
+// RefreshToken обменивает refresh токен на новую пару токенов той же сессии.
+// Каждый refresh токен обменивается один раз; повторное предъявление уже обменянного
+// токена означает его утечку, поэтому сессия отзывается вместе со всеми её токенами.
+func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string, client ClientInfo) (*TokenResponse, error) {
+	claims, err := s.jwtService.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken.Wrap(err)
+	}
+
+	tokenID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return nil, ErrInvalidRefreshToken.Wrap(err)
+	}
+
+	used, err := s.repo.UseRefreshToken(ctx, tokenID)
+	if errors.Is(err, ErrRefreshTokenNotFound) {
+		return nil, s.rejectRefreshToken(ctx, tokenID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to use refresh token: %w", err)
+	}
+
+	session, err := s.repo.GetSession(ctx, used.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
 	}
+	session.UserAgent = client.UserAgent
+	session.IPAddress = client.IPAddress
+
+	// Токен удалённого пользователя недействителен
+	user, err := s.repo.GetUserByID(ctx, used.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidRefreshToken.Wrap(err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return s.issueTokens(ctx, user, session)
+}
+
+// rejectRefreshToken определяет причину отказа в обмене refresh токена.
+// Если токен уже был обменян, отзывает его сессию.
+func (s *AuthService) rejectRefreshToken(ctx context.Context, tokenID uuid.UUID) error {
+	token, err := s.repo.GetRefreshToken(ctx, tokenID)
+	if errors.Is(err, ErrRefreshTokenNotFound) {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	if token.UsedAt == nil {
+		return ErrInvalidRefreshToken
+	}
+
+	log.Printf("Refresh token %s of user %s reused, revoking session %s", token.ID, token.UserID, token.SessionID)
+	err = s.repo.RevokeSession(ctx, token.SessionID, token.UserID)
+	if err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	return ErrRefreshTokenReused
+}
 
+// issueTokens выдаёт JWT и refresh токен сессии и продлевает её до срока действия refresh токена
+func (s *AuthService) issueTokens(ctx context.Context, user *User, session *Session) (*TokenResponse, error) {
 	// Генерируем JWT токен
-	token, expiresAt, err := s.jwtService.GenerateToken(user.ID)
+	token, expiresAt, err := s.jwtService.GenerateToken(user.ID, session.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate token: %w", err)
 	}
 
-	// Генерируем Refresh токен
-	refreshToken, err := s.jwtService.GenerateRefreshToken(user.ID)
+	// Генерируем Refresh токен и сохраняем его, чтобы обменять только один раз
+	refresh := &RefreshToken{
+		ID:        uuid.New(),
+		SessionID: session.ID,
+		UserID:    user.ID,
+	}
+	refreshToken, refreshExpiresAt, err := s.jwtService.GenerateRefreshToken(user.ID, refresh.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
 	}
+	refresh.ExpiresAt = refreshExpiresAt
+
+	session.ExpiresAt = refreshExpiresAt
+	if err := s.repo.SaveSession(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to save session: %w", err)
+	}
+	if err := s.repo.CreateRefreshToken(ctx, refresh); err != nil {
+		return nil, fmt.Errorf("failed to save refresh token: %w", err)
+	}
 
 	// Формируем ответ
 	response := &TokenResponse{
@@ -98,27 +297,574 @@ func (s *AuthService) Login(ctx context.Context, req LoginRequest) (*TokenRespon
 	return response, nil
 }
 
-// ValidateToken проверяет JWT токен
+// ValidateToken проверяет JWT токен и действие его сессии
 func (s *AuthService) ValidateToken(ctx context.Context, token string) (*ValidationResponse, error) {
+	session, err := s.authenticate(ctx, token)
+	if err != nil {
+		return &ValidationResponse{Valid: false}, err
+	}
+
+	// Получаем пользователя из БД. Токен удалённого пользователя недействителен.
+	user, err := s.repo.GetUserByID(ctx, session.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return &ValidationResponse{Valid: false}, ErrInvalidToken.Wrap(err)
+	}
+	if err != nil {
+		return &ValidationResponse{Valid: false}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	// Время активности обновляется не чаще sessionTouchInterval, чтобы не писать в БД на каждый запрос
+	if time.Since(session.LastSeenAt) > sessionTouchInterval {
+		if err := s.repo.TouchSession(ctx, session.ID); err != nil {
+			log.Printf("Error updating activity of session %s: %v", session.ID, err)
+		}
+	}
+
+	return &ValidationResponse{
+		Valid:     true,
+		User:      *user,
+		SessionID: session.ID,
+	}, nil
+}
+
+// Logout завершает сессию токена
+func (s *AuthService) Logout(ctx context.Context, token string) error {
+	session, err := s.authenticate(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.RevokeSession(ctx, session.ID, session.UserID)
+}
+
+// LogoutAll завершает все сессии владельца токена, включая текущую
+func (s *AuthService) LogoutAll(ctx context.Context, token string) error {
+	session, err := s.authenticate(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	return s.repo.RevokeUserSessions(ctx, session.UserID)
+}
+
+// ListSessions возвращает действующие сессии владельца токена и ID текущей сессии
+func (s *AuthService) ListSessions(ctx context.Context, token string) ([]*Session, uuid.UUID, error) {
+	session, err := s.authenticate(ctx, token)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	sessions, err := s.repo.ListSessions(ctx, session.UserID)
+	if err != nil {
+		return nil, uuid.Nil, err
+	}
+
+	return sessions, session.ID, nil
+}
+
+// RevokeSession завершает сессию sessionID владельца токена
+func (s *AuthService) RevokeSession(ctx context.Context, token, sessionID string) error {
+	session, err := s.authenticate(ctx, token)
+	if err != nil {
+		return err
+	}
+
+	id, err := uuid.Parse(sessionID)
+	if err != nil {
+		return ErrInvalidSessionID
+	}
+
+	return s.repo.RevokeSession(ctx, id, session.UserID)
+}
+
+// authenticate проверяет JWT токен и возвращает его действующую сессию
+func (s *AuthService) authenticate(ctx context.Context, token string) (*Session, error) {
 	claims, err := s.jwtService.ValidateToken(token)
 	if err != nil {
-		return &ValidationResponse{Valid: false}, fmt.Errorf("invalid token: %w", err)
+		return nil, ErrInvalidToken.Wrap(err)
 	}
 
-	// Преобразуем строковый ID в UUID
 	userID, err := uuid.Parse(claims.UserID)
 	if err != nil {
-		return &ValidationResponse{Valid: false}, fmt.Errorf("invalid user ID: %w", err)
+		return nil, ErrInvalidToken.Wrap(err)
+	}
+
+	// Токены без сессии выданы до появления сессий и не могут быть отозваны
+	sessionID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return nil, ErrInvalidToken.Wrap(err)
+	}
+
+	session, err := s.repo.GetSession(ctx, sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, ErrInvalidToken.Wrap(err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+
+	if session.UserID != userID {
+		return nil, ErrInvalidToken
+	}
+	if !session.Active() {
+		return nil, ErrSessionRevoked
+	}
+
+	return session, nil
+}
+
+// validateRegisterRequest проверяет поля запроса на регистрацию
+func validateRegisterRequest(req RegisterRequest) error {
+	switch {
+	case strings.TrimSpace(req.Username) == "":
+		return ErrUsernameRequired
+	case strings.TrimSpace(req.Email) == "":
+		return ErrEmailRequired
+	case len(req.Password) < minPasswordLength:
+		return ErrPasswordTooShort
+	}
+	return nil
+}
+
+// JWKS возвращает открытые ключи подписи access токенов
+func (s *AuthService) JWKS(ctx context.Context) pkgauth.JWKS {
+	return s.jwtService.JWKS()
+}
+
+// ListRevokedSessions возвращает сессии, отозванные после revokedAfter, токены которых ещё могут быть действительны.
+// По ним шлюз отклоняет токены, проверяемые без обращения к auth-сервису.
+func (s *AuthService) ListRevokedSessions(ctx context.Context, revokedAfter time.Time) ([]*Session, error) {
+	return s.repo.ListRevokedSessions(ctx, revokedAfter)
+}
+
+// RequestPasswordReset отправляет на email ссылку для сброса пароля.
+// Для незарегистрированного email ничего не делает, чтобы ответ не раскрывал, есть ли такой пользователь.
+func (s *AuthService) RequestPasswordReset(ctx context.Context, email string) error {
+	if strings.TrimSpace(email) == "" {
+		return ErrEmailRequired
+	}
+
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	token, hash, err := pkgauth.GenerateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	reset := &PasswordResetToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.account.PasswordResetTTL),
+	}
+	if err := s.repo.CreatePasswordResetToken(ctx, reset); err != nil {
+		return err
+	}
+
+	link := s.account.AppURL + "/reset-password?token=" + url.QueryEscape(token)
+	return s.sendMail(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your PenFeel password",
+		Body: fmt.Sprintf(
+			"Hello, %s!\n\nTo choose a new password, open this link:\n\n%s\n\n"+
+				"The link is valid for %d minutes and can be used once. After the reset you will be signed out on all devices and your personal access tokens will be revoked.\n"+
+				"If you did not request a password reset, ignore this email.\n",
+			user.Username, link, int(s.account.PasswordResetTTL.Minutes()),
+		),
+	})
+}
+
+// ResetPassword устанавливает новый пароль по токену из письма, завершает все сессии пользователя и отзывает его персональные токены доступа
+func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if token == "" {
+		return ErrInvalidResetToken
+	}
+	if len(newPassword) < minPasswordLength {
+		return ErrPasswordTooShort
+	}
+
+	passwordHash, err := s.passwordService.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	// Получаем пользователя из БД
+	userID, err := s.repo.ResetPassword(ctx, pkgauth.HashOpaqueToken(token), passwordHash)
+	if err != nil {
+		return err
+	}
+
+	// Владелец подтвердил доступ к почте, поэтому блокировка входа снимается.
+	// Пароль уже изменён, так что ошибка здесь только записывается в лог.
+	if err := s.unlockAfterPasswordReset(ctx, userID); err != nil {
+		log.Printf("Error unlocking login of user %s after password reset: %v", userID, err)
+	}
+
+	log.Printf("Password of user %s has been reset, all sessions and personal access tokens revoked", userID)
+	return nil
+}
+
+// unlockAfterPasswordReset снимает блокировку входа с email пользователя
+func (s *AuthService) unlockAfterPasswordReset(ctx context.Context, userID uuid.UUID) error {
 	user, err := s.repo.GetUserByID(ctx, userID)
 	if err != nil {
-		return &ValidationResponse{Valid: false}, fmt.Errorf("user not found: %w", err)
+		return fmt.Errorf("failed to get user: %w", err)
 	}
+	return s.repo.UnlockLogin(ctx, ThrottleScopeAccount, loginKey(user.Email), UnlockedByPasswordReset)
+}
 
-	return &ValidationResponse{
-		Valid: true,
-		User:  *user,
+// VerifyEmail подтверждает email по токену из письма
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) (*User, error) {
+	if token == "" {
+		return nil, ErrInvalidVerificationToken
+	}
+	return s.repo.VerifyEmail(ctx, pkgauth.HashOpaqueToken(token))
+}
+
+// ResendVerification повторно отправляет письмо подтверждения, например если ссылка истекла.
+// Для незарегистрированного или уже подтверждённого email ничего не делает.
+func (s *AuthService) ResendVerification(ctx context.Context, email string) error {
+	if strings.TrimSpace(email) == "" {
+		return ErrEmailRequired
+	}
+
+	user, err := s.repo.GetUserByEmail(ctx, email)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.EmailVerified() {
+		return nil
+	}
+
+	return s.sendVerification(ctx, user)
+}
+
+// sendVerification отправляет пользователю ссылку подтверждения email.
+// Прежние ссылки перестают действовать.
+func (s *AuthService) sendVerification(ctx context.Context, user *User) error {
+	link, err := s.verificationLink(ctx, user, user.Email)
+	if err != nil {
+		return err
+	}
+
+	return s.sendMail(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your PenFeel email address",
+		Body: fmt.Sprintf(
+			"Hello, %s!\n\nPlease confirm your email address by opening this link:\n\n%s\n\n"+
+				"The link is valid for %d hours.\n"+
+				"If you did not create a PenFeel account, ignore this email.\n",
+			user.Username, link, int(s.account.EmailVerificationTTL.Hours()),
+		),
+	})
+}
+
+// verificationLink создаёт токен подтверждения адреса email пользователя и возвращает ссылку с ним.
+// Прежние ссылки пользователя перестают действовать.
+func (s *AuthService) verificationLink(ctx context.Context, user *User, email string) (string, error) {
+	token, hash, err := pkgauth.GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	verification := &EmailVerificationToken{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		Email:     email,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.account.EmailVerificationTTL),
+	}
+	if err := s.repo.CreateEmailVerificationToken(ctx, verification); err != nil {
+		return "", err
+	}
+
+	return s.account.AppURL + "/verify-email?token=" + url.QueryEscape(token), nil
+}
+
+// sendMail отправляет письмо с дедлайном mailTimeout
+func (s *AuthService) sendMail(ctx context.Context, msg mailer.Message) error {
+	if s.mailTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.mailTimeout)
+		defer cancel()
+	}
+
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+// startLoginChallenge начинает второй шаг входа пользователя с двухфакторной аутентификацией
+func (s *AuthService) startLoginChallenge(ctx context.Context, user *User) (*TokenResponse, error) {
+	token, hash, err := pkgauth.GenerateOpaqueToken()
+	if err != nil {
+		return nil, err
+	}
+
+	challenge := &LoginChallenge{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(s.account.LoginChallengeTTL),
+	}
+	if err := s.repo.CreateLoginChallenge(ctx, challenge); err != nil {
+		return nil, err
+	}
+
+	return &TokenResponse{
+		User: *user,
+		Challenge: &ChallengeResponse{
+			Token:     token,
+			ExpiresAt: challenge.ExpiresAt,
+		},
+	}, nil
+}
+
+// CompleteLogin завершает вход кодом TOTP или кодом восстановления.
+// После maxChallengeAttempts попыток ввести код вход нужно начинать заново с пароля.
+// Неверные коды замедляют и блокируют вход так же, как неверные пароли.
+func (s *AuthService) CompleteLogin(ctx context.Context, challengeToken, code string, client ClientInfo) (*TokenResponse, error) {
+	if challengeToken == "" {
+		return nil, ErrInvalidLoginChallenge
+	}
+	if strings.TrimSpace(code) == "" {
+		return nil, ErrCodeRequired
+	}
+
+	challenge, err := s.repo.GetLoginChallenge(ctx, pkgauth.HashOpaqueToken(challengeToken))
+	if err != nil {
+		return nil, err
+	}
+	if challenge.CompletedAt != nil || !time.Now().Before(challenge.ExpiresAt) {
+		return nil, ErrInvalidLoginChallenge
+	}
+
+	user, err := s.repo.GetUserByID(ctx, challenge.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, ErrInvalidLoginChallenge.Wrap(err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	// Двухфакторную аутентификацию могли выключить, пока ожидался код
+	if !user.TwoFactorEnabled() {
+		return nil, ErrInvalidLoginChallenge
+	}
+
+	// Неверные коды учитываются в тех же счётчиках, что и неверные пароли
+	attempts, err := s.reserveLoginAttempt(ctx, s.loginTargets(user.Email, client), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.completeLoginChallenge(ctx, challenge, user, code); err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			if recordErr := s.recordLoginFailure(ctx, attempts, user, client); recordErr != nil {
+				return nil, recordErr
+			}
+		} else {
+			s.releaseLoginAttempt(ctx, attempts)
+		}
+		return nil, err
+	}
+	if err := s.clearLoginAttempt(ctx, attempts); err != nil {
+		return nil, err
+	}
+
+	session := &Session{
+		ID:        uuid.New(),
+		UserID:    user.ID,
+		UserAgent: client.UserAgent,
+		IPAddress: client.IPAddress,
+	}
+	return s.issueTokens(ctx, user, session)
+}
+
+// completeLoginChallenge проверяет код второго шага входа и отмечает вход завершённым
+func (s *AuthService) completeLoginChallenge(ctx context.Context, challenge *LoginChallenge, user *User, code string) error {
+	// Попытка учитывается до проверки кода, чтобы параллельные запросы не обходили ограничение
+	if err := s.repo.ClaimLoginChallengeAttempt(ctx, challenge.ID, maxChallengeAttempts); err != nil {
+		return err
+	}
+	if err := s.checkTwoFactorCode(ctx, user, code); err != nil {
+		return err
+	}
+	return s.repo.CompleteLoginChallenge(ctx, challenge.ID)
+}
+
+// SetupTOTP создаёт новый секрет TOTP для владельца токена.
+// Двухфакторная аутентификация включается только после подтверждения кодом в ConfirmTOTP.
+func (s *AuthService) SetupTOTP(ctx context.Context, token string) (*TOTPSetup, error) {
+	session, err := s.authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.repo.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := pkgauth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.StartTOTPSetup(ctx, user.ID, secret); err != nil {
+		return nil, err
+	}
+
+	return &TOTPSetup{
+		Secret: secret,
+		URI:    pkgauth.TOTPURI(s.account.TOTPIssuer, user.Email, secret),
 	}, nil
 }
+
+// ConfirmTOTP включает двухфакторную аутентификацию, если код соответствует секрету из SetupTOTP.
+// Возвращает одноразовые коды восстановления; они показываются только один раз.
+func (s *AuthService) ConfirmTOTP(ctx context.Context, token, code string) ([]string, error) {
+	session, err := s.authenticate(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(code) == "" {
+		return nil, ErrCodeRequired
+	}
+
+	user, err := s.repo.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user.TwoFactorEnabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TOTPSecret == nil {
+		return nil, ErrTwoFactorNotSetUp
+	}
+
+	counter, ok := pkgauth.ValidateTOTP(*user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		recoveryCode, err := pkgauth.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, recoveryCode)
+		hashes = append(hashes, pkgauth.HashOpaqueToken(pkgauth.NormalizeRecoveryCode(recoveryCode)))
+	}
+
+	// Подтверждающий код запоминается, чтобы его нельзя было повторно использовать для входа
+	if err := s.repo.EnableTOTP(ctx, user.ID, counter, hashes); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Two-factor authentication enabled for user %s", user.ID)
+	return codes, nil
+}
+
+// DisableTOTP выключает двухфакторную аутентификацию владельца токена.
+// Требуются пароль и действующий код TOTP или код восстановления.
+func (s *AuthService) DisableTOTP(ctx context.Context, token, password, code string, client ClientInfo) error {
+	session, err := s.authenticate(ctx, token)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(code) == "" {
+		return ErrCodeRequired
+	}
+
+	user, err := s.repo.GetUserByID(ctx, session.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if !user.TwoFactorEnabled() {
+		return ErrTwoFactorNotEnabled
+	}
+
+	// Неверные пароль и код учитываются в тех же счётчиках, что и при входе
+	attempts, err := s.reserveLoginAttempt(ctx, s.loginTargets(user.Email, client), time.Now())
+	if err != nil {
+		return err
+	}
+	if err := s.checkDisableTOTP(ctx, user, password, code); err != nil {
+		if errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrInvalidTwoFactorCode) {
+			if recordErr := s.recordLoginFailure(ctx, attempts, user, client); recordErr != nil {
+				return recordErr
+			}
+		} else {
+			s.releaseLoginAttempt(ctx, attempts)
+		}
+		return err
+	}
+	if err := s.clearLoginAttempt(ctx, attempts); err != nil {
+		return err
+	}
+
+	if err := s.repo.DisableTOTP(ctx, user.ID); err != nil {
+		return err
+	}
+
+	log.Printf("Two-factor authentication disabled for user %s", user.ID)
+	return nil
+}
+
+// checkDisableTOTP проверяет пароль и код перед выключением двухфакторной аутентификации
+func (s *AuthService) checkDisableTOTP(ctx context.Context, user *User, password, code string) error {
+	if err := s.passwordService.CheckPassword(user.PasswordHash, password); err != nil {
+		return ErrInvalidCredentials
+	}
+	return s.checkTwoFactorCode(ctx, user, code)
+}
+
+// checkTwoFactorCode проверяет и погашает код пользователя: шестизначный код считается кодом TOTP,
+// остальные — кодами восстановления. Каждый код принимается только один раз.
+func (s *AuthService) checkTwoFactorCode(ctx context.Context, user *User, code string) error {
+	code = strings.TrimSpace(code)
+
+	if isTOTPCode(code) {
+		counter, ok := pkgauth.ValidateTOTP(*user.TOTPSecret, code, time.Now())
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		return s.repo.UseTOTPCounter(ctx, user.ID, counter)
+	}
+
+	normalized := pkgauth.NormalizeRecoveryCode(code)
+	if normalized == "" {
+		return ErrInvalidTwoFactorCode
+	}
+	if err := s.repo.UseRecoveryCode(ctx, user.ID, pkgauth.HashOpaqueToken(normalized)); err != nil {
+		return err
+	}
+
+	log.Printf("Recovery code used by user %s", user.ID)
+	return nil
+}
+
+// isTOTPCode сообщает, похож ли код на код TOTP из приложения-аутентификатора
+func isTOTPCode(code string) bool {
+	if len(code) != 6 {
+		return false
+	}
+	for _, r := range code {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
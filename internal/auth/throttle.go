@@ -0,0 +1,261 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	pkgauth "github.com/malaxitlmax/penfeel/pkg/auth"
+	"github.com/malaxitlmax/penfeel/pkg/mailer"
+)
+
+// maxLoginReserveRetries сколько раз попытка входа учитывается заново, если счётчик меняют параллельные входы
+const maxLoginReserveRetries = 5
+
+// loginTarget счётчик неудачных попыток, который проверяется при входе
+type loginTarget struct {
+	scope       string
+	key         string
+	maxAttempts int
+}
+
+// loginKey ключ счётчика попыток входа с email. Считается и для незарегистрированных email,
+// чтобы задержки и блокировки не раскрывали, есть ли такой пользователь.
+func loginKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// loginTargets возвращает счётчики попыток входа с email от клиента
+func (s *AuthService) loginTargets(email string, client ClientInfo) []loginTarget {
+	targets := []loginTarget{{
+		scope:       ThrottleScopeAccount,
+		key:         loginKey(email),
+		maxAttempts: s.protection.AccountMaxAttempts,
+	}}
+	if client.IPAddress != "" {
+		targets = append(targets, loginTarget{
+			scope:       ThrottleScopeIP,
+			key:         client.IPAddress,
+			maxAttempts: s.protection.IPMaxAttempts,
+		})
+	}
+	return targets
+}
+
+// loginAttempt попытка входа, учтённая в счётчике target до проверки пароля или кода
+type loginAttempt struct {
+	target   loginTarget
+	throttle *LoginThrottle
+}
+
+// reserveLoginAttempt возвращает ErrTooManyLoginAttempts или ErrAccountLocked, если вход
+// с этого email или IP сейчас запрещён. Иначе учитывает попытку во всех счётчиках, пока пароль
+// или код не проверены, чтобы параллельные запросы не обходили задержки и блокировку.
+// Удачную попытку нужно отменить через releaseLoginAttempt или clearLoginAttempt.
+func (s *AuthService) reserveLoginAttempt(ctx context.Context, targets []loginTarget, now time.Time) ([]loginAttempt, error) {
+	attempts := make([]loginAttempt, 0, len(targets))
+	for _, target := range targets {
+		throttle, err := s.reserveLoginTarget(ctx, target, now)
+		if err != nil {
+			s.releaseLoginAttempt(ctx, attempts)
+			return nil, err
+		}
+		attempts = append(attempts, loginAttempt{target: target, throttle: throttle})
+	}
+	return attempts, nil
+}
+
+// reserveLoginTarget учитывает попытку входа в счётчике target, если вход по нему сейчас разрешён.
+// Пока вход запрещён, попытки не учитываются, чтобы они не продлевали задержку и блокировку.
+func (s *AuthService) reserveLoginTarget(ctx context.Context, target loginTarget, now time.Time) (*LoginThrottle, error) {
+	for i := 0; i < maxLoginReserveRetries; i++ {
+		throttle, err := s.repo.GetLoginThrottle(ctx, target.scope, target.key)
+		if err != nil {
+			return nil, err
+		}
+
+		wait, locked := s.loginDelay(throttle, target.maxAttempts, now)
+		if locked {
+			return nil, ErrAccountLocked.WithRetryAfter(wait)
+		}
+		if wait > 0 {
+			return nil, ErrTooManyLoginAttempts.WithRetryAfter(wait)
+		}
+
+		// Счётчик мог измениться параллельной попыткой после чтения, тогда задержка проверяется заново
+		reserved, err := s.repo.ReserveLoginAttempt(ctx, throttle, now, now.Add(-s.protection.AttemptWindow))
+		if errors.Is(err, ErrLoginThrottleChanged) {
+			continue
+		}
+		return reserved, err
+	}
+	return nil, ErrTooManyLoginAttempts.WithRetryAfter(s.protection.BackoffBase)
+}
+
+// loginDelay возвращает, сколько ещё ждать следующей попытки входа и заблокирован ли вход.
+// Первые FreeAttempts неудач не задерживают вход, каждая следующая удваивает задержку.
+func (s *AuthService) loginDelay(throttle *LoginThrottle, maxAttempts int, now time.Time) (time.Duration, bool) {
+	if throttle.FailedAttempts == 0 {
+		return 0, false
+	}
+
+	if throttle.FailedAttempts >= maxAttempts {
+		wait := throttle.LastFailedAt.Add(s.protection.LockoutDuration).Sub(now)
+		return wait, wait > 0
+	}
+
+	if throttle.FailedAttempts <= s.protection.FreeAttempts || now.Sub(throttle.LastFailedAt) > s.protection.AttemptWindow {
+		return 0, false
+	}
+
+	delay := s.protection.BackoffBase
+	for i := s.protection.FreeAttempts + 1; i < throttle.FailedAttempts && delay < s.protection.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > s.protection.BackoffMax {
+		delay = s.protection.BackoffMax
+	}
+
+	return throttle.LastFailedAt.Add(delay).Sub(now), false
+}
+
+// recordLoginFailure оставляет учтённую попытку неудачной и блокирует вход, если попыток стало слишком много.
+// user — владелец email, nil если email не зарегистрирован.
+func (s *AuthService) recordLoginFailure(ctx context.Context, attempts []loginAttempt, user *User, client ClientInfo) error {
+	for _, attempt := range attempts {
+		// Пока вход заблокирован, попытки не учитываются, поэтому каждая неудача сверх предела — новая блокировка
+		if attempt.throttle.FailedAttempts >= attempt.target.maxAttempts {
+			if err := s.lockLogin(ctx, attempt.throttle, user, client); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// releaseLoginAttempt отменяет учтённую попытку во всех счётчиках, если она не была неудачной.
+// Неотменённая попытка только приближает задержку, поэтому ошибка записывается в лог.
+func (s *AuthService) releaseLoginAttempt(ctx context.Context, attempts []loginAttempt) {
+	for _, attempt := range attempts {
+		if err := s.repo.ReleaseLoginAttempt(ctx, attempt.target.scope, attempt.target.key); err != nil {
+			log.Printf("Error releasing login attempt for %s %q: %v", attempt.target.scope, attempt.target.key, err)
+		}
+	}
+}
+
+// clearLoginAttempt завершает удачный вход: сбрасывает счётчик email и отменяет попытку в счётчике IP.
+// Счётчик IP не сбрасывается: иначе подбирающий мог бы обнулять его входом в свою учётную запись.
+func (s *AuthService) clearLoginAttempt(ctx context.Context, attempts []loginAttempt) error {
+	for _, attempt := range attempts {
+		if attempt.target.scope != ThrottleScopeAccount {
+			s.releaseLoginAttempt(ctx, []loginAttempt{attempt})
+			continue
+		}
+		if err := s.repo.ClearLoginThrottle(ctx, attempt.target.scope, attempt.target.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockLogin записывает блокировку входа в журнал. Владельцу заблокированной учётной записи
+// отправляется письмо со ссылкой, по которой он может снять блокировку.
+func (s *AuthService) lockLogin(ctx context.Context, throttle *LoginThrottle, user *User, client ClientInfo) error {
+	lockout := &LoginLockout{
+		ID:             uuid.New(),
+		Scope:          throttle.Scope,
+		Key:            throttle.Key,
+		IPAddress:      client.IPAddress,
+		FailedAttempts: throttle.FailedAttempts,
+		LockedUntil:    throttle.LastFailedAt.Add(s.protection.LockoutDuration),
+	}
+
+	var token string
+	if throttle.Scope == ThrottleScopeAccount && user != nil {
+		var hash string
+		var err error
+		token, hash, err = pkgauth.GenerateOpaqueToken()
+		if err != nil {
+			return err
+		}
+
+		expiresAt := throttle.LastFailedAt.Add(s.protection.UnlockTTL)
+		lockout.UserID = &user.ID
+		lockout.UnlockTokenHash = &hash
+		lockout.UnlockExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.CreateLoginLockout(ctx, lockout); err != nil {
+		return err
+	}
+
+	log.Printf("Login locked for %s %q until %s after %d failed attempts, last from %q",
+		lockout.Scope, lockout.Key, lockout.LockedUntil.Format(time.RFC3339), lockout.FailedAttempts, lockout.IPAddress)
+
+	if token == "" {
+		return nil
+	}
+
+	// Блокировка действует и без письма, поэтому ошибка отправки только записывается в лог
+	link := s.account.AppURL + "/unlock-account?token=" + url.QueryEscape(token)
+	err := s.sendMail(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Sign-in to your PenFeel account has been locked",
+		Body: fmt.Sprintf(
+			"Hello, %s!\n\nSign-in to your account has been locked after %d failed attempts. "+
+				"It will be unlocked automatically in %d minutes.\n\n"+
+				"If it was you, you can unlock your account now by opening this link:\n\n%s\n\n"+
+				"The link is valid for %d hours.\n"+
+				"If it was not you, someone may be trying to guess your password. Consider changing it.\n",
+			user.Username, lockout.FailedAttempts, int(s.protection.LockoutDuration.Minutes()),
+			link, int(s.protection.UnlockTTL.Hours()),
+		),
+	})
+	if err != nil {
+		log.Printf("Error sending lockout email to user %s: %v", user.ID, err)
+	}
+	return nil
+}
+
+// UnlockAccount снимает блокировку входа по токену из письма о блокировке
+func (s *AuthService) UnlockAccount(ctx context.Context, token string) error {
+	if token == "" {
+		return ErrInvalidUnlockToken
+	}
+
+	lockout, err := s.repo.UnlockWithToken(ctx, pkgauth.HashOpaqueToken(token))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Login unlocked for %s %q by the account owner", lockout.Scope, lockout.Key)
+	return nil
+}
+
+// AdminUnlockLogin снимает блокировку входа и сбрасывает неудачные попытки для email и (или) IP
+func (s *AuthService) AdminUnlockLogin(ctx context.Context, email, ipAddress string) error {
+	key := loginKey(email)
+	ipAddress = strings.TrimSpace(ipAddress)
+	if key == "" && ipAddress == "" {
+		return ErrUnlockTargetRequired
+	}
+
+	if key != "" {
+		if err := s.repo.UnlockLogin(ctx, ThrottleScopeAccount, key, UnlockedByAdmin); err != nil {
+			return err
+		}
+		log.Printf("Login unlocked for %s %q by an administrator", ThrottleScopeAccount, key)
+	}
+	if ipAddress != "" {
+		if err := s.repo.UnlockLogin(ctx, ThrottleScopeIP, ipAddress, UnlockedByAdmin); err != nil {
+			return err
+		}
+		log.Printf("Login unlocked for %s %q by an administrator", ThrottleScopeIP, ipAddress)
+	}
+	return nil
+}
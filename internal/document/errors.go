@@ -0,0 +1,22 @@
+package document
+
+import "github.com/malaxitlmax/penfeel/pkg/apperrors"
+
+var (
+	// ErrDocumentNotFound документ не существует или недоступен пользователю
+	ErrDocumentNotFound = apperrors.NotFound("DOCUMENT_NOT_FOUND", "document not found")
+	// ErrLockHeld действует конфликтующая блокировка другого пользователя
+	ErrLockHeld = apperrors.Conflict("LOCK_HELD", "document is already locked by another user")
+	// ErrLockNotFound блокировка не найдена или принадлежит другому пользователю
+	ErrLockNotFound = apperrors.NotFound("LOCK_NOT_FOUND", "lock not found")
+	// ErrDocumentLocked документ заблокирован другим пользователем и не может быть изменён
+	ErrDocumentLocked = apperrors.Conflict("DOCUMENT_LOCKED", "document is locked by another user")
+	// ErrNotDocumentOwner действие доступно только владельцу документа
+	ErrNotDocumentOwner = apperrors.PermissionDenied("NOT_DOCUMENT_OWNER", "only the document owner can do this")
+	// ErrInvalidDocumentID идентификатор документа не является UUID
+	ErrInvalidDocumentID = apperrors.InvalidArgument("id", "invalid document ID")
+	// ErrMissingIdentity вызов выполнен без проверенного удостоверения пользователя
+	ErrMissingIdentity = apperrors.Unauthenticated("MISSING_IDENTITY", "caller identity is missing")
+	// ErrEmptyTitle документ без заголовка
+	ErrEmptyTitle = apperrors.InvalidArgument("title", "title is required")
+)
@@ -2,9 +2,12 @@ package document
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 	pb "github.com/malaxitlmax/penfeel/api/proto"
+	"github.com/malaxitlmax/penfeel/pkg/apperrors"
+	"github.com/malaxitlmax/penfeel/pkg/grpcauth"
 )
 
 // GRPCServer реализация gRPC сервера для документов
@@ -22,12 +25,9 @@ func NewGRPCServer(service Service) *GRPCServer {
 
 // GetDocuments обрабатывает запрос на получение списка документов
 func (s *GRPCServer) GetDocuments(ctx context.Context, req *pb.GetDocumentsRequest) (*pb.GetDocumentsResponse, error) {
-	userID, err := uuid.Parse(req.UserId)
+	userID, err := currentUser(ctx)
 	if err != nil {
-		return &pb.GetDocumentsResponse{
-			Success: false,
-			Error:   "invalid user ID",
-		}, nil
+		return nil, err
 	}
 
 	// Преобразуем запрос в доменную модель
@@ -38,28 +38,17 @@ func (s *GRPCServer) GetDocuments(ctx context.Context, req *pb.GetDocumentsReque
 	// Вызываем сервис для получения документов
 	documents, err := s.service.GetDocuments(ctx, domainReq)
 	if err != nil {
-		return &pb.GetDocumentsResponse{
-			Success: false,
-			Error:   err.Error(),
-		}, nil
+		return nil, apperrors.ToStatus(err)
 	}
 
 	// Преобразуем документы в protobuf формат
 	var pbDocuments []*pb.Document
 	for _, doc := range documents {
-		pbDocuments = append(pbDocuments, &pb.Document{
-			Id:        doc.ID.String(),
-			Title:     doc.Title,
-			Content:   doc.Content,
-			UserId:    doc.UserID.String(),
-			CreatedAt: doc.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			UpdatedAt: doc.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		})
+		pbDocuments = append(pbDocuments, documentToProto(doc))
 	}
 
 	// Формируем ответ
 	return &pb.GetDocumentsResponse{
-		Success:   true,
 		Documents: pbDocuments,
 	}, nil
 }
@@ -68,18 +57,12 @@ func (s *GRPCServer) GetDocuments(ctx context.Context, req *pb.GetDocumentsReque
 func (s *GRPCServer) GetDocument(ctx context.Context, req *pb.GetDocumentRequest) (*pb.GetDocumentResponse, error) {
 	id, err := uuid.Parse(req.Id)
 	if err != nil {
-		return &pb.GetDocumentResponse{
-			Success: false,
-			Error:   "invalid document ID",
-		}, nil
+		return nil, apperrors.ToStatus(ErrInvalidDocumentID)
 	}
 
-	userID, err := uuid.Parse(req.UserId)
+	userID, err := currentUser(ctx)
 	if err != nil {
-		return &pb.GetDocumentResponse{
-			Success: false,
-			Error:   "invalid user ID",
-		}, nil
+		return nil, err
 	}
 
 	// Преобразуем запрос в доменную модель
@@ -91,34 +74,20 @@ func (s *GRPCServer) GetDocument(ctx context.Context, req *pb.GetDocumentRequest
 	// Вызываем сервис для получения документа
 	document, err := s.service.GetDocument(ctx, domainReq)
 	if err != nil {
-		return &pb.GetDocumentResponse{
-			Success: false,
-			Error:   err.Error(),
-		}, nil
+		return nil, apperrors.ToStatus(err)
 	}
 
 	// Формируем ответ
 	return &pb.GetDocumentResponse{
-		Success: true,
-		Document: &pb.Document{
-			Id:        document.ID.String(),
-			Title:     document.Title,
-			Content:   document.Content,
-			UserId:    document.UserID.String(),
-			CreatedAt: document.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			UpdatedAt: document.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		},
+		Document: documentToProto(document),
 	}, nil
 }
 
 // CreateDocument обрабатывает запрос на создание документа
 func (s *GRPCServer) CreateDocument(ctx context.Context, req *pb.CreateDocumentRequest) (*pb.CreateDocumentResponse, error) {
-	userID, err := uuid.Parse(req.UserId)
+	userID, err := currentUser(ctx)
 	if err != nil {
-		return &pb.CreateDocumentResponse{
-			Success: false,
-			Error:   "invalid user ID",
-		}, nil
+		return nil, err
 	}
 
 	// Преобразуем запрос в доменную модель
@@ -131,23 +100,12 @@ func (s *GRPCServer) CreateDocument(ctx context.Context, req *pb.CreateDocumentR
 	// Вызываем сервис для создания документа
 	document, err := s.service.CreateDocument(ctx, domainReq)
 	if err != nil {
-		return &pb.CreateDocumentResponse{
-			Success: false,
-			Error:   err.Error(),
-		}, nil
+		return nil, apperrors.ToStatus(err)
 	}
 
 	// Формируем ответ
 	return &pb.CreateDocumentResponse{
-		Success: true,
-		Document: &pb.Document{
-			Id:        document.ID.String(),
-			Title:     document.Title,
-			Content:   document.Content,
-			UserId:    document.UserID.String(),
-			CreatedAt: document.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			UpdatedAt: document.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		},
+		Document: documentToProto(document),
 	}, nil
 }
 
@@ -155,18 +113,12 @@ func (s *GRPCServer) CreateDocument(ctx context.Context, req *pb.CreateDocumentR
 func (s *GRPCServer) UpdateDocument(ctx context.Context, req *pb.UpdateDocumentRequest) (*pb.UpdateDocumentResponse, error) {
 	id, err := uuid.Parse(req.Id)
 	if err != nil {
-		return &pb.UpdateDocumentResponse{
-			Success: false,
-			Error:   "invalid document ID",
-		}, nil
+		return nil, apperrors.ToStatus(ErrInvalidDocumentID)
 	}
 
-	userID, err := uuid.Parse(req.UserId)
+	userID, err := currentUser(ctx)
 	if err != nil {
-		return &pb.UpdateDocumentResponse{
-			Success: false,
-			Error:   "invalid user ID",
-		}, nil
+		return nil, err
 	}
 
 	// Преобразуем запрос в доменную модель
@@ -180,23 +132,12 @@ func (s *GRPCServer) UpdateDocument(ctx context.Context, req *pb.UpdateDocumentR
 	// Вызываем сервис для обновления документа
 	document, err := s.service.UpdateDocument(ctx, domainReq)
 	if err != nil {
-		return &pb.UpdateDocumentResponse{
-			Success: false,
-			Error:   err.Error(),
-		}, nil
+		return nil, apperrors.ToStatus(err)
 	}
 
 	// Формируем ответ
 	return &pb.UpdateDocumentResponse{
-		Success: true,
-		Document: &pb.Document{
-			Id:        document.ID.String(),
-			Title:     document.Title,
-			Content:   document.Content,
-			UserId:    document.UserID.String(),
-			CreatedAt: document.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			UpdatedAt: document.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		},
+		Document: documentToProto(document),
 	}, nil
 }
 
@@ -204,18 +145,12 @@ func (s *GRPCServer) UpdateDocument(ctx context.Context, req *pb.UpdateDocumentR
 func (s *GRPCServer) DeleteDocument(ctx context.Context, req *pb.DeleteDocumentRequest) (*pb.DeleteDocumentResponse, error) {
 	id, err := uuid.Parse(req.Id)
 	if err != nil {
-		return &pb.DeleteDocumentResponse{
-			Success: false,
-			Error:   "invalid document ID",
-		}, nil
+		return nil, apperrors.ToStatus(ErrInvalidDocumentID)
 	}
 
-	userID, err := uuid.Parse(req.UserId)
+	userID, err := currentUser(ctx)
 	if err != nil {
-		return &pb.DeleteDocumentResponse{
-			Success: false,
-			Error:   "invalid user ID",
-		}, nil
+		return nil, err
 	}
 
 	// Преобразуем запрос в доменную модель
@@ -227,14 +162,127 @@ func (s *GRPCServer) DeleteDocument(ctx context.Context, req *pb.DeleteDocumentR
 	// Вызываем сервис для удаления документа
 	err = s.service.DeleteDocument(ctx, domainReq)
 	if err != nil {
-		return &pb.DeleteDocumentResponse{
-			Success: false,
-			Error:   err.Error(),
-		}, nil
+		return nil, apperrors.ToStatus(err)
 	}
 
 	// Формируем ответ
-	return &pb.DeleteDocumentResponse{
-		Success: true,
+	return &pb.DeleteDocumentResponse{}, nil
+}
+
+// LockDocument обрабатывает запрос на блокировку документа
+func (s *GRPCServer) LockDocument(ctx context.Context, req *pb.LockDocumentRequest) (*pb.LockDocumentResponse, error) {
+	id, err := uuid.Parse(req.Id)
+	if err != nil {
+		return nil, apperrors.ToStatus(ErrInvalidDocumentID)
+	}
+
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Преобразуем запрос в доменную модель
+	domainReq := LockDocumentRequest{
+		ID:     id,
+		UserID: userID,
+		TTL:    time.Duration(req.TtlSeconds) * time.Second,
+	}
+
+	// Вызываем сервис для блокировки документа
+	lock, err := s.service.LockDocument(ctx, domainReq)
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+
+	// Формируем ответ
+	return &pb.LockDocumentResponse{
+		Lock: lockToProto(lock),
+	}, nil
+}
+
+// UnlockDocument обрабатывает запрос на снятие блокировки
+func (s *GRPCServer) UnlockDocument(ctx context.Context, req *pb.UnlockDocumentRequest) (*pb.UnlockDocumentResponse, error) {
+	id, err := uuid.Parse(req.Id)
+	if err != nil {
+		return nil, apperrors.ToStatus(ErrInvalidDocumentID)
+	}
+
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Преобразуем запрос в доменную модель
+	domainReq := UnlockDocumentRequest{
+		ID:     id,
+		UserID: userID,
+		Force:  req.Force,
+	}
+
+	// Вызываем сервис для снятия блокировки
+	if err := s.service.UnlockDocument(ctx, domainReq); err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+
+	// Формируем ответ
+	return &pb.UnlockDocumentResponse{}, nil
+}
+
+// GetDocumentLocks обрабатывает запрос на получение блокировок документа
+func (s *GRPCServer) GetDocumentLocks(ctx context.Context, req *pb.GetDocumentLocksRequest) (*pb.GetDocumentLocksResponse, error) {
+	id, err := uuid.Parse(req.Id)
+	if err != nil {
+		return nil, apperrors.ToStatus(ErrInvalidDocumentID)
+	}
+
+	userID, err := currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Преобразуем запрос в доменную модель
+	domainReq := GetDocumentLocksRequest{
+		ID:     id,
+		UserID: userID,
+	}
+
+	// Вызываем сервис для получения блокировок
+	locks, err := s.service.GetDocumentLocks(ctx, domainReq)
+	if err != nil {
+		return nil, apperrors.ToStatus(err)
+	}
+
+	// Преобразуем блокировки в protobuf формат
+	pbLocks := make([]*pb.DocumentLock, 0, len(locks))
+	for _, lock := range locks {
+		pbLocks = append(pbLocks, lockToProto(lock))
+	}
+
+	// Формируем ответ
+	return &pb.GetDocumentLocksResponse{
+		Locks: pbLocks,
 	}, nil
 }
+
+// currentUser возвращает пользователя, удостоверение которого проверил перехватчик
+func currentUser(ctx context.Context) (uuid.UUID, error) {
+	userID, err := grpcauth.UserID(ctx)
+	if err != nil {
+		return uuid.Nil, apperrors.ToStatus(ErrMissingIdentity)
+	}
+	return userID, nil
+}
+
+// lockToProto преобразует блокировку в protobuf формат
+func lockToProto(lock *DocumentLock) *pb.DocumentLock {
+	result := &pb.DocumentLock{
+		DocumentId: lock.DocumentID.String(),
+	}
+	// У снятой блокировки известен только документ
+	if lock.OwnerID != uuid.Nil {
+		result.OwnerId = lock.OwnerID.String()
+		result.CreatedAt = lock.CreatedAt.Format("2006-01-02T15:04:05Z07:00")
+		result.ExpiresAt = lock.ExpiresAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return result
+}
@@ -0,0 +1,182 @@
+package document
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// subscriptionBuffer число событий, которые подписчик может не успеть прочитать
+const subscriptionBuffer = 64
+
+var (
+	// ErrSlowSubscriber подписчик не успевал читать события и был отключён
+	ErrSlowSubscriber = errors.New("subscriber is too slow")
+	// ErrHubClosed сервис останавливается
+	ErrHubClosed = errors.New("document service is shutting down")
+)
+
+// Event изменение документа, доставляемое подписчикам
+type Event struct {
+	// Версия документа. Нумерация последовательна, пока у документа есть подписчики.
+	Version int64
+	UserID  uuid.UUID
+	// Новое состояние документа, nil для удаления и изменения блокировки
+	Document *Document
+	Deleted  bool
+	// Установленная или снятая блокировка
+	Lock         *DocumentLock
+	LockReleased bool
+	LockForced   bool
+}
+
+// Subscription подписка на изменения документа
+type Subscription struct {
+	hub        *Hub
+	documentID uuid.UUID
+	events     chan Event
+	// Версия документа на момент подписки
+	version int64
+	// Причина закрытия канала событий, nil если документ удалён или подписка отменена
+	err error
+}
+
+// Events канал изменений документа. Закрывается при отмене подписки, удалении документа
+// или остановке сервиса; причину возвращает Err.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Version возвращает версию документа на момент подписки
+func (s *Subscription) Version() int64 {
+	return s.version
+}
+
+// Err возвращает причину закрытия подписки
+func (s *Subscription) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	return s.err
+}
+
+// Close отменяет подписку
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+
+	s.hub.remove(s, nil)
+}
+
+// hubDocument подписчики и текущая версия документа
+type hubDocument struct {
+	version     int64
+	subscribers map[*Subscription]struct{}
+}
+
+// Hub рассылает изменения документов подписчикам внутри процесса сервиса
+type Hub struct {
+	mu        sync.Mutex
+	closed    bool
+	documents map[uuid.UUID]*hubDocument
+}
+
+// NewHub создаёт хаб изменений документов
+func NewHub() *Hub {
+	return &Hub{
+		documents: make(map[uuid.UUID]*hubDocument),
+	}
+}
+
+// Subscribe подписывается на изменения документа
+func (h *Hub) Subscribe(documentID uuid.UUID) (*Subscription, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return nil, ErrHubClosed
+	}
+
+	doc := h.document(documentID)
+	sub := &Subscription{
+		hub:        h,
+		documentID: documentID,
+		events:     make(chan Event, subscriptionBuffer),
+		version:    doc.version,
+	}
+	doc.subscribers[sub] = struct{}{}
+	return sub, nil
+}
+
+// Publish присваивает изменению следующую версию документа и рассылает его подписчикам.
+// После удаления документа все его подписки закрываются.
+func (h *Hub) Publish(documentID uuid.UUID, event Event) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	doc, exists := h.documents[documentID]
+	if !exists {
+		// Без подписчиков версия не нужна: новые подписчики начинают с текущего состояния
+		return 0
+	}
+
+	doc.version++
+	event.Version = doc.version
+	for sub := range doc.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			h.remove(sub, ErrSlowSubscriber)
+		}
+	}
+
+	if event.Deleted {
+		for sub := range doc.subscribers {
+			h.remove(sub, nil)
+		}
+	}
+	return event.Version
+}
+
+// Close закрывает все подписки. Новые подписки после этого не принимаются.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for _, doc := range h.documents {
+		for sub := range doc.subscribers {
+			h.remove(sub, ErrHubClosed)
+		}
+	}
+}
+
+// document возвращает запись документа, создавая её при необходимости. Вызывается под мьютексом.
+func (h *Hub) document(documentID uuid.UUID) *hubDocument {
+	doc, exists := h.documents[documentID]
+	if !exists {
+		doc = &hubDocument{subscribers: make(map[*Subscription]struct{})}
+		h.documents[documentID] = doc
+	}
+	return doc
+}
+
+// remove удаляет подписку и закрывает её канал. Вызывается под мьютексом.
+func (h *Hub) remove(sub *Subscription, reason error) {
+	doc, exists := h.documents[sub.documentID]
+	if !exists {
+		return
+	}
+	if _, subscribed := doc.subscribers[sub]; !subscribed {
+		return
+	}
+
+	delete(doc.subscribers, sub)
+	sub.err = reason
+	close(sub.events)
+
+	if len(doc.subscribers) == 0 {
+		delete(h.documents, sub.documentID)
+	}
+}
@@ -47,3 +47,39 @@ type DeleteDocumentRequest struct {
 	ID     uuid.UUID `json:"id" binding:"required"`
 	UserID uuid.UUID `json:"user_id" binding:"required"`
 }
+
+// SubscribeDocumentRequest представляет запрос на подписку на изменения документа
+type SubscribeDocumentRequest struct {
+	ID     uuid.UUID `json:"id" binding:"required"`
+	UserID uuid.UUID `json:"user_id" binding:"required"`
+}
+
+// DocumentLock блокировка документа одним пользователем на время правки
+type DocumentLock struct {
+	DocumentID uuid.UUID `db:"document_id" json:"document_id"`
+	OwnerID    uuid.UUID `db:"owner_id" json:"owner_id"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	ExpiresAt  time.Time `db:"expires_at" json:"expires_at"`
+}
+
+// LockDocumentRequest представляет запрос на блокировку документа.
+// Повторный запрос владельца блокировки продлевает её.
+type LockDocumentRequest struct {
+	ID     uuid.UUID     `json:"id" binding:"required"`
+	UserID uuid.UUID     `json:"user_id" binding:"required"`
+	TTL    time.Duration `json:"ttl"`
+}
+
+// UnlockDocumentRequest представляет запрос на снятие блокировки.
+// Force позволяет владельцу документа снять чужую блокировку.
+type UnlockDocumentRequest struct {
+	ID     uuid.UUID `json:"id" binding:"required"`
+	UserID uuid.UUID `json:"user_id" binding:"required"`
+	Force  bool      `json:"force"`
+}
+
+// GetDocumentLocksRequest представляет запрос на получение действующих блокировок документа
+type GetDocumentLocksRequest struct {
+	ID     uuid.UUID `json:"id" binding:"required"`
+	UserID uuid.UUID `json:"user_id" binding:"required"`
+}
@@ -2,6 +2,8 @@ package document
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,6 +17,9 @@ type Repository interface {
 	CreateDocument(ctx context.Context, doc *Document) (*Document, error)
 	UpdateDocument(ctx context.Context, doc *Document) (*Document, error)
 	DeleteDocument(ctx context.Context, id, userID uuid.UUID) error
+	AcquireLock(ctx context.Context, lock *DocumentLock) (*DocumentLock, error)
+	ReleaseLock(ctx context.Context, documentID uuid.UUID, ownerID *uuid.UUID) error
+	GetLocks(ctx context.Context, documentID uuid.UUID) ([]*DocumentLock, error)
 }
 
 // PostgresRepository реализация репозитория для PostgreSQL
@@ -46,7 +51,7 @@ func (r *PostgresRepository) GetDocument(ctx context.Context, id, userID uuid.UU
 	query := `SELECT * FROM documents WHERE id = $1 AND user_id = $2`
 	err := r.db.GetContext(ctx, &document, query, id, userID)
 	if err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
 	return &document, nil
 }
@@ -67,8 +72,19 @@ func (r *PostgresRepository) CreateDocument(ctx context.Context, doc *Document)
 	return &document, nil
 }
 
-// UpdateDocument обновляет документ
+// UpdateDocument обновляет документ.
+// Возвращает ErrDocumentLocked, если документ заблокирован другим пользователем.
 func (r *PostgresRepository) UpdateDocument(ctx context.Context, doc *Document) (*Document, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := lockForWrite(ctx, tx, doc.ID, doc.UserID); err != nil {
+		return nil, err
+	}
+
 	query := `UPDATE documents 
               SET title = $1, content = $2, updated_at = $3
               WHERE id = $4 AND user_id = $5
@@ -76,18 +92,143 @@ func (r *PostgresRepository) UpdateDocument(ctx context.Context, doc *Document)
 
 	now := time.Now()
 	var document Document
-	err := r.db.QueryRowxContext(ctx, query, doc.Title, doc.Content, now, doc.ID, doc.UserID).
+	err = tx.QueryRowxContext(ctx, query, doc.Title, doc.Content, now, doc.ID, doc.UserID).
 		StructScan(&document)
 	if err != nil {
-		return nil, err
+		return nil, notFound(err)
 	}
 
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
 	return &document, nil
 }
 
-// DeleteDocument удаляет документ
+// DeleteDocument удаляет документ.
+// Возвращает ErrDocumentLocked, если документ заблокирован другим пользователем.
 func (r *PostgresRepository) DeleteDocument(ctx context.Context, id, userID uuid.UUID) error {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockForWrite(ctx, tx, id, userID); err != nil {
+		return err
+	}
+
 	query := `DELETE FROM documents WHERE id = $1 AND user_id = $2`
-	_, err := r.db.ExecContext(ctx, query, id, userID)
+	if _, err := tx.ExecContext(ctx, query, id, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockForWrite блокирует строку документа до конца транзакции и проверяет, что документ
+// не заблокирован другим пользователем. AcquireLock блокирует ту же строку, поэтому
+// блокировка не может появиться между проверкой и записью.
+func lockForWrite(ctx context.Context, tx *sqlx.Tx, documentID, userID uuid.UUID) error {
+	var id uuid.UUID
+	query := `SELECT id FROM documents WHERE id = $1 AND user_id = $2 FOR UPDATE`
+	if err := tx.GetContext(ctx, &id, query, documentID, userID); err != nil {
+		return notFound(err)
+	}
+
+	var locked bool
+	lockQuery := `SELECT EXISTS (SELECT 1 FROM document_locks
+              WHERE document_id = $1 AND owner_id <> $2 AND expires_at > NOW())`
+	if err := tx.GetContext(ctx, &locked, lockQuery, documentID, userID); err != nil {
+		return err
+	}
+	if locked {
+		return ErrDocumentLocked
+	}
+	return nil
+}
+
+// AcquireLock устанавливает или продлевает блокировку.
+// Возвращает ErrLockHeld, если действует блокировка другого пользователя.
+func (r *PostgresRepository) AcquireLock(ctx context.Context, lock *DocumentLock) (*DocumentLock, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Сериализуем установку блокировок одного документа
+	var documentID uuid.UUID
+	if err := tx.GetContext(ctx, &documentID, `SELECT id FROM documents WHERE id = $1 FOR UPDATE`, lock.DocumentID); err != nil {
+		return nil, notFound(err)
+	}
+
+	var held bool
+	heldQuery := `SELECT EXISTS (SELECT 1 FROM document_locks
+              WHERE document_id = $1 AND owner_id <> $2 AND expires_at > NOW())`
+	if err := tx.GetContext(ctx, &held, heldQuery, lock.DocumentID, lock.OwnerID); err != nil {
+		return nil, err
+	}
+	if held {
+		return nil, ErrLockHeld
+	}
+
+	upsertQuery := `INSERT INTO document_locks (document_id, owner_id, expires_at)
+              VALUES ($1, $2, $3)
+              ON CONFLICT (document_id) DO UPDATE
+              SET owner_id = EXCLUDED.owner_id,
+                  expires_at = EXCLUDED.expires_at,
+                  created_at = CASE WHEN document_locks.owner_id = EXCLUDED.owner_id
+                                    THEN document_locks.created_at ELSE NOW() END
+              RETURNING document_id, owner_id, created_at, expires_at`
+
+	var acquired DocumentLock
+	err = tx.QueryRowxContext(ctx, upsertQuery, lock.DocumentID, lock.OwnerID, lock.ExpiresAt).
+		StructScan(&acquired)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &acquired, nil
+}
+
+// ReleaseLock снимает блокировку. Если ownerID задан, снимается только блокировка этого пользователя.
+// Возвращает ErrLockNotFound, если подходящей блокировки нет.
+func (r *PostgresRepository) ReleaseLock(ctx context.Context, documentID uuid.UUID, ownerID *uuid.UUID) error {
+	query := `DELETE FROM document_locks
+              WHERE document_id = $1 AND ($2::uuid IS NULL OR owner_id = $2)`
+	result, err := r.db.ExecContext(ctx, query, documentID, ownerID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrLockNotFound
+	}
+	return nil
+}
+
+// GetLocks возвращает действующие блокировки документа
+func (r *PostgresRepository) GetLocks(ctx context.Context, documentID uuid.UUID) ([]*DocumentLock, error) {
+	locks := []*DocumentLock{}
+	query := `SELECT document_id, owner_id, created_at, expires_at FROM document_locks
+              WHERE document_id = $1 AND expires_at > NOW()`
+	err := r.db.SelectContext(ctx, &locks, query, documentID)
+	if err != nil {
+		return nil, err
+	}
+	return locks, nil
+}
+
+// notFound заменяет отсутствие строки на ErrDocumentNotFound
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrDocumentNotFound
+	}
 	return err
 }
@@ -2,7 +2,16 @@ package document
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// Время жизни блокировки по умолчанию и максимальное
+	defaultLockTTL = 5 * time.Minute
+	maxLockTTL     = time.Hour
 )
 
 // Service интерфейс сервиса для работы с документами
@@ -12,17 +21,23 @@ type Service interface {
 	CreateDocument(ctx context.Context, req CreateDocumentRequest) (*Document, error)
 	UpdateDocument(ctx context.Context, req UpdateDocumentRequest) (*Document, error)
 	DeleteDocument(ctx context.Context, req DeleteDocumentRequest) error
+	SubscribeDocument(ctx context.Context, req SubscribeDocumentRequest) (*Subscription, *Document, error)
+	LockDocument(ctx context.Context, req LockDocumentRequest) (*DocumentLock, error)
+	UnlockDocument(ctx context.Context, req UnlockDocumentRequest) error
+	GetDocumentLocks(ctx context.Context, req GetDocumentLocksRequest) ([]*DocumentLock, error)
 }
 
 // DocumentService реализация сервиса для работы с документами
 type DocumentService struct {
 	repo Repository
+	hub  *Hub
 }
 
 // NewDocumentService создает новый сервис для работы с документами
-func NewDocumentService(repo Repository) *DocumentService {
+func NewDocumentService(repo Repository, hub *Hub) *DocumentService {
 	return &DocumentService{
 		repo: repo,
+		hub:  hub,
 	}
 }
 
@@ -46,6 +61,10 @@ func (s *DocumentService) GetDocument(ctx context.Context, req GetDocumentReques
 
 // CreateDocument создает новый документ
 func (s *DocumentService) CreateDocument(ctx context.Context, req CreateDocumentRequest) (*Document, error) {
+	if strings.TrimSpace(req.Title) == "" {
+		return nil, ErrEmptyTitle
+	}
+
 	document := &Document{
 		Title:   req.Title,
 		Content: req.Content,
@@ -60,7 +79,7 @@ func (s *DocumentService) CreateDocument(ctx context.Context, req CreateDocument
 	return createdDoc, nil
 }
 
-// UpdateDocument обновляет документ
+// UpdateDocument обновляет документ, если он не заблокирован другим пользователем
 func (s *DocumentService) UpdateDocument(ctx context.Context, req UpdateDocumentRequest) (*Document, error) {
 	document := &Document{
 		ID:      req.ID,
@@ -74,14 +93,103 @@ func (s *DocumentService) UpdateDocument(ctx context.Context, req UpdateDocument
 		return nil, fmt.Errorf("failed to update document: %w", err)
 	}
 
+	s.hub.Publish(updatedDoc.ID, Event{UserID: req.UserID, Document: updatedDoc})
+
 	return updatedDoc, nil
 }
 
-// DeleteDocument удаляет документ
+// DeleteDocument удаляет документ, если он не заблокирован другим пользователем
 func (s *DocumentService) DeleteDocument(ctx context.Context, req DeleteDocumentRequest) error {
 	err := s.repo.DeleteDocument(ctx, req.ID, req.UserID)
 	if err != nil {
 		return fmt.Errorf("failed to delete document: %w", err)
 	}
+
+	s.hub.Publish(req.ID, Event{UserID: req.UserID, Deleted: true})
+	return nil
+}
+
+// SubscribeDocument подписывает пользователя на изменения документа и возвращает его текущее состояние.
+// Подписка оформляется до чтения документа, поэтому изменения не теряются.
+func (s *DocumentService) SubscribeDocument(ctx context.Context, req SubscribeDocumentRequest) (*Subscription, *Document, error) {
+	sub, err := s.hub.Subscribe(req.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to subscribe to document: %w", err)
+	}
+
+	document, err := s.repo.GetDocument(ctx, req.ID, req.UserID)
+	if err != nil {
+		sub.Close()
+		return nil, nil, fmt.Errorf("failed to get document: %w", err)
+	}
+
+	return sub, document, nil
+}
+
+// LockDocument блокирует документ для пользователя
+func (s *DocumentService) LockDocument(ctx context.Context, req LockDocumentRequest) (*DocumentLock, error) {
+	if _, err := s.repo.GetDocument(ctx, req.ID, req.UserID); err != nil {
+		return nil, fmt.Errorf("failed to get document: %w", err)
+	}
+
+	ttl := req.TTL
+	if ttl <= 0 {
+		ttl = defaultLockTTL
+	}
+	if ttl > maxLockTTL {
+		ttl = maxLockTTL
+	}
+
+	lock, err := s.repo.AcquireLock(ctx, &DocumentLock{
+		DocumentID: req.ID,
+		OwnerID:    req.UserID,
+		ExpiresAt:  time.Now().Add(ttl),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock document: %w", err)
+	}
+
+	s.hub.Publish(req.ID, Event{UserID: req.UserID, Lock: lock})
+	return lock, nil
+}
+
+// UnlockDocument снимает блокировку пользователя.
+// Принудительно снять чужую блокировку может только владелец документа.
+func (s *DocumentService) UnlockDocument(ctx context.Context, req UnlockDocumentRequest) error {
+	ownerID := &req.UserID
+	if req.Force {
+		// Документ доступен только владельцу, поэтому его наличие подтверждает роль
+		if _, err := s.repo.GetDocument(ctx, req.ID, req.UserID); err != nil {
+			if errors.Is(err, ErrDocumentNotFound) {
+				return ErrNotDocumentOwner
+			}
+			return fmt.Errorf("failed to get document: %w", err)
+		}
+		ownerID = nil
+	}
+
+	if err := s.repo.ReleaseLock(ctx, req.ID, ownerID); err != nil {
+		return fmt.Errorf("failed to unlock document: %w", err)
+	}
+
+	s.hub.Publish(req.ID, Event{
+		UserID:       req.UserID,
+		Lock:         &DocumentLock{DocumentID: req.ID},
+		LockReleased: true,
+		LockForced:   req.Force,
+	})
 	return nil
 }
+
+// GetDocumentLocks возвращает действующие блокировки документа
+func (s *DocumentService) GetDocumentLocks(ctx context.Context, req GetDocumentLocksRequest) ([]*DocumentLock, error) {
+	if _, err := s.repo.GetDocument(ctx, req.ID, req.UserID); err != nil {
+		return nil, fmt.Errorf("failed to get document: %w", err)
+	}
+
+	locks, err := s.repo.GetLocks(ctx, req.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document locks: %w", err)
+	}
+	return locks, nil
+}
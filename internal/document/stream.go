@@ -0,0 +1,229 @@
+package document
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/google/uuid"
+	pb "github.com/malaxitlmax/penfeel/api/proto"
+	"github.com/malaxitlmax/penfeel/pkg/apperrors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SubscribeDocument отправляет текущее состояние документа, а затем его изменения
+func (s *GRPCServer) SubscribeDocument(req *pb.SubscribeDocumentRequest, stream pb.DocumentService_SubscribeDocumentServer) error {
+	domainReq, err := parseSubscribeRequest(stream.Context(), req.Id)
+	if err != nil {
+		return err
+	}
+
+	sub, document, err := s.service.SubscribeDocument(stream.Context(), domainReq)
+	if err != nil {
+		return subscribeError(err)
+	}
+	defer sub.Close()
+
+	if err := stream.Send(snapshotEvent(sub, domainReq.UserID, document)); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, ok := <-sub.Events():
+			if !ok {
+				return subscriptionError(sub)
+			}
+			if err := stream.Send(eventToProto(domainReq.ID, event)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// CollaborateDocument принимает правки документа и отправляет его изменения.
+// Правки от клиента читаются в отдельной горутине, а все ответы отправляются из основной:
+// gRPC поток не допускает конкурентной отправки.
+func (s *GRPCServer) CollaborateDocument(stream pb.DocumentService_CollaborateDocumentServer) error {
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	join := first.GetJoin()
+	if join == nil {
+		return status.Error(codes.InvalidArgument, "the first message must be join")
+	}
+
+	domainReq, err := parseSubscribeRequest(stream.Context(), join.Id)
+	if err != nil {
+		return err
+	}
+
+	sub, document, err := s.service.SubscribeDocument(stream.Context(), domainReq)
+	if err != nil {
+		return subscribeError(err)
+	}
+	defer sub.Close()
+
+	if err := stream.Send(snapshotEvent(sub, domainReq.UserID, document)); err != nil {
+		return err
+	}
+
+	requests := make(chan *pb.CollaborateRequest)
+	receiveErr := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				receiveErr <- err
+				return
+			}
+			select {
+			case requests <- req:
+			case <-stream.Context().Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+
+		case err := <-receiveErr:
+			// Клиент завершил отправку правок
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+
+		case event, ok := <-sub.Events():
+			if !ok {
+				return subscriptionError(sub)
+			}
+			if err := stream.Send(eventToProto(domainReq.ID, event)); err != nil {
+				return err
+			}
+
+		case req := <-requests:
+			edit := req.GetEdit()
+			if edit == nil {
+				return status.Error(codes.InvalidArgument, "already joined, expected edit")
+			}
+
+			if err := stream.Send(s.applyEdit(stream, domainReq, edit)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// applyEdit сохраняет правку и возвращает подтверждение или ошибку.
+// Само изменение клиент получит через подписку вместе с остальными участниками.
+func (s *GRPCServer) applyEdit(stream pb.DocumentService_CollaborateDocumentServer, subscribeReq SubscribeDocumentRequest, edit *pb.CollaborateEdit) *pb.DocumentEvent {
+	_, err := s.service.UpdateDocument(stream.Context(), UpdateDocumentRequest{
+		ID:      subscribeReq.ID,
+		Title:   edit.Title,
+		Content: edit.Content,
+		UserID:  subscribeReq.UserID,
+	})
+	if err != nil {
+		st := status.Convert(apperrors.ToStatus(err))
+		return &pb.DocumentEvent{
+			UserId: subscribeReq.UserID.String(),
+			Event: &pb.DocumentEvent_Error{Error: &pb.CollaborateError{
+				RequestId: edit.RequestId,
+				Error:     st.Message(),
+				Code:      int32(st.Code()),
+				Reason:    apperrors.Reason(st.Err()),
+			}},
+		}
+	}
+
+	return &pb.DocumentEvent{
+		UserId: subscribeReq.UserID.String(),
+		Event:  &pb.DocumentEvent_Ack{Ack: &pb.CollaborateAck{RequestId: edit.RequestId}},
+	}
+}
+
+// parseSubscribeRequest проверяет идентификатор документа и определяет пользователя по удостоверению
+func parseSubscribeRequest(ctx context.Context, documentID string) (SubscribeDocumentRequest, error) {
+	id, err := uuid.Parse(documentID)
+	if err != nil {
+		return SubscribeDocumentRequest{}, apperrors.ToStatus(ErrInvalidDocumentID)
+	}
+
+	user, err := currentUser(ctx)
+	if err != nil {
+		return SubscribeDocumentRequest{}, err
+	}
+
+	return SubscribeDocumentRequest{ID: id, UserID: user}, nil
+}
+
+// subscribeError преобразует ошибку подписки в статус gRPC
+func subscribeError(err error) error {
+	if errors.Is(err, ErrHubClosed) {
+		return status.Error(codes.Unavailable, ErrHubClosed.Error())
+	}
+	return apperrors.ToStatus(err)
+}
+
+// subscriptionError возвращает статус завершения потока после закрытия подписки
+func subscriptionError(sub *Subscription) error {
+	switch err := sub.Err(); {
+	case errors.Is(err, ErrSlowSubscriber):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, ErrHubClosed):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		// Документ удалён, событие удаления уже отправлено
+		return nil
+	}
+}
+
+// snapshotEvent событие с состоянием документа на момент подписки
+func snapshotEvent(sub *Subscription, userID uuid.UUID, document *Document) *pb.DocumentEvent {
+	return &pb.DocumentEvent{
+		Version: sub.Version(),
+		UserId:  userID.String(),
+		Event:   &pb.DocumentEvent_Snapshot{Snapshot: documentToProto(document)},
+	}
+}
+
+// eventToProto преобразует изменение документа в protobuf формат
+func eventToProto(documentID uuid.UUID, event Event) *pb.DocumentEvent {
+	result := &pb.DocumentEvent{
+		Version: event.Version,
+		UserId:  event.UserID.String(),
+	}
+	switch {
+	case event.Deleted:
+		result.Event = &pb.DocumentEvent_Deleted{Deleted: &pb.DocumentDeleted{Id: documentID.String()}}
+	case event.Lock != nil:
+		result.Event = &pb.DocumentEvent_Lock{Lock: &pb.DocumentLockEvent{
+			Lock:     lockToProto(event.Lock),
+			Released: event.LockReleased,
+			Forced:   event.LockForced,
+		}}
+	default:
+		result.Event = &pb.DocumentEvent_Updated{Updated: documentToProto(event.Document)}
+	}
+	return result
+}
+
+// documentToProto преобразует документ в protobuf формат
+func documentToProto(document *Document) *pb.Document {
+	return &pb.Document{
+		Id:        document.ID.String(),
+		Title:     document.Title,
+		Content:   document.Content,
+		UserId:    document.UserID.String(),
+		CreatedAt: document.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt: document.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
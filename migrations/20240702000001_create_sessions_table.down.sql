@@ -0,0 +1,6 @@
+ALTER INDEX idx_refresh_tokens_session_id RENAME TO idx_refresh_tokens_family_id;
+ALTER TABLE refresh_tokens DROP CONSTRAINT refresh_tokens_session_id_fkey;
+ALTER TABLE refresh_tokens ADD COLUMN revoked_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE refresh_tokens RENAME COLUMN session_id TO family_id;
+
+DROP TABLE IF EXISTS sessions;
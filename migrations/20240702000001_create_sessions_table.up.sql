@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS sessions (
+    -- Совпадает с jti access токенов сессии
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    -- Продлевается при каждом обмене refresh токена
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_sessions_user_id ON sessions (user_id);
+
+-- Цепочка refresh токенов принадлежит сессии и отзывается вместе с ней.
+-- Токены, выданные до появления сессий, привязать не к чему.
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens RENAME COLUMN family_id TO session_id;
+ALTER TABLE refresh_tokens DROP COLUMN revoked_at;
+ALTER TABLE refresh_tokens ADD CONSTRAINT refresh_tokens_session_id_fkey
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE CASCADE;
+ALTER INDEX idx_refresh_tokens_family_id RENAME TO idx_refresh_tokens_session_id;
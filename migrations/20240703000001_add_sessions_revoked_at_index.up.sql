@@ -0,0 +1,2 @@
+-- Шлюз периодически загружает сессии, отозванные после последней синхронизации
+CREATE INDEX IF NOT EXISTS idx_sessions_revoked_at ON sessions (revoked_at) WHERE revoked_at IS NOT NULL;
@@ -0,0 +1,30 @@
+-- Секрет TOTP задаётся при настройке и действует после подтверждения кодом (totp_enabled_at)
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(64);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMP WITH TIME ZONE;
+-- Номер интервала последнего принятого кода: код нельзя использовать повторно
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_counter BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- SHA-256 нормализованного кода; сам код показывается пользователю один раз
+    code_hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE UNIQUE INDEX idx_recovery_codes_user_id_code_hash ON recovery_codes (user_id, code_hash);
+
+-- Первый шаг входа с двухфакторной аутентификацией: пароль проверен, ожидается код
+CREATE TABLE IF NOT EXISTS login_challenges (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    -- Неверные коды, после нескольких попыток вход нужно начинать заново
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_login_challenges_user_id ON login_challenges (user_id);
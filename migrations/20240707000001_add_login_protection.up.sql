@@ -0,0 +1,30 @@
+-- Счётчики неудачных попыток входа: scope account — по email, ip — по адресу клиента
+CREATE TABLE IF NOT EXISTS login_throttles (
+    scope VARCHAR(16) NOT NULL,
+    throttle_key VARCHAR(255) NOT NULL,
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    last_failed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (scope, throttle_key)
+);
+
+-- Журнал блокировок входа
+CREATE TABLE IF NOT EXISTS login_lockouts (
+    id UUID PRIMARY KEY,
+    scope VARCHAR(16) NOT NULL,
+    throttle_key VARCHAR(255) NOT NULL,
+    -- Владелец заблокированного email, если он зарегистрирован
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    -- Адрес, с которого пришла последняя неудачная попытка
+    ip_address VARCHAR(64) NOT NULL DEFAULT '',
+    failed_attempts INTEGER NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    -- SHA-256 токена из письма, которым владелец может снять блокировку
+    unlock_token_hash VARCHAR(64) UNIQUE,
+    unlock_expires_at TIMESTAMP WITH TIME ZONE,
+    unlocked_at TIMESTAMP WITH TIME ZONE,
+    -- Кто снял блокировку: email (ссылка из письма), password_reset или admin
+    unlocked_by VARCHAR(32)
+);
+
+CREATE INDEX idx_login_lockouts_scope_throttle_key ON login_lockouts (scope, throttle_key);
@@ -0,0 +1,34 @@
+-- Учётные записи внешних провайдеров OpenID Connect, через которые входит пользователь
+CREATE TABLE IF NOT EXISTS user_identities (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    -- Постоянный идентификатор пользователя у провайдера (claim sub)
+    subject VARCHAR(255) NOT NULL,
+    -- Email из последнего ID токена, только для показа
+    email VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_login_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (provider, subject)
+);
+
+CREATE INDEX idx_user_identities_user_id ON user_identities (user_id);
+
+-- Начатые входы через провайдера: state из адреса возврата связывает ответ провайдера
+-- с запросом, привязка — с браузером, который начал вход, nonce и верификатор PKCE
+-- проверяют код и ID токен
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    id UUID PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL,
+    -- SHA-256 state; сам state передаётся только через провайдера
+    state_hash VARCHAR(64) NOT NULL UNIQUE,
+    -- SHA-256 привязки, которую шлюз хранит в cookie браузера
+    binding_hash VARCHAR(64) NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX idx_oidc_login_states_expires_at ON oidc_login_states (expires_at);
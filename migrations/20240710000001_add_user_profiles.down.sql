@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS user_avatars;
+
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_updated_at;
+ALTER TABLE users DROP COLUMN IF EXISTS pending_email;
+ALTER TABLE users DROP COLUMN IF EXISTS bio;
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
@@ -0,0 +1,14 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS display_name VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS bio VARCHAR(500) NOT NULL DEFAULT '';
+-- Новый email, ожидающий подтверждения; до подтверждения пользователь входит с прежним
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email VARCHAR(255);
+-- Время загрузки аватара, NULL если аватара нет; входит в адрес аватара, чтобы сбрасывать кэш
+ALTER TABLE users ADD COLUMN IF NOT EXISTS avatar_updated_at TIMESTAMP WITH TIME ZONE;
+
+-- Аватары хранятся отдельно, чтобы запросы пользователей не читали изображения
+CREATE TABLE IF NOT EXISTS user_avatars (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    content_type VARCHAR(50) NOT NULL,
+    data BYTEA NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
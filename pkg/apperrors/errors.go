@@ -0,0 +1,106 @@
+package apperrors
+
+import (
+	"errors"
+	"time"
+)
+
+// Категории ошибок предметной области. Проверяются через errors.Is
+// и определяют код ответа gRPC сервисов.
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrAlreadyExists    = errors.New("already exists")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrInvalidArgument  = errors.New("invalid argument")
+	ErrConflict         = errors.New("conflict")
+	ErrUnauthenticated  = errors.New("unauthenticated")
+	ErrTooManyRequests  = errors.New("too many requests")
+)
+
+// Error ошибка предметной области
+type Error struct {
+	kind error
+	// Машиночитаемая причина ошибки, например DOCUMENT_NOT_FOUND
+	Reason string
+	// Текст ошибки, который можно показать клиенту
+	Message string
+	// Поле запроса, не прошедшее проверку
+	Field string
+	// Через сколько можно повторить запрос, ноль если неизвестно
+	RetryAfter time.Duration
+	// Исходная ошибка, клиенту не передаётся
+	cause error
+	// Ошибка, копией которой является эта
+	origin *Error
+}
+
+// Error возвращает текст ошибки
+func (e *Error) Error() string {
+	if e.cause != nil {
+		return e.Message + ": " + e.cause.Error()
+	}
+	return e.Message
+}
+
+// Is сообщает, относится ли ошибка к категории target или порождена ошибкой target
+func (e *Error) Is(target error) bool {
+	return target == e.kind || (e.origin != nil && target == e.origin)
+}
+
+// Unwrap возвращает исходную ошибку
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Wrap возвращает копию ошибки с исходной ошибкой cause.
+// Копия совпадает с оригиналом в errors.Is.
+func (e *Error) Wrap(cause error) error {
+	wrapped := *e
+	wrapped.cause = cause
+	wrapped.origin = e
+	return &wrapped
+}
+
+// WithRetryAfter возвращает копию ошибки со временем, через которое можно повторить запрос.
+// Копия совпадает с оригиналом в errors.Is.
+func (e *Error) WithRetryAfter(d time.Duration) error {
+	wrapped := *e
+	wrapped.RetryAfter = d
+	wrapped.origin = e
+	return &wrapped
+}
+
+// NotFound ошибка отсутствующего ресурса
+func NotFound(reason, message string) *Error {
+	return &Error{kind: ErrNotFound, Reason: reason, Message: message}
+}
+
+// AlreadyExists ошибка создания уже существующего ресурса
+func AlreadyExists(reason, message string) *Error {
+	return &Error{kind: ErrAlreadyExists, Reason: reason, Message: message}
+}
+
+// PermissionDenied ошибка недостаточных прав
+func PermissionDenied(reason, message string) *Error {
+	return &Error{kind: ErrPermissionDenied, Reason: reason, Message: message}
+}
+
+// InvalidArgument ошибка проверки поля запроса
+func InvalidArgument(field, message string) *Error {
+	return &Error{kind: ErrInvalidArgument, Reason: "INVALID_ARGUMENT", Message: message, Field: field}
+}
+
+// Conflict ошибка, вызванная текущим состоянием ресурса, например чужой блокировкой
+func Conflict(reason, message string) *Error {
+	return &Error{kind: ErrConflict, Reason: reason, Message: message}
+}
+
+// Unauthenticated ошибка отсутствующих или неверных учётных данных
+func Unauthenticated(reason, message string) *Error {
+	return &Error{kind: ErrUnauthenticated, Reason: reason, Message: message}
+}
+
+// TooManyRequests ошибка превышения лимита попыток
+func TooManyRequests(reason, message string) *Error {
+	return &Error{kind: ErrTooManyRequests, Reason: reason, Message: message}
+}
@@ -0,0 +1,142 @@
+package apperrors
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Domain домен ошибок в errdetails.ErrorInfo
+const Domain = "penfeel"
+
+// Code возвращает код gRPC для категории ошибки. Категорию задаёт внешняя ошибка предметной области:
+// исходная ошибка, переданная в Wrap, на код не влияет.
+func Code(err error) codes.Code {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		err = appErr.kind
+	}
+
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return codes.NotFound
+	case errors.Is(err, ErrAlreadyExists):
+		return codes.AlreadyExists
+	case errors.Is(err, ErrPermissionDenied):
+		return codes.PermissionDenied
+	case errors.Is(err, ErrInvalidArgument):
+		return codes.InvalidArgument
+	case errors.Is(err, ErrConflict):
+		return codes.Aborted
+	case errors.Is(err, ErrUnauthenticated):
+		return codes.Unauthenticated
+	case errors.Is(err, ErrTooManyRequests):
+		return codes.ResourceExhausted
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	default:
+		return codes.Internal
+	}
+}
+
+// ToStatus преобразует ошибку сервиса в статус gRPC.
+// Ошибки предметной области передаются клиенту с причиной в errdetails.ErrorInfo,
+// ошибки проверки полей — с errdetails.BadRequest. Текст прочих ошибок клиенту не передаётся.
+func ToStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	code := Code(err)
+
+	var appErr *Error
+	if !errors.As(err, &appErr) {
+		if code == codes.Internal {
+			log.Printf("Internal error: %v", err)
+			return status.Error(codes.Internal, "internal error")
+		}
+		return status.Error(code, err.Error())
+	}
+
+	st := status.New(code, appErr.Message)
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: appErr.Reason, Domain: Domain}}
+	if appErr.Field != "" {
+		details = append(details, &errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+				Field:       appErr.Field,
+				Description: appErr.Message,
+			}},
+		})
+	}
+	if appErr.RetryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(appErr.RetryAfter)})
+	}
+
+	withDetails, detailsErr := st.WithDetails(details...)
+	if detailsErr != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// Reason возвращает причину из errdetails.ErrorInfo статуса gRPC
+func Reason(err error) string {
+	st, ok := status.FromError(err)
+	if !ok {
+		return ""
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+// RetryAfter возвращает время из errdetails.RetryInfo статуса gRPC, через которое можно повторить запрос
+func RetryAfter(err error) time.Duration {
+	st, ok := status.FromError(err)
+	if !ok {
+		return 0
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.RetryInfo); ok {
+			return info.RetryDelay.AsDuration()
+		}
+	}
+	return 0
+}
+
+// FieldViolations возвращает ошибки проверки полей из errdetails.BadRequest статуса gRPC
+func FieldViolations(err error) map[string]string {
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil
+	}
+	var violations map[string]string
+	for _, detail := range st.Details() {
+		badRequest, ok := detail.(*errdetails.BadRequest)
+		if !ok {
+			continue
+		}
+		for _, violation := range badRequest.FieldViolations {
+			if violations == nil {
+				violations = make(map[string]string)
+			}
+			violations[violation.Field] = violation.Description
+		}
+	}
+	return violations
+}
@@ -8,9 +8,12 @@ import (
 	"github.com/google/uuid"
 )
 
-// JWTService сервис для работы с JWT токенами
+// JWTService сервис для работы с JWT токенами.
+// Access токены подписываются общим секретом (HS256) или ключами KeySet (RS256, EdDSA),
+// refresh токены проверяет только auth-сервис, они всегда подписываются секретом.
 type JWTService struct {
 	secretKey     string
+	keys          *KeySet
 	expirationHrs int
 	refreshKey    string
 	refreshExpHrs int
@@ -32,20 +35,39 @@ func NewJWTService(secretKey string, expirationHrs int, refreshKey string, refre
 	}
 }
 
-// GenerateToken генерирует JWT токен для пользователя
-func (s *JWTService) GenerateToken(userID uuid.UUID) (string, time.Time, error) {
+// NewAsymmetricJWTService создает JWT сервис, подписывающий access токены ключами keys
+func NewAsymmetricJWTService(keys *KeySet, expirationHrs int, refreshKey string, refreshExpHrs int) *JWTService {
+	return &JWTService{
+		keys:          keys,
+		expirationHrs: expirationHrs,
+		refreshKey:    refreshKey,
+		refreshExpHrs: refreshExpHrs,
+	}
+}
+
+// JWKS возвращает открытые ключи access токенов; при подписи секретом набор пуст
+func (s *JWTService) JWKS() JWKS {
+	if s.keys == nil {
+		return JWKS{Keys: []JWK{}}
+	}
+	return s.keys.JWKS()
+}
+
+// GenerateToken генерирует JWT токен для пользователя. sessionID записывается в jti,
+// токены отозванной сессии отклоняются при проверке.
+func (s *JWTService) GenerateToken(userID, sessionID uuid.UUID) (string, time.Time, error) {
 	expirationTime := time.Now().Add(time.Duration(s.expirationHrs) * time.Hour)
 
 	claims := &Claims{
 		UserID: userID.String(),
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID.String(),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(s.secretKey))
+	tokenString, err := s.sign(claims)
 	if err != nil {
 		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
 	}
@@ -53,13 +75,15 @@ func (s *JWTService) GenerateToken(userID uuid.UUID) (string, time.Time, error)
 	return tokenString, expirationTime, nil
 }
 
-// GenerateRefreshToken генерирует refresh токен
-func (s *JWTService) GenerateRefreshToken(userID uuid.UUID) (string, error) {
+// GenerateRefreshToken генерирует refresh токен. tokenID записывается в jti,
+// по нему токен находится в хранилище при обмене.
+func (s *JWTService) GenerateRefreshToken(userID, tokenID uuid.UUID) (string, time.Time, error) {
 	expirationTime := time.Now().Add(time.Duration(s.refreshExpHrs) * time.Hour)
 
 	claims := &Claims{
 		UserID: userID.String(),
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenID.String(),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
@@ -68,14 +92,26 @@ func (s *JWTService) GenerateRefreshToken(userID uuid.UUID) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenString, err := token.SignedString([]byte(s.refreshKey))
 	if err != nil {
-		return "", fmt.Errorf("failed to sign refresh token: %w", err)
+		return "", time.Time{}, fmt.Errorf("failed to sign refresh token: %w", err)
 	}
 
-	return tokenString, nil
+	return tokenString, expirationTime, nil
+}
+
+// sign подписывает access токен ключом KeySet или секретом
+func (s *JWTService) sign(claims *Claims) (string, error) {
+	if s.keys != nil {
+		return s.keys.Sign(claims)
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.secretKey))
 }
 
 // ValidateToken проверяет валидность токена
 func (s *JWTService) ValidateToken(tokenString string) (*Claims, error) {
+	if s.keys != nil {
+		return parseSignedToken(tokenString, s.keys)
+	}
+
 	claims := &Claims{}
 
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
@@ -117,3 +153,43 @@ func (s *JWTService) ValidateRefreshToken(tokenString string) (*Claims, error) {
 
 	return claims, nil
 }
+
+// JWTVerifier проверяет access токены по открытым ключам, не зная секретов auth-сервиса
+type JWTVerifier struct {
+	keys PublicKeys
+}
+
+// NewJWTVerifier создает проверку токенов по ключам keys, например RemoteKeySet
+func NewJWTVerifier(keys PublicKeys) *JWTVerifier {
+	return &JWTVerifier{
+		keys: keys,
+	}
+}
+
+// ValidateToken проверяет подпись и срок действия токена
+func (v *JWTVerifier) ValidateToken(tokenString string) (*Claims, error) {
+	return parseSignedToken(tokenString, v.keys)
+}
+
+// parseSignedToken проверяет токен, подписанный асимметричным ключом с kid из keys
+func parseSignedToken(tokenString string, keys PublicKeys) (*Claims, error) {
+	claims := &Claims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, fmt.Errorf("token has no key ID: %w", ErrUnknownKey)
+		}
+		return keys.PublicKey(kid)
+	}, jwt.WithValidMethods([]string{AlgorithmRS256, AlgorithmEdDSA}))
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token: %w", err)
+	}
+
+	if !token.Valid {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	return claims, nil
+}
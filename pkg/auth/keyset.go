@@ -0,0 +1,347 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/malaxitlmax/penfeel/config"
+)
+
+// rsaKeyBits длина генерируемых RSA ключей
+const rsaKeyBits = 2048
+
+// rotationCheckInterval как часто проверять необходимость ротации ключей
+const rotationCheckInterval = time.Minute
+
+// SigningKey ключ подписи access токенов
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	CreatedAt time.Time
+	private   crypto.Signer
+}
+
+// KeySet ключи подписи access токенов, хранящиеся в каталоге по файлу на ключ.
+// Новый ключ сначала только публикуется и начинает подписывать токены через
+// KeyActivationDelay, чтобы проверяющие сервисы успели получить его из JWKS.
+// Прежний ключ после этого выводится из оборота, но остаётся опубликованным,
+// пока не истекут подписанные им токены.
+type KeySet struct {
+	dir              string
+	algorithm        string
+	rotationInterval time.Duration
+	activationDelay  time.Duration
+	// Время жизни access токена: столько выведенный из оборота ключ остаётся опубликованным
+	retention time.Duration
+
+	mu sync.RWMutex
+	// Ключи по возрастанию времени создания
+	keys []*SigningKey
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewKeySet загружает ключи из cfg.KeysDir, создаёт первый ключ при пустом каталоге
+// и запускает плановую ротацию
+func NewKeySet(cfg config.JWTConfig) (*KeySet, error) {
+	if cfg.Algorithm != AlgorithmRS256 && cfg.Algorithm != AlgorithmEdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", cfg.Algorithm)
+	}
+	if err := os.MkdirAll(cfg.KeysDir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create keys directory: %w", err)
+	}
+
+	k := &KeySet{
+		dir:              cfg.KeysDir,
+		algorithm:        cfg.Algorithm,
+		rotationInterval: cfg.KeyRotationInterval,
+		activationDelay:  cfg.KeyActivationDelay,
+		retention:        time.Duration(cfg.ExpirationHours) * time.Hour,
+		stop:             make(chan struct{}),
+	}
+	if err := k.rotateIfDue(time.Now()); err != nil {
+		return nil, err
+	}
+
+	go k.runRotation()
+	return k, nil
+}
+
+// Close останавливает плановую ротацию
+func (k *KeySet) Close() {
+	k.closeOnce.Do(func() {
+		close(k.stop)
+	})
+}
+
+// Sign подписывает claims действующим ключом и указывает его kid в заголовке
+func (k *KeySet) Sign(claims jwt.Claims) (string, error) {
+	key := k.signingKey(time.Now())
+	if key == nil {
+		return "", errors.New("no signing key")
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.private)
+}
+
+// PublicKey возвращает открытый ключ kid: ожидающего ввода, действующего или выведенного из оборота
+func (k *KeySet) PublicKey(kid string) (crypto.PublicKey, error) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		if key.ID == kid {
+			return key.private.Public(), nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+// JWKS возвращает все опубликованные ключи
+func (k *KeySet) JWKS() JWKS {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	keys := JWKS{Keys: make([]JWK, 0, len(k.keys))}
+	for _, key := range k.keys {
+		jwk, err := NewJWK(key.ID, key.private.Public())
+		if err != nil {
+			continue
+		}
+		keys.Keys = append(keys.Keys, jwk)
+	}
+	return keys
+}
+
+// Rotate создаёт новый ключ. Он начнёт подписывать токены через KeyActivationDelay.
+func (k *KeySet) Rotate() error {
+	key, err := k.generate(time.Now())
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.keys = append(k.keys, key)
+	k.mu.Unlock()
+
+	log.Printf("Created JWT signing key %s (%s)", key.ID, key.Algorithm)
+	return nil
+}
+
+// signingKey возвращает самый новый ключ, время ввода которого наступило.
+// Если таких нет, например сразу после создания первого ключа, — самый старый.
+func (k *KeySet) signingKey(now time.Time) *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	if len(k.keys) == 0 {
+		return nil
+	}
+	for i := len(k.keys) - 1; i >= 0; i-- {
+		if !now.Before(k.keys[i].CreatedAt.Add(k.activationDelay)) {
+			return k.keys[i]
+		}
+	}
+	return k.keys[0]
+}
+
+// runRotation периодически проверяет необходимость ротации ключей
+func (k *KeySet) runRotation() {
+	ticker := time.NewTicker(rotationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.stop:
+			return
+		case now := <-ticker.C:
+			if err := k.rotateIfDue(now); err != nil {
+				log.Printf("Error rotating JWT signing keys: %v", err)
+			}
+		}
+	}
+}
+
+// rotateIfDue перечитывает каталог, чтобы увидеть ключи других экземпляров сервиса,
+// создаёт новый ключ, если последний старше RotationInterval, и удаляет ключи,
+// подписанные которыми токены уже истекли
+func (k *KeySet) rotateIfDue(now time.Time) error {
+	keys, err := k.load()
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.keys = keys
+	k.mu.Unlock()
+
+	if len(keys) == 0 || (k.rotationInterval > 0 && now.Sub(keys[len(keys)-1].CreatedAt) >= k.rotationInterval) {
+		if err := k.Rotate(); err != nil {
+			return err
+		}
+	}
+
+	k.prune(now)
+	return nil
+}
+
+// prune удаляет ключи, выведенные из оборота дольше времени жизни токена
+func (k *KeySet) prune(now time.Time) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	kept := k.keys[:0]
+	for i, key := range k.keys {
+		// Ключ выводится из оборота, когда вводится следующий
+		if i+1 < len(k.keys) {
+			retiredAt := k.keys[i+1].CreatedAt.Add(k.activationDelay)
+			if now.After(retiredAt.Add(k.retention)) {
+				if err := os.Remove(k.path(key.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+					log.Printf("Error removing JWT signing key %s: %v", key.ID, err)
+				}
+				log.Printf("Removed retired JWT signing key %s", key.ID)
+				continue
+			}
+		}
+		kept = append(kept, key)
+	}
+	k.keys = kept
+}
+
+// load читает ключи из каталога. Имя файла — kid вида "<unix-время создания>-<случайный суффикс>".
+func (k *KeySet) load() ([]*SigningKey, error) {
+	entries, err := os.ReadDir(k.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keys directory: %w", err)
+	}
+
+	var keys []*SigningKey
+	for _, entry := range entries {
+		kid, ok := strings.CutSuffix(entry.Name(), ".pem")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		created, _, ok := strings.Cut(kid, "-")
+		if !ok {
+			continue
+		}
+		seconds, err := strconv.ParseInt(created, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		private, err := readPrivateKey(k.path(kid))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWT signing key %s: %w", kid, err)
+		}
+		algorithm, err := keyAlgorithm(private)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWT signing key %s: %w", kid, err)
+		}
+
+		keys = append(keys, &SigningKey{
+			ID:        kid,
+			Algorithm: algorithm,
+			CreatedAt: time.Unix(seconds, 0),
+			private:   private,
+		})
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// generate создаёт ключ настроенного алгоритма и сохраняет его в каталоге
+func (k *KeySet) generate(now time.Time) (*SigningKey, error) {
+	var private crypto.Signer
+	var err error
+	switch k.algorithm {
+	case AlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	case AlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate JWT signing key: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, fmt.Errorf("failed to generate key ID: %w", err)
+	}
+	key := &SigningKey{
+		ID:        fmt.Sprintf("%d-%s", now.Unix(), hex.EncodeToString(suffix)),
+		Algorithm: k.algorithm,
+		CreatedAt: time.Unix(now.Unix(), 0),
+		private:   private,
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode JWT signing key: %w", err)
+	}
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(k.path(key.ID), pemBytes, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save JWT signing key: %w", err)
+	}
+	return key, nil
+}
+
+// path путь к файлу ключа kid
+func (k *KeySet) path(kid string) string {
+	return filepath.Join(k.dir, kid+".pem")
+}
+
+// readPrivateKey читает закрытый ключ PKCS #8 в PEM
+func readPrivateKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+	return signer, nil
+}
+
+// keyAlgorithm определяет алгоритм подписи по типу ключа
+func keyAlgorithm(key crypto.Signer) (string, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return AlgorithmRS256, nil
+	case ed25519.PrivateKey:
+		return AlgorithmEdDSA, nil
+	}
+	return "", fmt.Errorf("unsupported key type %T", key)
+}
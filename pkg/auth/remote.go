@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"log"
+	"sync"
+	"time"
+)
+
+// Ограничения загрузки набора ключей проверяющими сервисами
+const (
+	// jwksFetchTimeout дедлайн загрузки JWKS
+	jwksFetchTimeout = 5 * time.Second
+	// jwksMinRefetchInterval не загружать JWKS из-за неизвестного kid чаще этого интервала
+	jwksMinRefetchInterval = 10 * time.Second
+)
+
+// RemoteKeySet открытые ключи, опубликованные auth-сервисом.
+// Набор кэшируется на ttl и загружается заново раньше, если токен подписан неизвестным ключом.
+type RemoteKeySet struct {
+	fetch JWKSFetcher
+	ttl   time.Duration
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+	// Время последней попытки загрузки, успешной или нет
+	attemptedAt time.Time
+}
+
+// NewRemoteKeySet создаёт набор ключей, загружаемых fetch
+func NewRemoteKeySet(fetch JWKSFetcher, ttl time.Duration) *RemoteKeySet {
+	return &RemoteKeySet{
+		fetch: fetch,
+		ttl:   ttl,
+	}
+}
+
+// PublicKey возвращает открытый ключ kid
+func (r *RemoteKeySet) PublicKey(kid string) (crypto.PublicKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[kid]
+	if ok && time.Since(r.fetchedAt) < r.ttl {
+		return key, nil
+	}
+
+	// Неизвестный kid может означать новый ключ, но ни он, ни недоступность
+	// auth-сервиса не должны вызывать загрузку на каждый токен
+	if time.Since(r.attemptedAt) >= jwksMinRefetchInterval {
+		r.attemptedAt = time.Now()
+		if err := r.refresh(); err != nil {
+			if !ok {
+				return nil, err
+			}
+			// Пока auth-сервис недоступен, продолжаем доверять уже известным ключам
+			log.Printf("Error refreshing JWKS, using cached keys: %v", err)
+			return key, nil
+		}
+		key, ok = r.keys[kid]
+	}
+
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// refresh загружает набор ключей
+func (r *RemoteKeySet) refresh() error {
+	ctx, cancel := context.WithTimeout(context.Background(), jwksFetchTimeout)
+	defer cancel()
+
+	jwks, err := r.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		key, err := jwk.PublicKey()
+		if err != nil {
+			log.Printf("Skipping JWKS key %s: %v", jwk.KeyID, err)
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+
+	r.keys = keys
+	r.fetchedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,34 @@
+package auth
+
+// Права персональных токенов доступа. Токен сессии, полученный входом, ограничений не имеет.
+const (
+	// ScopeDocumentsRead чтение документов
+	ScopeDocumentsRead = "documents:read"
+	// ScopeDocumentsWrite создание, изменение и удаление документов; включает чтение
+	ScopeDocumentsWrite = "documents:write"
+	// ScopeAdmin все операции с документами и управление персональными токенами
+	ScopeAdmin = "admin"
+)
+
+// ValidScope сообщает, существует ли право
+func ValidScope(scope string) bool {
+	switch scope {
+	case ScopeDocumentsRead, ScopeDocumentsWrite, ScopeAdmin:
+		return true
+	default:
+		return false
+	}
+}
+
+// HasScope сообщает, дают ли права scopes право required
+func HasScope(scopes []string, required string) bool {
+	for _, scope := range scopes {
+		switch {
+		case scope == required, scope == ScopeAdmin:
+			return true
+		case scope == ScopeDocumentsWrite && required == ScopeDocumentsRead:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// opaqueTokenBytes длина случайной части непрозрачных токенов
+const opaqueTokenBytes = 32
+
+// PersonalTokenPrefix начало персональных токенов доступа. По нему шлюз отличает их от JWT,
+// а сканеры секретов находят токены, случайно попавшие в код.
+const PersonalTokenPrefix = "pfat_"
+
+// personalTokenDisplayLength сколько первых символов персонального токена хранится открыто,
+// чтобы пользователь узнал токен в списке
+const personalTokenDisplayLength = 12
+
+// GenerateOpaqueToken создаёт случайный токен, например для ссылки в письме,
+// и его хеш. Хранить следует только хеш: утечка базы не даёт воспользоваться токенами.
+func GenerateOpaqueToken() (token, hash string, err error) {
+	buf := make([]byte, opaqueTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(buf)
+	return token, HashOpaqueToken(token), nil
+}
+
+// HashOpaqueToken возвращает SHA-256 хеш токена в hex. Токен случаен и достаточно длинный,
+// поэтому медленный хеш, как для паролей, не нужен.
+func HashOpaqueToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// GeneratePersonalToken создаёт персональный токен доступа, его открыто хранимое начало и хеш
+func GeneratePersonalToken() (token, displayPrefix, hash string, err error) {
+	secret, _, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	token = PersonalTokenPrefix + secret
+	return token, token[:personalTokenDisplayLength], HashOpaqueToken(token), nil
+}
+
+// IsPersonalToken сообщает, является ли токен персональным токеном доступа, а не JWT
+func IsPersonalToken(token string) bool {
+	return strings.HasPrefix(token, PersonalTokenPrefix)
+}
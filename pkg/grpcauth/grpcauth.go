@@ -0,0 +1,354 @@
+package grpcauth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/malaxitlmax/penfeel/config"
+	pkgauth "github.com/malaxitlmax/penfeel/pkg/auth"
+	"github.com/malaxitlmax/penfeel/pkg/requestmeta"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Ключи метаданных gRPC с удостоверением вызывающей стороны
+const (
+	// AuthorizationKey JWT пользователя в формате "Bearer <token>"
+	AuthorizationKey = "authorization"
+	// ServiceIdentityKey удостоверение сервиса, действующего от имени пользователя
+	ServiceIdentityKey = "x-service-identity"
+)
+
+// serviceAudience аудитория удостоверений сервисов, отличает их от токенов пользователей
+const serviceAudience = "penfeel-internal"
+
+// ErrNoIdentity в контексте нет проверенного удостоверения
+var ErrNoIdentity = errors.New("caller identity is missing")
+
+// Identity проверенное удостоверение вызывающей стороны
+type Identity struct {
+	UserID uuid.UUID
+	// Сервис, передавший удостоверение; пустой, если клиент передал JWT пользователя напрямую
+	Service string
+}
+
+type contextKey struct{}
+
+// WithIdentity сохраняет удостоверение в контексте
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// FromContext возвращает удостоверение, проверенное перехватчиком сервера
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(Identity)
+	return identity, ok
+}
+
+// UserID возвращает ID пользователя, от имени которого выполняется вызов
+func UserID(ctx context.Context) (uuid.UUID, error) {
+	identity, ok := FromContext(ctx)
+	if !ok {
+		return uuid.Nil, ErrNoIdentity
+	}
+	return identity.UserID, nil
+}
+
+// serviceClaims данные удостоверения сервиса: Issuer — сервис, Subject — пользователь
+type serviceClaims struct {
+	jwt.RegisteredClaims
+}
+
+// Signer выписывает удостоверения сервиса для исходящих вызовов
+type Signer struct {
+	service string
+	method  jwt.SigningMethod
+	key     interface{}
+	ttl     time.Duration
+}
+
+// NewSigner создаёт Signer для сервиса service. Удостоверения подписываются закрытым ключом
+// Ed25519 из cfg.PrivateKeyFile, а если он не задан — секретом cfg.Secret. mutualTLS разрешает
+// секрет по умолчанию: вызывать сервисы могут только владельцы сертификатов.
+func NewSigner(service string, cfg config.ServiceAuthConfig, mutualTLS bool) (*Signer, error) {
+	signer := &Signer{service: service, ttl: cfg.TTL}
+
+	if cfg.PrivateKeyFile != "" {
+		key, err := readPrivateKey(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer.method, signer.key = jwt.SigningMethodEdDSA, key
+		return signer, nil
+	}
+
+	if err := checkSecret(cfg.Secret, mutualTLS); err != nil {
+		return nil, err
+	}
+	signer.method, signer.key = jwt.SigningMethodHS256, []byte(cfg.Secret)
+	return signer, nil
+}
+
+// Sign выписывает удостоверение сервиса, действующего от имени пользователя userID
+func (s *Signer) Sign(userID string) (string, error) {
+	now := time.Now()
+	claims := serviceClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.service,
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{serviceAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.ttl)),
+		},
+	}
+
+	token, err := jwt.NewWithClaims(s.method, claims).SignedString(s.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign service identity: %w", err)
+	}
+	return token, nil
+}
+
+// outgoing добавляет удостоверение пользователя из requestmeta к исходящим метаданным.
+// Вызовы без пользователя отправляются без удостоверения и отклоняются сервером.
+func (s *Signer) outgoing(ctx context.Context) (context.Context, error) {
+	userID := requestmeta.UserID(ctx)
+	if userID == "" {
+		return ctx, nil
+	}
+
+	token, err := s.Sign(userID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return metadata.AppendToOutgoingContext(ctx, ServiceIdentityKey, token), nil
+}
+
+// UnaryClientInterceptor подписывает унарные вызовы удостоверением сервиса
+func (s *Signer) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, err := s.outgoing(ctx)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor подписывает потоковые вызовы удостоверением сервиса
+func (s *Signer) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := s.outgoing(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// TokenValidator проверяет JWT пользователя
+type TokenValidator interface {
+	ValidateToken(token string) (*pkgauth.Claims, error)
+}
+
+// RevocationList отозванные сессии пользователей
+type RevocationList interface {
+	// Fresh сообщает, что список достаточно свежий, чтобы ему доверять
+	Fresh() bool
+	Revoked(sessionID string) bool
+}
+
+// Verifier проверяет удостоверение во входящих вызовах
+type Verifier struct {
+	method      jwt.SigningMethod
+	key         interface{}
+	tokens      TokenValidator
+	revocations RevocationList
+}
+
+// NewVerifier создаёт Verifier. Удостоверения сервисов проверяются открытым ключом Ed25519
+// из cfg.PublicKeyFile, а если он не задан — секретом cfg.Secret, с теми же ограничениями, что в NewSigner.
+// tokens проверяет JWT пользователей, переданные напрямую, revocations — не отозвана ли их сессия.
+func NewVerifier(cfg config.ServiceAuthConfig, mutualTLS bool, tokens TokenValidator, revocations RevocationList) (*Verifier, error) {
+	verifier := &Verifier{tokens: tokens, revocations: revocations}
+
+	if cfg.PublicKeyFile != "" {
+		key, err := readPublicKey(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		verifier.method, verifier.key = jwt.SigningMethodEdDSA, key
+		return verifier, nil
+	}
+
+	if err := checkSecret(cfg.Secret, mutualTLS); err != nil {
+		return nil, err
+	}
+	verifier.method, verifier.key = jwt.SigningMethodHS256, []byte(cfg.Secret)
+	return verifier, nil
+}
+
+// Verify проверяет удостоверение из входящих метаданных
+func (v *Verifier) Verify(ctx context.Context) (Identity, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if values := md.Get(ServiceIdentityKey); len(values) > 0 {
+		return v.verifyService(values[0])
+	}
+	if values := md.Get(AuthorizationKey); len(values) > 0 {
+		return v.verifyUser(values[0])
+	}
+	return Identity{}, status.Error(codes.Unauthenticated, "missing caller identity")
+}
+
+// verifyService проверяет удостоверение сервиса
+func (v *Verifier) verifyService(token string) (Identity, error) {
+	claims := &serviceClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return v.key, nil
+	},
+		jwt.WithValidMethods([]string{v.method.Alg()}),
+		jwt.WithAudience(serviceAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return Identity{}, status.Errorf(codes.Unauthenticated, "invalid service identity: %v", err)
+	}
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return Identity{}, status.Error(codes.Unauthenticated, "invalid service identity: subject is not a user ID")
+	}
+	return Identity{UserID: userID, Service: claims.Issuer}, nil
+}
+
+// verifyUser проверяет JWT пользователя
+func (v *Verifier) verifyUser(header string) (Identity, error) {
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || v.tokens == nil {
+		return Identity{}, status.Error(codes.Unauthenticated, "invalid authorization metadata")
+	}
+
+	claims, err := v.tokens.ValidateToken(token)
+	if err != nil {
+		return Identity{}, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	// Токен завершённой сессии остаётся подписанным до истечения, поэтому сессия сверяется
+	// со списком отозванных; без актуального списка токен не принимается
+	if v.revocations == nil || !v.revocations.Fresh() {
+		return Identity{}, status.Error(codes.Unavailable, "revoked sessions are not loaded, try again later")
+	}
+	if v.revocations.Revoked(claims.ID) {
+		return Identity{}, status.Error(codes.Unauthenticated, "session has been revoked")
+	}
+
+	userID, err := uuid.Parse(claims.UserID)
+	if err != nil {
+		return Identity{}, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	return Identity{UserID: userID}, nil
+}
+
+// checkSecret отклоняет пустой секрет и, без mutual TLS, секрет по умолчанию:
+// с ним удостоверение любого пользователя может подписать кто угодно
+func checkSecret(secret string, mutualTLS bool) error {
+	switch {
+	case secret == "":
+		return errors.New("service identity secret is empty and no identity key is configured")
+	case secret == config.DefaultServiceIdentitySecret && !mutualTLS:
+		return errors.New("service identity secret is the public default: set SERVICE_IDENTITY_SECRET, identity key files or require mutual TLS")
+	}
+	return nil
+}
+
+// readPrivateKey читает закрытый ключ Ed25519 в PEM (PKCS #8)
+func readPrivateKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service identity key %s: %w", path, err)
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("service identity key %s is not an Ed25519 key", path)
+	}
+	return private, nil
+}
+
+// readPublicKey читает открытый ключ Ed25519 в PEM (PKIX)
+func readPublicKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service identity public key %s: %w", path, err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("service identity public key %s is not an Ed25519 key", path)
+	}
+	return public, nil
+}
+
+// readPEM читает первый блок PEM из файла
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+	return block, nil
+}
+
+// UnaryServerInterceptor отклоняет унарные вызовы без действительного удостоверения
+func (v *Verifier) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		identity, err := v.Verify(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(WithIdentity(ctx, identity), req)
+	}
+}
+
+// StreamServerInterceptor отклоняет потоковые вызовы без действительного удостоверения
+func (v *Verifier) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		identity, err := v.Verify(stream.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: stream, ctx: WithIdentity(stream.Context(), identity)})
+	}
+}
+
+// serverStream поток с контекстом, содержащим удостоверение
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context возвращает контекст потока
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,234 @@
+package grpctls
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/malaxitlmax/penfeel/config"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/peer"
+)
+
+// Credentials сертификаты сервиса для gRPC соединений.
+// Файлы сертификата, ключа и CA перечитываются при изменении, новые соединения
+// используют обновлённые сертификаты без перезапуска сервиса.
+type Credentials struct {
+	cfg config.TLSConfig
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	pool *x509.CertPool
+	// Время изменения файлов при последней попытке загрузки
+	modTimes map[string]time.Time
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewCredentials загружает сертификаты и запускает проверку изменений файлов.
+// При выключенном TLS возвращает Credentials без шифрования.
+func NewCredentials(cfg config.TLSConfig) (*Credentials, error) {
+	c := &Credentials{
+		cfg:  cfg,
+		stop: make(chan struct{}),
+	}
+	if !cfg.Enabled {
+		return c, nil
+	}
+
+	if cfg.CertFile == "" || cfg.KeyFile == "" || cfg.CAFile == "" {
+		return nil, errors.New("TLS certificate, key and CA files are required")
+	}
+
+	c.modTimes = c.fileModTimes()
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	if cfg.ReloadInterval > 0 {
+		go c.watch()
+	}
+	return c, nil
+}
+
+// Close останавливает проверку изменений файлов
+func (c *Credentials) Close() {
+	c.closeOnce.Do(func() {
+		close(c.stop)
+	})
+}
+
+// ServerCredentials учётные данные gRPC сервера.
+// Клиент без сертификата, подписанного CA, отклоняется, если включён RequireClientCert.
+func (c *Credentials) ServerCredentials() credentials.TransportCredentials {
+	if !c.cfg.Enabled {
+		return insecure.NewCredentials()
+	}
+
+	clientAuth := tls.VerifyClientCertIfGiven
+	if c.cfg.RequireClientCert {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// Конфигурация собирается на каждое соединение, чтобы подхватить перезагруженные файлы
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := c.current()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    pool,
+				ClientAuth:   clientAuth,
+				NextProtos:   []string{"h2"},
+			}, nil
+		},
+	})
+}
+
+// ClientCredentials учётные данные для вызовов других сервисов.
+// Имя сервера берётся из адреса соединения и проверяется по сертификату сервера.
+func (c *Credentials) ClientCredentials() credentials.TransportCredentials {
+	if !c.cfg.Enabled {
+		return insecure.NewCredentials()
+	}
+
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := c.current()
+			return cert, nil
+		},
+		// Стандартная проверка использует неизменяемый RootCAs, поэтому сертификат
+		// сервера проверяется в VerifyConnection по текущему CA
+		InsecureSkipVerify: true,
+		VerifyConnection:   c.verifyServer,
+	})
+}
+
+// PeerName возвращает CommonName сертификата клиента вызова. ok ложно, если клиент
+// подключился без TLS или без сертификата, подписанного CA.
+func PeerName(ctx context.Context) (name string, ok bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	return info.State.VerifiedChains[0][0].Subject.CommonName, true
+}
+
+// verifyServer проверяет цепочку сертификата сервера и его имя по текущему CA
+func (c *Credentials) verifyServer(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server did not present a certificate")
+	}
+
+	_, pool := c.current()
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		DNSName:       state.ServerName,
+		Roots:         pool,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to verify server certificate: %w", err)
+	}
+	return nil
+}
+
+// current возвращает действующие сертификат и CA
+func (c *Credentials) current() (*tls.Certificate, *x509.CertPool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, c.pool
+}
+
+// load читает сертификат, ключ и CA. При ошибке остаются прежние сертификаты.
+func (c *Credentials) load() error {
+	cert, err := tls.LoadX509KeyPair(c.cfg.CertFile, c.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	caPEM, err := os.ReadFile(c.cfg.CAFile)
+	if err != nil {
+		return fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no certificates found in %s", c.cfg.CAFile)
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.pool = pool
+	c.mu.Unlock()
+	return nil
+}
+
+// watch перезагружает сертификаты, когда меняется любой из файлов.
+// Неудачная загрузка, например при записи сертификата без нового ключа,
+// повторяется при следующем изменении файлов.
+func (c *Credentials) watch() {
+	ticker := time.NewTicker(c.cfg.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			modTimes := c.fileModTimes()
+			if sameModTimes(modTimes, c.modTimes) {
+				continue
+			}
+			c.modTimes = modTimes
+
+			if err := c.load(); err != nil {
+				log.Printf("Failed to reload TLS certificates, keeping the previous ones: %v", err)
+				continue
+			}
+			log.Printf("Reloaded TLS certificates from %s", c.cfg.CertFile)
+		}
+	}
+}
+
+// fileModTimes возвращает время изменения файлов сертификатов; недоступные файлы пропускаются
+func (c *Credentials) fileModTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time, 3)
+	for _, path := range []string{c.cfg.CertFile, c.cfg.KeyFile, c.cfg.CAFile} {
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// sameModTimes сравнивает время изменения файлов
+func sameModTimes(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, modTime := range a {
+		if !modTime.Equal(b[path]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer сохраняет письма в каталог по файлу .eml на письмо, вместо отправки.
+// Письма можно открыть почтовым клиентом или прочитать в тестах.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer создаёт сохранение писем в каталог dir
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &FileMailer{
+		dir:  dir,
+		from: from,
+	}, nil
+}
+
+// Send сохраняет письмо в файл "<время>-<случайный суффикс>.eml"
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	data, err := format(m.from, msg, now)
+	if err != nil {
+		return fmt.Errorf("failed to format message: %w", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("failed to generate file name: %w", err)
+	}
+	path := filepath.Join(m.dir, fmt.Sprintf("%d-%s.eml", now.UnixNano(), hex.EncodeToString(suffix)))
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save message: %w", err)
+	}
+
+	log.Printf("Saved email %q to %s in %s", msg.Subject, msg.To, path)
+	return nil
+}
+
+// LogMailer выводит письма в лог вместо отправки. Письма содержат ссылки с
+// одноразовыми токенами, поэтому он подходит только для локальной разработки.
+type LogMailer struct {
+	from string
+}
+
+// NewLogMailer создаёт вывод писем в лог
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{
+		from: from,
+	}
+}
+
+// Send выводит письмо в лог
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	log.Printf("Email from %s to %s\nSubject: %s\n\n%s", m.from, msg.To, msg.Subject, msg.Body)
+	return nil
+}
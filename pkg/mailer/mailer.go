@@ -0,0 +1,69 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"time"
+
+	"github.com/malaxitlmax/penfeel/config"
+)
+
+// Способы отправки писем
+const (
+	// DriverSMTP письма отправляются через SMTP сервер
+	DriverSMTP = "smtp"
+	// DriverFile письма сохраняются в каталог, для локальной разработки и тестов
+	DriverFile = "file"
+	// DriverLog письма выводятся в лог
+	DriverLog = "log"
+)
+
+// Message письмо пользователю
+type Message struct {
+	To      string
+	Subject string
+	// Текст письма без разметки
+	Body string
+}
+
+// Mailer отправляет письма пользователям
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New создаёт Mailer по способу отправки cfg.Driver
+func New(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver {
+	case DriverSMTP:
+		return NewSMTPMailer(cfg), nil
+	case DriverFile:
+		return NewFileMailer(cfg.Dir, cfg.From)
+	case DriverLog:
+		return NewLogMailer(cfg.From), nil
+	}
+	return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+}
+
+// format собирает письмо в формате RFC 5322 с текстом в quoted-printable
+func format(from string, msg Message, now time.Time) ([]byte, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+
+	w := quotedprintable.NewWriter(&buf)
+	if _, err := w.Write([]byte(msg.Body)); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
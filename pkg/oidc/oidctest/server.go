@@ -0,0 +1,290 @@
+// Package oidctest локальный провайдер OpenID Connect для разработки и проверки входа
+// через внешних провайдеров без обращения к реальным сервисам.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	pkgauth "github.com/malaxitlmax/penfeel/pkg/auth"
+	"github.com/malaxitlmax/penfeel/pkg/oidc"
+)
+
+const (
+	// keyID kid ключа, которым подписываются ID токены
+	keyID = "oidctest"
+	// codeTTL сколько действует код авторизации
+	codeTTL = time.Minute
+	// idTokenTTL сколько действует ID токен
+	idTokenTTL = 5 * time.Minute
+)
+
+// User пользователь, от имени которого провайдер выдаёт ID токены
+type User struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// authorization выданный код авторизации
+type authorization struct {
+	user          User
+	redirectURI   string
+	nonce         string
+	codeChallenge string
+	expiresAt     time.Time
+}
+
+// Server провайдер OpenID Connect с единственным клиентом. Страница входа не показывается:
+// /authorize сразу возвращает пользователя на redirect_uri с кодом для текущего User.
+type Server struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	key          *rsa.PrivateKey
+	mux          *http.ServeMux
+
+	mu    sync.Mutex
+	user  User
+	codes map[string]authorization
+}
+
+// NewServer создаёт провайдера с адресом issuer и клиентом clientID. Пустой clientSecret — публичный клиент,
+// который подтверждает код только верификатором PKCE.
+func NewServer(issuer, clientID, clientSecret string) (*Server, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	s := &Server{
+		issuer:       issuer,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		key:          key,
+		mux:          http.NewServeMux(),
+		user: User{
+			Subject:           "oidctest-user",
+			Email:             "user@example.com",
+			EmailVerified:     true,
+			Name:              "Test User",
+			PreferredUsername: "testuser",
+		},
+		codes: make(map[string]authorization),
+	}
+	s.mux.HandleFunc("GET /.well-known/openid-configuration", s.handleDiscovery)
+	s.mux.HandleFunc("GET /authorize", s.handleAuthorize)
+	s.mux.HandleFunc("POST /token", s.handleToken)
+	s.mux.HandleFunc("GET /jwks", s.handleJWKS)
+	return s, nil
+}
+
+// Start запускает провайдера на локальном адресе. Issuer — адрес запущенного сервера.
+func Start(clientID, clientSecret string) (*Server, *httptest.Server, error) {
+	httpServer := httptest.NewUnstartedServer(nil)
+	s, err := NewServer("http://"+httpServer.Listener.Addr().String(), clientID, clientSecret)
+	if err != nil {
+		httpServer.Close()
+		return nil, nil, err
+	}
+	httpServer.Config.Handler = s
+	httpServer.Start()
+	return s, httpServer, nil
+}
+
+// Issuer адрес провайдера
+func (s *Server) Issuer() string {
+	return s.issuer
+}
+
+// SetUser задаёт пользователя, который войдёт при следующем обращении к /authorize
+func (s *Server) SetUser(user User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user = user
+}
+
+// ServeHTTP обрабатывает запросы к провайдеру
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// handleDiscovery возвращает документ discovery
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.issuer,
+		"authorization_endpoint":                s.issuer + "/authorize",
+		"token_endpoint":                        s.issuer + "/token",
+		"jwks_uri":                              s.issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+	})
+}
+
+// handleAuthorize выдаёт код авторизации текущему пользователю и перенаправляет на redirect_uri
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	// Ошибки после проверки redirect_uri возвращаются клиенту через перенаправление
+	params := url.Values{"state": {query.Get("state")}}
+	switch {
+	case query.Get("client_id") != s.clientID:
+		params.Set("error", "unauthorized_client")
+	case query.Get("response_type") != "code":
+		params.Set("error", "unsupported_response_type")
+	case query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256":
+		params.Set("error", "invalid_request")
+		params.Set("error_description", "PKCE with S256 is required")
+	default:
+		code, _, err := pkgauth.GenerateOpaqueToken()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.mu.Lock()
+		s.codes[code] = authorization{
+			user:          s.user,
+			redirectURI:   query.Get("redirect_uri"),
+			nonce:         query.Get("nonce"),
+			codeChallenge: query.Get("code_challenge"),
+			expiresAt:     time.Now().Add(codeTTL),
+		}
+		s.mu.Unlock()
+		params.Set("code", code)
+	}
+
+	values := redirectURI.Query()
+	for key, value := range params {
+		values[key] = value
+	}
+	redirectURI.RawQuery = values.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// handleToken обменивает код авторизации на ID токен
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+
+	clientID, clientSecret, basic := r.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != s.clientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(s.clientSecret)) != 1 {
+		tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	// Код одноразовый: удаляется и при неудачном обмене
+	code := r.PostForm.Get("code")
+	s.mu.Lock()
+	auth, ok := s.codes[code]
+	delete(s.codes, code)
+	s.mu.Unlock()
+
+	switch {
+	case !ok, time.Now().After(auth.expiresAt),
+		r.PostForm.Get("redirect_uri") != auth.redirectURI,
+		oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != auth.codeChallenge:
+		tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	idToken, err := s.signIDToken(auth)
+	if err != nil {
+		log.Printf("Error signing ID token: %v", err)
+		tokenError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	accessToken, _, err := pkgauth.GenerateOpaqueToken()
+	if err != nil {
+		log.Printf("Error generating access token: %v", err)
+		tokenError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(idTokenTTL.Seconds()),
+		"id_token":     idToken,
+	})
+}
+
+// handleJWKS публикует открытый ключ подписи ID токенов
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	jwk, err := pkgauth.NewJWK(keyID, &s.key.PublicKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, pkgauth.JWKS{Keys: []pkgauth.JWK{jwk}})
+}
+
+// signIDToken выпускает ID токен пользователя кода авторизации
+func (s *Server) signIDToken(auth authorization) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":                s.issuer,
+		"sub":                auth.user.Subject,
+		"aud":                s.clientID,
+		"iat":                now.Unix(),
+		"exp":                now.Add(idTokenTTL).Unix(),
+		"email":              auth.user.Email,
+		"email_verified":     auth.user.EmailVerified,
+		"name":               auth.user.Name,
+		"preferred_username": auth.user.PreferredUsername,
+	}
+	if auth.nonce != "" {
+		claims["nonce"] = auth.nonce
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	return token.SignedString(s.key)
+}
+
+// tokenError отвечает ошибкой token endpoint (RFC 6749, раздел 5.2)
+func tokenError(w http.ResponseWriter, status int, code string) {
+	writeJSON(w, status, map[string]string{"error": code})
+}
+
+// writeJSON отвечает документом JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
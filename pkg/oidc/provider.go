@@ -0,0 +1,349 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/malaxitlmax/penfeel/config"
+	pkgauth "github.com/malaxitlmax/penfeel/pkg/auth"
+)
+
+const (
+	// keysCacheTTL как долго кэшировать ключи провайдера; ID токен с неизвестным ключом вызывает повторную загрузку
+	keysCacheTTL = time.Hour
+	// clockSkew допустимое расхождение часов с провайдером при проверке сроков ID токена
+	clockSkew = time.Minute
+	// maxResponseSize наибольший размер ответа провайдера
+	maxResponseSize = 1 << 20
+)
+
+// signingAlgorithms алгоритмы подписи ID токенов, которые принимаются от провайдеров.
+// HS256 не принимается: его ключ — секрет клиента, известный не только провайдеру.
+var signingAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "ES256", "ES384", "EdDSA"}
+
+// ErrInvalidIDToken ID токен не прошёл проверку
+var ErrInvalidIDToken = errors.New("invalid ID token")
+
+// Metadata параметры провайдера из документа discovery (OpenID Connect Discovery 1.0)
+type Metadata struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// IDToken проверенные данные пользователя из ID токена
+type IDToken struct {
+	// Постоянный идентификатор пользователя у провайдера
+	Subject string
+	Email   string
+	// Провайдер подтвердил, что пользователь владеет Email
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// idTokenClaims содержимое ID токена
+type idTokenClaims struct {
+	jwt.RegisteredClaims
+	Nonce             string       `json:"nonce"`
+	AuthorizedParty   string       `json:"azp"`
+	Email             string       `json:"email"`
+	EmailVerified     flexibleBool `json:"email_verified"`
+	Name              string       `json:"name"`
+	PreferredUsername string       `json:"preferred_username"`
+}
+
+// flexibleBool логическое значение, которое некоторые провайдеры передают строкой "true"
+type flexibleBool bool
+
+// UnmarshalJSON принимает true, false, "true" и "false"
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	switch string(data) {
+	case "true", `"true"`:
+		*b = true
+	case "false", `"false"`, "null":
+		*b = false
+	default:
+		return fmt.Errorf("invalid boolean %s", data)
+	}
+	return nil
+}
+
+// Provider внешний провайдер OpenID Connect. Параметры провайдера загружаются
+// из документа discovery при первом обращении и кэшируются.
+type Provider struct {
+	config      config.OIDCProviderConfig
+	redirectURL string
+	client      *http.Client
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     *pkgauth.RemoteKeySet
+}
+
+// NewProvider создаёт провайдера, который возвращает пользователя на redirectURL.
+// Запросы к провайдеру выполняются с дедлайном timeout.
+func NewProvider(cfg config.OIDCProviderConfig, redirectURL string, timeout time.Duration) (*Provider, error) {
+	if cfg.ID == "" || cfg.Issuer == "" || cfg.ClientID == "" {
+		return nil, fmt.Errorf("OIDC provider %q: issuer and client ID are required", cfg.ID)
+	}
+
+	// Без openid провайдер не выдаст ID токен
+	hasOpenID := false
+	for _, scope := range cfg.Scopes {
+		hasOpenID = hasOpenID || scope == "openid"
+	}
+	if !hasOpenID {
+		cfg.Scopes = append([]string{"openid"}, cfg.Scopes...)
+	}
+
+	return &Provider{
+		config:      cfg,
+		redirectURL: redirectURL,
+		client:      &http.Client{Timeout: timeout},
+	}, nil
+}
+
+// NewProviders создаёт всех провайдеров из конфигурации
+func NewProviders(cfg config.OIDCConfig) ([]*Provider, error) {
+	providers := make([]*Provider, 0, len(cfg.Providers))
+	for _, providerConfig := range cfg.Providers {
+		provider, err := NewProvider(providerConfig, cfg.RedirectURL, cfg.HTTPTimeout)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+// ID идентификатор провайдера в адресах API
+func (p *Provider) ID() string {
+	return p.config.ID
+}
+
+// Name название провайдера для кнопки входа
+func (p *Provider) Name() string {
+	return p.config.Name
+}
+
+// AuthCodeURL возвращает адрес страницы входа провайдера для authorization code flow с PKCE.
+// state и nonce должны быть случайными и сохраняться до возврата пользователя, codeChallenge — CodeChallenge(verifier).
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.redirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {codeChallenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return metadata.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+// tokenResponse ответ token endpoint (RFC 6749, раздел 5)
+type tokenResponse struct {
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Exchange обменивает код авторизации на ID токен. codeVerifier — верификатор PKCE,
+// из которого был получен code_challenge в AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"code_verifier": {codeVerifier},
+	}
+
+	// По умолчанию провайдеры ожидают секрет в заголовке Authorization (client_secret_basic)
+	secretInForm := p.config.ClientSecret != "" && !supports(metadata.TokenEndpointAuthMethodsSupported, "client_secret_basic")
+	if p.config.ClientSecret == "" || secretInForm {
+		form.Set("client_id", p.config.ClientID)
+	}
+	if secretInForm {
+		form.Set("client_secret", p.config.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" && !secretInForm {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	defer res.Body.Close()
+
+	var token tokenResponse
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(&token); err != nil {
+		return "", fmt.Errorf("failed to exchange authorization code: unexpected response with status %s", res.Status)
+	}
+	if res.StatusCode != http.StatusOK || token.Error != "" {
+		return "", fmt.Errorf("failed to exchange authorization code: %s %s", token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return "", errors.New("failed to exchange authorization code: no ID token in response")
+	}
+	return token.IDToken, nil
+}
+
+// VerifyIDToken проверяет подпись ID токена по ключам провайдера, его issuer, audience,
+// срок действия и nonce, отправленный в AuthCodeURL
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (*IDToken, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(signingAlgorithms),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(p.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+
+	var claims idTokenClaims
+	_, err = parser.ParseWithClaims(rawIDToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.PublicKey(kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidIDToken, err)
+	}
+
+	switch {
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	// Токен, выданный нескольким клиентам, должен быть выдан для нас
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID,
+		claims.AuthorizedParty != "" && claims.AuthorizedParty != p.config.ClientID:
+		return nil, fmt.Errorf("%w: token was issued to another client", ErrInvalidIDToken)
+	}
+
+	return &IDToken{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     bool(claims.EmailVerified),
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+// discover загружает параметры провайдера. Успешный результат кэшируется, после ошибки
+// загрузка повторяется при следующем обращении.
+func (p *Provider) discover(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var metadata Metadata
+	discoveryURL := strings.TrimSuffix(p.config.Issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, discoveryURL, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider %s: %w", p.config.ID, err)
+	}
+
+	// Иначе провайдер по чужому адресу мог бы выдавать токены от имени другого issuer
+	if metadata.Issuer != p.config.Issuer {
+		return nil, fmt.Errorf("failed to discover OIDC provider %s: issuer %q does not match %q", p.config.ID, metadata.Issuer, p.config.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("failed to discover OIDC provider %s: incomplete provider metadata", p.config.ID)
+	}
+
+	jwksURI := metadata.JWKSURI
+	p.keys = pkgauth.NewRemoteKeySet(func(ctx context.Context) (*pkgauth.JWKS, error) {
+		var keys pkgauth.JWKS
+		if err := p.getJSON(ctx, jwksURI, &keys); err != nil {
+			return nil, fmt.Errorf("failed to fetch JWKS of OIDC provider %s: %w", p.config.ID, err)
+		}
+		return &keys, nil
+	}, keysCacheTTL)
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// getJSON загружает документ JSON провайдера
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return json.NewDecoder(io.LimitReader(res.Body, maxResponseSize)).Decode(v)
+}
+
+// supports сообщает, поддерживает ли провайдер метод. Пустой список означает значения по умолчанию из спецификации.
+func supports(methods []string, method string) bool {
+	if len(methods) == 0 {
+		return method == "client_secret_basic"
+	}
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// CodeChallenge возвращает code_challenge PKCE для верификатора методом S256 (RFC 7636)
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
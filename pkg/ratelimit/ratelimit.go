@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// idleTTL время, после которого неиспользуемый лимитер ключа удаляется
+const idleTTL = 10 * time.Minute
+
+// entry лимитер ключа и время его последнего использования
+type entry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// KeyedLimiter набор token-bucket лимитеров по ключам (пользователь, IP, соединение)
+type KeyedLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu        sync.Mutex
+	limiters  map[string]*entry
+	lastSweep time.Time
+}
+
+// NewKeyedLimiter создает лимитер, пропускающий perSecond событий в секунду с запасом burst на ключ.
+// Неположительный perSecond отключает ограничение.
+func NewKeyedLimiter(perSecond float64, burst int) *KeyedLimiter {
+	limit := rate.Limit(perSecond)
+	if perSecond <= 0 {
+		limit = rate.Inf
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &KeyedLimiter{
+		limit:     limit,
+		burst:     burst,
+		limiters:  make(map[string]*entry),
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow расходует токен ключа. Если токенов нет, возвращает время до появления следующего.
+func (l *KeyedLimiter) Allow(key string) (bool, time.Duration) {
+	now := time.Now()
+
+	l.mu.Lock()
+	if now.Sub(l.lastSweep) > idleTTL {
+		l.sweep(now)
+	}
+	e, exists := l.limiters[key]
+	if !exists {
+		e = &entry{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[key] = e
+	}
+	e.lastSeen = now
+	l.mu.Unlock()
+
+	return allow(e.limiter, now)
+}
+
+// sweep удаляет лимитеры неактивных ключей. Вызывается под мьютексом.
+func (l *KeyedLimiter) sweep(now time.Time) {
+	for key, e := range l.limiters {
+		if now.Sub(e.lastSeen) > idleTTL {
+			delete(l.limiters, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// Limiter token-bucket лимитер одного ключа, например одного WebSocket соединения
+type Limiter struct {
+	limiter *rate.Limiter
+}
+
+// NewLimiter создает лимитер, пропускающий perSecond событий в секунду с запасом burst.
+// Неположительный perSecond отключает ограничение.
+func NewLimiter(perSecond float64, burst int) *Limiter {
+	limit := rate.Limit(perSecond)
+	if perSecond <= 0 {
+		limit = rate.Inf
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &Limiter{limiter: rate.NewLimiter(limit, burst)}
+}
+
+// Allow расходует токен. Если токенов нет, возвращает время до появления следующего.
+func (l *Limiter) Allow() (bool, time.Duration) {
+	return allow(l.limiter, time.Now())
+}
+
+// allow резервирует токен и отменяет резервирование, если его пришлось бы ждать
+func allow(limiter *rate.Limiter, now time.Time) (bool, time.Duration) {
+	reservation := limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		return false, time.Second
+	}
+
+	delay := reservation.DelayFrom(now)
+	if delay == 0 {
+		return true, 0
+	}
+
+	reservation.CancelAt(now)
+	return false, delay
+}
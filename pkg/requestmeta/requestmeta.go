@@ -0,0 +1,155 @@
+package requestmeta
+
+import (
+	"context"
+	"log"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Ключи метаданных gRPC с данными запроса
+const (
+	// RequestIDKey ID запроса
+	RequestIDKey = "x-request-id"
+	// ClientIPKey IP адрес клиента шлюза
+	ClientIPKey = "x-client-ip"
+	// UserAgentKey User-Agent клиента шлюза; заголовок user-agent занят самим gRPC
+	UserAgentKey = "x-client-user-agent"
+)
+
+type contextKey int
+
+const (
+	requestIDContextKey contextKey = iota
+	userIDContextKey
+	clientIPContextKey
+	userAgentContextKey
+)
+
+// WithRequestID сохраняет ID запроса в контексте
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, requestID)
+}
+
+// RequestID возвращает ID запроса из контекста
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey).(string)
+	return requestID
+}
+
+// WithUserID сохраняет ID пользователя, от имени которого выполняется запрос.
+// Сервисам пользователь передаётся подписанным удостоверением, см. пакет grpcauth.
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDContextKey, userID)
+}
+
+// UserID возвращает ID пользователя из контекста
+func UserID(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDContextKey).(string)
+	return userID
+}
+
+// WithClient сохраняет IP адрес и User-Agent клиента
+func WithClient(ctx context.Context, clientIP, userAgent string) context.Context {
+	ctx = context.WithValue(ctx, clientIPContextKey, clientIP)
+	return context.WithValue(ctx, userAgentContextKey, userAgent)
+}
+
+// ClientIP возвращает IP адрес клиента из контекста
+func ClientIP(ctx context.Context) string {
+	clientIP, _ := ctx.Value(clientIPContextKey).(string)
+	return clientIP
+}
+
+// UserAgent возвращает User-Agent клиента из контекста
+func UserAgent(ctx context.Context) string {
+	userAgent, _ := ctx.Value(userAgentContextKey).(string)
+	return userAgent
+}
+
+// outgoing добавляет ID запроса и данные клиента к исходящим метаданным gRPC
+func outgoing(ctx context.Context) context.Context {
+	var pairs []string
+	if requestID := RequestID(ctx); requestID != "" {
+		pairs = append(pairs, RequestIDKey, requestID)
+	}
+	if clientIP := ClientIP(ctx); clientIP != "" {
+		pairs = append(pairs, ClientIPKey, clientIP)
+	}
+	if userAgent := UserAgent(ctx); userAgent != "" {
+		pairs = append(pairs, UserAgentKey, userAgent)
+	}
+	if len(pairs) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, pairs...)
+}
+
+// incoming переносит ID запроса и данные клиента из входящих метаданных gRPC в контекст
+func incoming(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	if values := md.Get(RequestIDKey); len(values) > 0 {
+		ctx = WithRequestID(ctx, values[0])
+	}
+	if clientIP, userAgent := first(md, ClientIPKey), first(md, UserAgentKey); clientIP != "" || userAgent != "" {
+		ctx = WithClient(ctx, clientIP, userAgent)
+	}
+	return ctx
+}
+
+// first возвращает первое значение ключа метаданных
+func first(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// UnaryClientInterceptor передаёт ID запроса и данные клиента в унарные вызовы
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(outgoing(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor передаёт ID запроса и данные клиента в потоковые вызовы
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(outgoing(ctx), desc, cc, method, opts...)
+	}
+}
+
+// UnaryServerInterceptor сохраняет ID запроса из метаданных в контексте обработчика
+// и записывает в лог неудачные вызовы с ID запроса
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx = incoming(ctx)
+		resp, err := handler(ctx, req)
+		if err != nil {
+			log.Printf("%s failed (request %s): %v", info.FullMethod, RequestID(ctx), err)
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor сохраняет ID запроса из метаданных в контексте потока
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: stream, ctx: incoming(stream.Context())})
+	}
+}
+
+// serverStream поток с контекстом, дополненным метаданными запроса
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context возвращает контекст потока
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
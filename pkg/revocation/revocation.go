@@ -0,0 +1,150 @@
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	pb "github.com/malaxitlmax/penfeel/api/proto"
+	"github.com/malaxitlmax/penfeel/config"
+)
+
+// syncOverlap сессии, отозванные незадолго до последней загруженной, запрашиваются повторно:
+// транзакция отзыва могла быть зафиксирована уже после предыдущей синхронизации
+const syncOverlap = 5 * time.Second
+
+// List отозванные сессии, которые периодически загружаются из auth-сервиса.
+// Позволяет проверять access токены без вызова auth-сервиса на каждый запрос.
+type List struct {
+	authClient pb.AuthServiceClient
+	cfg        config.TokenVerificationConfig
+	timeout    time.Duration
+
+	mu sync.Mutex
+	// Отозванные сессии и время, после которого их токены истекли
+	revoked map[string]time.Time
+	// Время отзыва последней загруженной сессии по часам auth-сервиса
+	revokedAfter time.Time
+	// Время последней успешной синхронизации
+	syncedAt time.Time
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewList создаёт список и запускает синхронизацию каждые cfg.RevocationSyncInterval;
+// timeout ограничивает каждый вызов auth-сервиса
+func NewList(authClient pb.AuthServiceClient, cfg config.TokenVerificationConfig, timeout time.Duration) *List {
+	l := &List{
+		authClient: authClient,
+		cfg:        cfg,
+		timeout:    timeout,
+		revoked:    make(map[string]time.Time),
+		stop:       make(chan struct{}),
+	}
+	if cfg.RevocationSyncInterval > 0 {
+		go l.run()
+	}
+	return l
+}
+
+// Close останавливает синхронизацию
+func (l *List) Close() {
+	l.closeOnce.Do(func() {
+		close(l.stop)
+	})
+}
+
+// Revoked сообщает, отозвана ли сессия
+func (l *List) Revoked(sessionID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, revoked := l.revoked[sessionID]
+	return revoked
+}
+
+// Fresh сообщает, что список обновлялся не дольше RevocationMaxStaleness назад
+func (l *List) Fresh() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return !l.syncedAt.IsZero() && time.Since(l.syncedAt) <= l.cfg.RevocationMaxStaleness
+}
+
+// run периодически загружает отозванные сессии
+func (l *List) run() {
+	ticker := time.NewTicker(l.cfg.RevocationSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := l.sync(); err != nil {
+			log.Printf("Error syncing revoked sessions: %v", err)
+		}
+
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sync загружает сессии, отозванные после предыдущей синхронизации,
+// и забывает сессии, токены которых уже истекли
+func (l *List) sync() error {
+	ctx := context.Background()
+	if l.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, l.timeout)
+		defer cancel()
+	}
+
+	l.mu.Lock()
+	revokedAfter := l.revokedAfter
+	l.mu.Unlock()
+
+	req := &pb.ListRevokedSessionsRequest{}
+	if !revokedAfter.IsZero() {
+		req.RevokedAfter = revokedAfter.Add(-syncOverlap).Format(time.RFC3339Nano)
+	}
+
+	// Отсчёт свежести ведётся от начала запроса: сессии, отозванные во время него, придут в следующий раз
+	startedAt := time.Now()
+	res, err := l.authClient.ListRevokedSessions(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to list revoked sessions: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for id, expiresAt := range l.revoked {
+		if startedAt.After(expiresAt) {
+			delete(l.revoked, id)
+		}
+	}
+
+	for _, session := range res.Sessions {
+		revokedAt, err := time.Parse(time.RFC3339Nano, session.RevokedAt)
+		if err != nil {
+			log.Printf("Skipping revoked session %s: %v", session.Id, err)
+			continue
+		}
+		expiresAt, err := time.Parse(time.RFC3339Nano, session.ExpiresAt)
+		if err != nil {
+			log.Printf("Skipping revoked session %s: %v", session.Id, err)
+			continue
+		}
+
+		l.revoked[session.Id] = expiresAt
+		if revokedAt.After(l.revokedAfter) {
+			l.revokedAfter = revokedAt
+		}
+	}
+	l.syncedAt = startedAt
+
+	return nil
+}